@@ -0,0 +1,58 @@
+package api
+
+import "fmt"
+
+// Errores de la API v1 en formato RFC 7807 (application/problem+json) con un código
+// estable para las máquinas en "code"; "detail" es el texto para las personas.
+//
+//	{"type": "urn:dummy-corp-erp:problem:not_found", "title": "Not Found", "status": 404,
+//	 "code": "not_found", "detail": "La persona con id 7 no existe", "instance": "/api/v1/persons/7"}
+
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix precede al código en el campo "type"
+const ProblemTypePrefix = "urn:dummy-corp-erp:problem:"
+
+// códigos de error de la API v1
+const (
+	ProblemInvalidParameter = "invalid_parameter"
+	ProblemInvalidBody      = "invalid_body"
+	ProblemValidation       = "validation_failed"
+	ProblemUnauthorized     = "unauthorized"
+	ProblemForbidden        = "forbidden"
+	ProblemNotFound         = "not_found"
+	ProblemRouteNotFound    = "route_not_found"
+	ProblemMethodNotAllowed = "method_not_allowed"
+	ProblemConflict         = "conflict"
+	ProblemRateLimited      = "rate_limited"
+	ProblemInternal         = "internal_error"
+	ProblemUpstream         = "upstream_error"
+	ProblemUnavailable      = "service_unavailable"
+	// la aplicación está suspendida o retirada (403)
+	ProblemApplicationInactive = "application_inactive"
+)
+
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Code      string              `json:"code"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []ProblemFieldError `json:"errors,omitempty"`
+}
+
+// ProblemFieldError detalla un campo no válido en problemas validation_failed
+type ProblemFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error permite devolver el problema como error en el cliente
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return fmt.Sprintf("%d %s (%s)", p.Status, p.Title, p.Code)
+	}
+	return fmt.Sprintf("%d %s (%s): %s", p.Status, p.Title, p.Code, p.Detail)
+}
@@ -0,0 +1,233 @@
+// Package api contiene los tipos de la API v1 (/api/v1) tal como viajan en JSON. Los comparten
+// el servidor, que los genera a partir de sus tablas, y el cliente de Go (paquete client).
+//
+//	listas        {"items": [...], "count": N}
+//	altas         201 con Location y el recurso creado
+//	cambios       200 con el recurso actualizado
+//	bajas         204 sin cuerpo (404 si no existía)
+//	errores       application/problem+json (Problem)
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Prefix es la ruta base de la API v1
+const Prefix = "/api/v1"
+
+// ListResource es la forma de todas las listas de la API v1
+type ListResource[T any] struct {
+	Items []T `json:"items"`
+	Count int `json:"count"`
+}
+
+type PersonResource struct {
+	ID        int       `json:"id"`
+	Dni       string    `json:"dni"`
+	Nombre    string    `json:"nombre"`
+	Apellidos string    `json:"apellidos"`
+	Email     string    `json:"email"`
+	Telefono  *string   `json:"telefono"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PersonDetailResource es la persona con sus pertenencias a aplicaciones
+type PersonDetailResource struct {
+	PersonResource
+	Memberships []MembershipResource `json:"memberships"`
+}
+
+// PersonWriteResource es el cuerpo de POST y PUT /api/v1/persons
+type PersonWriteResource struct {
+	Dni       string  `json:"dni"`
+	Nombre    string  `json:"nombre"`
+	Apellidos string  `json:"apellidos"`
+	Email     string  `json:"email"`
+	Telefono  *string `json:"telefono"`
+}
+
+type ApplicationResource struct {
+	ID                     int      `json:"id"`
+	ClientID               string   `json:"client_id"`
+	ClientUrl              string   `json:"client_url"`
+	ClientUrlCallback      *string  `json:"client_url_callback"`
+	BackchannelLogoutUrl   *string  `json:"backchannel_logout_url"`
+	RedirectUris           []string `json:"redirect_uris"`
+	PostLogoutRedirectUris []string `json:"post_logout_redirect_uris"`
+	TlsClientSubject       *string  `json:"tls_client_subject"`
+	// scopes que la aplicación puede pedir y flujos OAuth que usa
+	AllowedScopes []string `json:"allowed_scopes"`
+	GrantTypes    []string `json:"grant_types"`
+	LogoUrl       *string  `json:"logo_url"`
+	Description   *string  `json:"description"`
+	// contacto del responsable de la aplicación
+	OwnerName  *string `json:"owner_name"`
+	OwnerEmail *string `json:"owner_email"`
+	// active, suspended o retired; status_reason y status_changed_at son los del último cambio
+	Status          string  `json:"status"`
+	StatusReason    *string `json:"status_reason"`
+	StatusChangedAt *string `json:"status_changed_at"`
+	CreatedAt       string  `json:"created_at"`
+	// solo en la respuesta que genera el secreto
+	ClientSecret *string `json:"client_secret,omitempty"`
+}
+
+// estados de una aplicación: suspended bloquea la autenticación y las sesiones hasta que se
+// reactive; retired es la baja que conserva las pertenencias (DELETE solo sin referencias)
+const (
+	ApplicationStatusActive    = "active"
+	ApplicationStatusSuspended = "suspended"
+	ApplicationStatusRetired   = "retired"
+)
+
+// ApplicationStatusWriteResource es el cuerpo de PUT /api/v1/applications/{id}/status;
+// "active" reactiva una aplicación suspendida o retirada
+type ApplicationStatusWriteResource struct {
+	Status string  `json:"status"`
+	Reason *string `json:"reason"`
+}
+
+type ApplicationSummaryResource struct {
+	ID        int    `json:"id"`
+	ClientID  string `json:"client_id"`
+	ClientUrl string `json:"client_url"`
+}
+
+// ApplicationDetailResource es la aplicación con las personas que tienen acceso
+type ApplicationDetailResource struct {
+	ApplicationResource
+	Memberships []MembershipResource `json:"memberships"`
+}
+
+// ApplicationWriteResource es el cuerpo de POST y PUT /api/v1/applications; PUT sustituye todos los campos
+type ApplicationWriteResource struct {
+	ClientID               string   `json:"client_id"`
+	ClientUrl              string   `json:"client_url"`
+	ClientUrlCallback      *string  `json:"client_url_callback"`
+	BackchannelLogoutUrl   *string  `json:"backchannel_logout_url"`
+	RedirectUris           []string `json:"redirect_uris"`
+	PostLogoutRedirectUris []string `json:"post_logout_redirect_uris"`
+	TlsClientSubject       *string  `json:"tls_client_subject"`
+	AllowedScopes          []string `json:"allowed_scopes"`
+	// authorization_code, refresh_token o client_credentials; vacío es authorization_code
+	GrantTypes  []string `json:"grant_types"`
+	LogoUrl     *string  `json:"logo_url"`
+	Description *string  `json:"description"`
+	OwnerName   *string  `json:"owner_name"`
+	OwnerEmail  *string  `json:"owner_email"`
+	// solo en PUT: genera un secreto nuevo, que se devuelve en la respuesta; sin él se conserva
+	RotateSecret bool `json:"rotate_secret,omitempty"`
+}
+
+// MembershipResource es la pertenencia de una persona a una aplicación; según desde dónde
+// se consulte incluye la aplicación o la persona
+type MembershipResource struct {
+	ID            int                         `json:"id"`
+	PersonID      int                         `json:"person_id"`
+	ApplicationID int                         `json:"application_id"`
+	Profile       json.RawMessage             `json:"profile"`
+	CreatedAt     time.Time                   `json:"created_at"`
+	Application   *ApplicationSummaryResource `json:"application,omitempty"`
+	Person        *PersonResource             `json:"person,omitempty"`
+}
+
+// MembershipWriteResource es el cuerpo de PUT /api/v1/persons/{id}/memberships/{application_id}
+type MembershipWriteResource struct {
+	Profile json.RawMessage `json:"profile"`
+}
+
+// SessionWriteResource es el cuerpo opcional de POST .../sessions
+type SessionWriteResource struct {
+	RedirectUri string `json:"redirect_uri"`
+}
+
+type SessionResource struct {
+	Code         string `json:"code"`
+	RedirectUri  string `json:"redirect_uri"`
+	ExpiresInMin int    `json:"expires_in_min"`
+}
+
+// LogoutWriteResource es el cuerpo opcional de POST /api/v1/persons/{id}/logout
+type LogoutWriteResource struct {
+	ClientID              string `json:"client_id"`
+	PostLogoutRedirectUri string `json:"post_logout_redirect_uri"`
+}
+
+type LogoutResource struct {
+	PersonID              int                      `json:"person_id"`
+	Applications          int                      `json:"applications"`
+	Deliveries            []LogoutDeliveryResource `json:"deliveries"`
+	PostLogoutRedirectUri *string                  `json:"post_logout_redirect_uri"`
+}
+
+type LogoutDeliveryResource struct {
+	ID             int        `json:"id"`
+	PersonID       int        `json:"person_id"`
+	ApplicationID  int        `json:"application_id"`
+	Url            string     `json:"url"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode *int       `json:"last_status_code"`
+	LastError      *string    `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// AuthIniResource es lo necesario para elegir persona al iniciar sesión en la aplicación
+type AuthIniResource struct {
+	Application ApplicationResource  `json:"application"`
+	Persons     []PersonResource     `json:"persons"`
+	Memberships []MembershipResource `json:"memberships"`
+}
+
+type WebhookResource struct {
+	ID            int       `json:"id"`
+	ApplicationID int       `json:"application_id"`
+	Url           string    `json:"url"`
+	Events        []string  `json:"events"`
+	Active        bool      `json:"active"`
+	CreatedAt     time.Time `json:"created_at"`
+	// solo en la respuesta de alta
+	Secret *string `json:"secret,omitempty"`
+}
+
+// WebhookDeliveryResource es el estado de la entrega de un evento a una suscripción
+type WebhookDeliveryResource struct {
+	ID             int64      `json:"id"`
+	OutboxID       int64      `json:"outbox_id"`
+	SubscriptionID int        `json:"subscription_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code"`
+	LastError      *string    `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// WebhookWriteResource es el cuerpo de POST y PUT /api/v1/webhooks
+type WebhookWriteResource struct {
+	ApplicationID int      `json:"application_id"`
+	Url           string   `json:"url"`
+	Events        []string `json:"events"`
+	Active        *bool    `json:"active"`
+}
+
+// EventResource es un cambio del feed de eventos; data es la entidad tal como quedó
+type EventResource struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Entity    string          `json:"entity"`
+	EntityID  int             `json:"entity_id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// EventsPageResource es una página del feed de eventos
+type EventsPageResource struct {
+	Items      []EventResource `json:"items"`
+	Count      int             `json:"count"`
+	NextCursor string          `json:"next_cursor"`
+}
@@ -0,0 +1,222 @@
+// Package client es el cliente de Go de la API v1 del ERP (/api/v1) para el CRM y el resto
+// de servicios. Usa los tipos del paquete api, los mismos que serializa el servidor.
+//
+//	erp := client.New("https://erp.mydomain.com/corp-erp-api", token)
+//	person, err := erp.GetPerson(ctx, 7)
+//	if client.IsNotFound(err) {
+//		...
+//	}
+//
+// Los errores de la API se devuelven como *api.Problem. Las peticiones idempotentes (GET, PUT,
+// DELETE) se reintentan ante errores de red, 429, 502, 503 y 504, respetando Retry-After.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"dummy-corp-erp-server/api"
+)
+
+const (
+	defaultTimeout    = 30 * time.Second
+	defaultMaxRetries = 3
+	defaultRetryWait  = 200 * time.Millisecond
+	maxRetryWait      = 10 * time.Second
+	userAgent         = "dummy-corp-erp-client/1"
+)
+
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	maxRetries int
+	retryWait  time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient usa otro http.Client (transporte con mTLS, proxy, timeouts propios)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetries fija los reintentos y la espera inicial, que se duplica en cada intento;
+// con maxRetries 0 no se reintenta
+func WithRetries(maxRetries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryWait = wait
+	}
+}
+
+// New crea el cliente; baseURL es la raíz del servidor (sin /api/v1) y token el bearer de la
+// aplicación, que se envía en todas las peticiones
+func New(baseURL, token string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		maxRetries: defaultMaxRetries,
+		retryWait:  defaultRetryWait,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// IsNotFound indica si el error es un 404 de la API
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict indica si el error es un 409 de la API (p. ej. client_id duplicado)
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+func hasStatus(err error, status int) bool {
+	var problem *api.Problem
+	return errors.As(err, &problem) && problem.Status == status
+}
+
+// do envía la petición y decodifica la respuesta en out (si no es nil); devuelve el estado
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) (int, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return 0, fmt.Errorf("error al serializar la petición: %w", err)
+		}
+	}
+
+	target := c.baseURL + api.Prefix + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	// POST no es idempotente: un reintento podría duplicar el alta
+	retries := c.maxRetries
+	if method == http.MethodPost {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return 0, fmt.Errorf("error creando la solicitud: %w", err)
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= retries {
+				return 0, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			if err := c.wait(ctx, attempt, ""); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if retryable(res.StatusCode) && attempt < retries {
+			retryAfter := res.Header.Get("Retry-After")
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+			if err := c.wait(ctx, attempt, retryAfter); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		return res.StatusCode, decodeResponse(res, out)
+	}
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// wait espera antes del siguiente intento: Retry-After si el servidor lo indica, si no
+// backoff exponencial con algo de variación
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter string) error {
+	delay := c.retryWait << attempt
+	if delay > 1 {
+		delay += rand.N(delay / 2)
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+	if delay > maxRetryWait {
+		delay = maxRetryWait
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// decodeResponse decodifica una respuesta 2xx en out; el resto se convierte en *api.Problem
+func decodeResponse(res *http.Response, out any) error {
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		if out == nil || res.StatusCode == http.StatusNoContent {
+			io.Copy(io.Discard, res.Body)
+			return nil
+		}
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			return fmt.Errorf("error al decodificar la respuesta: %w", err)
+		}
+		return nil
+	}
+
+	problem := &api.Problem{Status: res.StatusCode, Title: http.StatusText(res.StatusCode)}
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	switch mediaType {
+	case api.ProblemContentType:
+		if err := json.Unmarshal(data, problem); err == nil {
+			return problem
+		}
+	case "application/json":
+		// las rutas sin versión y algunos proxies responden {"error": "..."}
+		var legacy struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &legacy) == nil {
+			problem.Detail = legacy.Error
+		}
+	default:
+		problem.Detail = strings.TrimSpace(string(data))
+	}
+	return problem
+}
@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dummy-corp-erp-server/api"
+)
+
+// newTestServer monta un servidor que comprueba el token y responde con handler
+func newTestServer(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.Header().Set("Content-Type", api.ProblemContentType)
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(api.Problem{Status: http.StatusUnauthorized, Code: api.ProblemUnauthorized})
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return New(srv.URL, "tok", WithRetries(2, time.Millisecond))
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func TestListPersons(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/v1/persons" {
+			t.Errorf("petición inesperada %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.URL.Query().Get("q"); got != "garcia" {
+			t.Errorf("q = %q", got)
+		}
+		if got := r.URL.Query().Get("application_id"); got != "3" {
+			t.Errorf("application_id = %q", got)
+		}
+		writeJSON(w, http.StatusOK, api.ListResource[api.PersonResource]{
+			Items: []api.PersonResource{{ID: 1, Dni: "12345678Z", Nombre: "Ana"}},
+			Count: 1,
+		})
+	})
+
+	list, err := c.ListPersons(context.Background(), PersonFilter{Q: "garcia", ApplicationID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Nombre != "Ana" {
+		t.Errorf("personas = %+v", list)
+	}
+}
+
+func TestCreatePerson(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/persons" {
+			t.Errorf("petición inesperada %s %s", r.Method, r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var sent api.PersonWriteResource
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Location", "/api/v1/persons/9")
+		writeJSON(w, http.StatusCreated, api.PersonResource{ID: 9, Dni: sent.Dni, Nombre: sent.Nombre})
+	})
+
+	person, err := c.CreatePerson(context.Background(), api.PersonWriteResource{Dni: "12345678Z", Nombre: "Ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if person.ID != 9 || person.Nombre != "Ana" {
+		t.Errorf("persona = %+v", person)
+	}
+}
+
+func TestSetMembershipAndSession(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "PUT /api/v1/persons/1/memberships/2":
+			var sent api.MembershipWriteResource
+			json.NewDecoder(r.Body).Decode(&sent)
+			if string(sent.Profile) != `{"rol":"admin"}` {
+				t.Errorf("profile = %s", sent.Profile)
+			}
+			writeJSON(w, http.StatusCreated, api.MembershipResource{ID: 5, PersonID: 1, ApplicationID: 2, Profile: sent.Profile})
+		case "POST /api/v1/persons/1/memberships/2/sessions":
+			var sent api.SessionWriteResource
+			json.NewDecoder(r.Body).Decode(&sent)
+			writeJSON(w, http.StatusCreated, api.SessionResource{Code: "abc", RedirectUri: sent.RedirectUri, ExpiresInMin: 60})
+		default:
+			t.Errorf("petición inesperada %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	ctx := context.Background()
+	membership, created, err := c.SetMembership(ctx, 1, 2, map[string]string{"rol": "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || membership.ID != 5 {
+		t.Errorf("pertenencia = %+v, created = %v", membership, created)
+	}
+
+	session, err := c.CreateSession(ctx, 1, 2, "https://crm.mydomain.com/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Code != "abc" || session.RedirectUri != "https://crm.mydomain.com/callback" {
+		t.Errorf("sesión = %+v", session)
+	}
+}
+
+func TestProblemErrors(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", api.ProblemContentType)
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(api.Problem{
+			Type: api.ProblemTypePrefix + api.ProblemNotFound, Status: http.StatusNotFound,
+			Code: api.ProblemNotFound, Detail: "La persona con id 7 no existe",
+		})
+	})
+
+	_, err := c.GetPerson(context.Background(), 7)
+	if !IsNotFound(err) {
+		t.Fatalf("error = %v, se esperaba 404", err)
+	}
+	var problem *api.Problem
+	if !errors.As(err, &problem) || problem.Detail != "La persona con id 7 no existe" {
+		t.Errorf("problema = %+v", problem)
+	}
+
+	// sin el token correcto el servidor responde 401
+	c.token = "otro"
+	_, err = c.ListApplications(context.Background())
+	if !errors.As(err, &problem) || problem.Code != api.ProblemUnauthorized {
+		t.Errorf("error = %v, se esperaba unauthorized", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, http.StatusOK, api.ListResource[api.ApplicationResource]{Items: []api.ApplicationResource{{ID: 1}}, Count: 1})
+	})
+
+	list, err := c.ListApplications(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || calls.Load() != 3 {
+		t.Errorf("aplicaciones = %+v tras %d intentos", list, calls.Load())
+	}
+
+	// POST no se reintenta: el alta podría haberse hecho
+	calls.Store(0)
+	_, err = c.CreateApplication(context.Background(), api.ApplicationWriteResource{ClientID: "crm"})
+	if err == nil || calls.Load() != 1 {
+		t.Errorf("error = %v tras %d intentos, se esperaba un único 503", err, calls.Load())
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetApplication(ctx, 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, se esperaba context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("la espera de Retry-After no respetó el contexto")
+	}
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"dummy-corp-erp-server/api"
+)
+
+// PersonFilter son los filtros de ListPersons; los campos vacíos no filtran
+type PersonFilter struct {
+	Q             string // busca en dni, nombre, apellidos y email
+	Dni           string
+	Email         string
+	ApplicationID int // solo las personas con acceso a la aplicación
+}
+
+func (f PersonFilter) query() url.Values {
+	query := url.Values{}
+	if f.Q != "" {
+		query.Set("q", f.Q)
+	}
+	if f.Dni != "" {
+		query.Set("dni", f.Dni)
+	}
+	if f.Email != "" {
+		query.Set("email", f.Email)
+	}
+	if f.ApplicationID != 0 {
+		query.Set("application_id", strconv.Itoa(f.ApplicationID))
+	}
+	return query
+}
+
+// ListPersons lista las personas: GET /api/v1/persons
+func (c *Client) ListPersons(ctx context.Context, filter PersonFilter) ([]api.PersonResource, error) {
+	var list api.ListResource[api.PersonResource]
+	if _, err := c.do(ctx, http.MethodGet, "/persons", filter.query(), nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// GetPerson devuelve la persona con sus pertenencias: GET /api/v1/persons/{id}
+func (c *Client) GetPerson(ctx context.Context, id int) (*api.PersonDetailResource, error) {
+	var person api.PersonDetailResource
+	if _, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/persons/%d", id), nil, nil, &person); err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
+
+// CreatePerson da de alta una persona: POST /api/v1/persons
+func (c *Client) CreatePerson(ctx context.Context, person api.PersonWriteResource) (*api.PersonResource, error) {
+	var created api.PersonResource
+	if _, err := c.do(ctx, http.MethodPost, "/persons", nil, person, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdatePerson sustituye los datos de una persona: PUT /api/v1/persons/{id}
+func (c *Client) UpdatePerson(ctx context.Context, id int, person api.PersonWriteResource) (*api.PersonResource, error) {
+	var updated api.PersonResource
+	if _, err := c.do(ctx, http.MethodPut, fmt.Sprintf("/persons/%d", id), nil, person, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeletePerson elimina una persona: DELETE /api/v1/persons/{id}
+func (c *Client) DeletePerson(ctx context.Context, id int) error {
+	_, err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/persons/%d", id), nil, nil, nil)
+	return err
+}
+
+// LogoutPerson cierra todas las sesiones de una persona: POST /api/v1/persons/{id}/logout
+func (c *Client) LogoutPerson(ctx context.Context, id int, logout api.LogoutWriteResource) (*api.LogoutResource, error) {
+	var res api.LogoutResource
+	if _, err := c.do(ctx, http.MethodPost, fmt.Sprintf("/persons/%d/logout", id), nil, logout, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListApplications lista las aplicaciones (sin secretos): GET /api/v1/applications
+func (c *Client) ListApplications(ctx context.Context) ([]api.ApplicationResource, error) {
+	var list api.ListResource[api.ApplicationResource]
+	if _, err := c.do(ctx, http.MethodGet, "/applications", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// GetApplication devuelve la aplicación con sus pertenencias: GET /api/v1/applications/{id}
+func (c *Client) GetApplication(ctx context.Context, id int) (*api.ApplicationDetailResource, error) {
+	var app api.ApplicationDetailResource
+	if _, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/applications/%d", id), nil, nil, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// CreateApplication registra una aplicación: POST /api/v1/applications; ClientSecret solo
+// viene en esta respuesta
+func (c *Client) CreateApplication(ctx context.Context, app api.ApplicationWriteResource) (*api.ApplicationResource, error) {
+	var created api.ApplicationResource
+	if _, err := c.do(ctx, http.MethodPost, "/applications", nil, app, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateApplication sustituye los datos de una aplicación: PUT /api/v1/applications/{id}; con
+// RotateSecret se genera un secreto nuevo, que viene en ClientSecret
+func (c *Client) UpdateApplication(ctx context.Context, id int, app api.ApplicationWriteResource) (*api.ApplicationResource, error) {
+	var updated api.ApplicationResource
+	if _, err := c.do(ctx, http.MethodPut, fmt.Sprintf("/applications/%d", id), nil, app, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteApplication elimina una aplicación sin pertenencias: DELETE /api/v1/applications/{id}
+// (con ellas es un conflicto; SetApplicationStatus con api.ApplicationStatusRetired la retira)
+func (c *Client) DeleteApplication(ctx context.Context, id int) error {
+	_, err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/applications/%d", id), nil, nil, nil)
+	return err
+}
+
+// SetApplicationStatus suspende, retira o reactiva una aplicación:
+// PUT /api/v1/applications/{id}/status
+func (c *Client) SetApplicationStatus(ctx context.Context, id int, status api.ApplicationStatusWriteResource) (*api.ApplicationResource, error) {
+	var updated api.ApplicationResource
+	if _, err := c.do(ctx, http.MethodPut, fmt.Sprintf("/applications/%d/status", id), nil, status, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// GetAuthIni devuelve lo necesario para elegir persona al iniciar sesión en la aplicación:
+// GET /api/v1/authini/{client_id}
+func (c *Client) GetAuthIni(ctx context.Context, clientID string) (*api.AuthIniResource, error) {
+	var ini api.AuthIniResource
+	if _, err := c.do(ctx, http.MethodGet, "/authini/"+url.PathEscape(clientID), nil, nil, &ini); err != nil {
+		return nil, err
+	}
+	return &ini, nil
+}
+
+// GetMembership devuelve la pertenencia de una persona a una aplicación:
+// GET /api/v1/persons/{id}/memberships/{application_id}
+func (c *Client) GetMembership(ctx context.Context, personID, applicationID int) (*api.MembershipResource, error) {
+	var membership api.MembershipResource
+	if _, err := c.do(ctx, http.MethodGet, membershipPath(personID, applicationID), nil, nil, &membership); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// SetMembership da de alta a la persona en la aplicación o cambia su profile (cualquier valor
+// que se serialice como objeto JSON, o nil); created indica si la pertenencia es nueva
+func (c *Client) SetMembership(ctx context.Context, personID, applicationID int, profile any) (membership *api.MembershipResource, created bool, err error) {
+	var sent api.MembershipWriteResource
+	if profile != nil {
+		if sent.Profile, err = json.Marshal(profile); err != nil {
+			return nil, false, fmt.Errorf("error al serializar el profile: %w", err)
+		}
+	}
+	membership = &api.MembershipResource{}
+	status, err := c.do(ctx, http.MethodPut, membershipPath(personID, applicationID), nil, sent, membership)
+	if err != nil {
+		return nil, false, err
+	}
+	return membership, status == http.StatusCreated, nil
+}
+
+// DeleteMembership da de baja a la persona en la aplicación
+func (c *Client) DeleteMembership(ctx context.Context, personID, applicationID int) error {
+	_, err := c.do(ctx, http.MethodDelete, membershipPath(personID, applicationID), nil, nil, nil)
+	return err
+}
+
+// CreateSession crea el código de sesión de la persona en la aplicación; redirectURI puede ir
+// vacía si la aplicación solo tiene una registrada
+func (c *Client) CreateSession(ctx context.Context, personID, applicationID int, redirectURI string) (*api.SessionResource, error) {
+	var session api.SessionResource
+	sent := api.SessionWriteResource{RedirectUri: redirectURI}
+	if _, err := c.do(ctx, http.MethodPost, membershipPath(personID, applicationID)+"/sessions", nil, sent, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func membershipPath(personID, applicationID int) string {
+	return fmt.Sprintf("/persons/%d/memberships/%d", personID, applicationID)
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"dummy-corp-erp-server/api"
+)
+
+// API versionada /api/v1: recursos con tipos fijos, nombres coherentes (application_id en lugar
+// de auth_client_id, memberships en lugar de lpersonapp) y errores RFC 7807 (problem.go).
+// Los tipos de los recursos están en el paquete api, compartido con el cliente de Go.
+// Las rutas sin versión siguen respondiendo como hasta ahora.
+
+const apiV1Prefix = api.Prefix
+
+// apiV1Routes devuelve las rutas de la API v1
+func apiV1Routes(db *sql.DB) []route {
+	return []route{
+		{method: http.MethodGet, path: apiV1Prefix + "/persons", handler: v1GetPersonsHandler(db)},
+		{method: http.MethodPost, path: apiV1Prefix + "/persons", handler: v1PostPersonHandler(db)},
+		{method: http.MethodGet, path: apiV1Prefix + "/persons/{id}", handler: v1GetPersonHandler(db)},
+		{method: http.MethodPut, path: apiV1Prefix + "/persons/{id}", handler: v1PutPersonHandler(db)},
+		{method: http.MethodDelete, path: apiV1Prefix + "/persons/{id}", handler: v1DeletePersonHandler(db)},
+		{method: http.MethodPost, path: apiV1Prefix + "/persons/{id}/logout", handler: v1PostLogoutHandler(db)},
+		{method: http.MethodGet, path: apiV1Prefix + "/persons/{id}/memberships/{application_id}", handler: v1GetMembershipHandler(db)},
+		{method: http.MethodPut, path: apiV1Prefix + "/persons/{id}/memberships/{application_id}", handler: v1PutMembershipHandler(db)},
+		{method: http.MethodDelete, path: apiV1Prefix + "/persons/{id}/memberships/{application_id}", handler: v1DeleteMembershipHandler(db)},
+		{method: http.MethodPost, path: apiV1Prefix + "/persons/{id}/memberships/{application_id}/sessions", handler: v1PostSessionHandler(db)},
+
+		{method: http.MethodGet, path: apiV1Prefix + "/applications", handler: v1GetApplicationsHandler(db)},
+		{method: http.MethodPost, path: apiV1Prefix + "/applications", handler: v1PostApplicationHandler(db)},
+		{method: http.MethodGet, path: apiV1Prefix + "/applications/{id}", handler: v1GetApplicationHandler(db)},
+		{method: http.MethodPut, path: apiV1Prefix + "/applications/{id}", handler: v1PutApplicationHandler(db)},
+		{method: http.MethodDelete, path: apiV1Prefix + "/applications/{id}", handler: v1DeleteApplicationHandler(db)},
+		{method: http.MethodPut, path: apiV1Prefix + "/applications/{id}/status", handler: v1PutApplicationStatusHandler(db)},
+		{method: http.MethodGet, path: apiV1Prefix + "/authini/{client_id}", handler: v1GetAuthIniHandler(db)},
+		{method: http.MethodGet, path: apiV1Prefix + "/logout-deliveries", handler: v1GetLogoutDeliveriesHandler(db)},
+
+		{method: http.MethodGet, path: apiV1Prefix + "/webhooks", handler: v1GetWebhooksHandler(db)},
+		{method: http.MethodPost, path: apiV1Prefix + "/webhooks", handler: v1PostWebhookHandler(db)},
+		{method: http.MethodGet, path: apiV1Prefix + "/webhooks/{id}", handler: v1GetWebhookHandler(db)},
+		{method: http.MethodPut, path: apiV1Prefix + "/webhooks/{id}", handler: v1PutWebhookHandler(db)},
+		{method: http.MethodDelete, path: apiV1Prefix + "/webhooks/{id}", handler: v1DeleteWebhookHandler(db)},
+		{method: http.MethodGet, path: apiV1Prefix + "/webhook-deliveries", handler: v1GetWebhookDeliveriesHandler(db)},
+		{method: http.MethodPost, path: apiV1Prefix + "/webhook-deliveries/{id}/retry", handler: v1PostWebhookDeliveryRetryHandler(db)},
+
+		{method: http.MethodGet, path: apiV1Prefix + "/events", handler: v1GetEventsHandler(db)},
+		{method: http.MethodGet, path: apiV1Prefix + "/events/stream", handler: getEventsStreamHandler(db)},
+	}
+}
+
+// isApiV1 indica si la petición es de la API v1 (errores como problem+json)
+func isApiV1(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, apiV1Prefix+"/")
+}
+
+// listResource convierte una lista; una lista vacía se devuelve como [] y no como null
+func listResource[S any, T any](list []S, convert func(S) T) api.ListResource[T] {
+	items := make([]T, 0, len(list))
+	for _, item := range list {
+		items = append(items, convert(item))
+	}
+	return api.ListResource[T]{Items: items, Count: len(items)}
+}
+
+func personResource(p PersonData) api.PersonResource {
+	return api.PersonResource{
+		ID:        p.ID,
+		Dni:       p.Dni,
+		Nombre:    p.Nombre,
+		Apellidos: p.Apellidos,
+		Email:     p.Email,
+		Telefono:  p.Telefono,
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+// applicationResource nunca incluye el secreto; se añade solo al generarlo
+func applicationResource(app AuthClient) api.ApplicationResource {
+	res := api.ApplicationResource{
+		ID:                     app.ID,
+		ClientID:               app.ClientID,
+		ClientUrl:              app.ClientUrl,
+		ClientUrlCallback:      app.ClientUrlCallback,
+		BackchannelLogoutUrl:   app.BackchannelLogoutUrl,
+		RedirectUris:           app.RedirectUris,
+		PostLogoutRedirectUris: app.PostLogoutRedirectUris,
+		TlsClientSubject:       app.TlsClientSubject,
+		AllowedScopes:          app.AllowedScopes,
+		GrantTypes:             app.GrantTypes,
+		LogoUrl:                app.LogoUrl,
+		Description:            app.Description,
+		OwnerName:              app.OwnerName,
+		OwnerEmail:             app.OwnerEmail,
+		Status:                 app.Status,
+		StatusReason:           app.StatusReason,
+		StatusChangedAt:        app.StatusChangedAt,
+		CreatedAt:              app.CreatedAt,
+	}
+	if res.RedirectUris == nil {
+		res.RedirectUris = []string{}
+	}
+	if res.PostLogoutRedirectUris == nil {
+		res.PostLogoutRedirectUris = []string{}
+	}
+	if res.AllowedScopes == nil {
+		res.AllowedScopes = []string{}
+	}
+	if res.GrantTypes == nil {
+		res.GrantTypes = []string{}
+	}
+	return res
+}
+
+func applicationSummaryResource(app AuthClientShort) api.ApplicationSummaryResource {
+	return api.ApplicationSummaryResource{ID: app.ID, ClientID: app.ClientID, ClientUrl: app.ClientUrl}
+}
+
+// membershipResource devuelve el profile como JSON y no como texto con JSON dentro
+func membershipResource(pa PersonApp) api.MembershipResource {
+	res := api.MembershipResource{
+		ID:            pa.ID,
+		PersonID:      pa.PersonID,
+		ApplicationID: pa.AuthClientId,
+		CreatedAt:     pa.CreatedAt,
+		Profile:       json.RawMessage("null"),
+	}
+	if pa.Profile != nil && json.Valid([]byte(*pa.Profile)) {
+		res.Profile = json.RawMessage(*pa.Profile)
+	}
+	return res
+}
+
+func logoutDeliveryResource(d LogoutDelivery) api.LogoutDeliveryResource {
+	return api.LogoutDeliveryResource{
+		ID:             d.ID,
+		PersonID:       d.PersonID,
+		ApplicationID:  d.AuthClientId,
+		Url:            d.Url,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		DeliveredAt:    d.DeliveredAt,
+	}
+}
+
+func webhookResource(s WebhookSubscription) api.WebhookResource {
+	res := api.WebhookResource{
+		ID:            s.ID,
+		ApplicationID: s.AuthClientId,
+		Url:           s.Url,
+		Events:        s.Events,
+		Active:        s.Active,
+		CreatedAt:     s.CreatedAt,
+	}
+	if res.Events == nil {
+		res.Events = []string{}
+	}
+	return res
+}
+
+func webhookDeliveryResource(d WebhookDelivery) api.WebhookDeliveryResource {
+	return api.WebhookDeliveryResource{
+		ID:             d.ID,
+		OutboxID:       d.OutboxID,
+		SubscriptionID: d.SubscriptionID,
+		EventType:      d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		DeliveredAt:    d.DeliveredAt,
+	}
+}
+
+func eventResource(e OutboxEvent) api.EventResource {
+	return api.EventResource{ID: e.ID, Type: e.Type, Entity: e.Entity, EntityID: e.EntityID, Data: e.Data, CreatedAt: e.CreatedAt}
+}
+
+// validatePersonWrite normaliza la persona recibida y devuelve los campos no válidos
+func validatePersonWrite(p *api.PersonWriteResource) []api.ProblemFieldError {
+	var fields []api.ProblemFieldError
+	p.Dni = strings.TrimSpace(p.Dni)
+	p.Nombre = strings.TrimSpace(p.Nombre)
+	p.Apellidos = strings.TrimSpace(p.Apellidos)
+	p.Email = strings.TrimSpace(p.Email)
+	for _, f := range []struct{ name, value string }{
+		{"dni", p.Dni}, {"nombre", p.Nombre}, {"apellidos", p.Apellidos}, {"email", p.Email},
+	} {
+		if f.value == "" {
+			fields = append(fields, api.ProblemFieldError{Field: f.name, Message: "es requerido"})
+		}
+	}
+	if p.Email != "" && !strings.Contains(p.Email, "@") {
+		fields = append(fields, api.ProblemFieldError{Field: "email", Message: "no es una dirección de correo"})
+	}
+	// un teléfono vacío se guarda como NULL para no violar telefono_check
+	if p.Telefono != nil && strings.TrimSpace(*p.Telefono) == "" {
+		p.Telefono = nil
+	}
+	return fields
+}
+
+// validateApplicationWrite normaliza la aplicación recibida y devuelve los campos no válidos
+func validateApplicationWrite(a *api.ApplicationWriteResource) []api.ProblemFieldError {
+	var fields []api.ProblemFieldError
+	a.ClientID = strings.TrimSpace(a.ClientID)
+	if a.ClientID == "" {
+		fields = append(fields, api.ProblemFieldError{Field: "client_id", Message: "es requerido"})
+	} else if len(a.ClientID) > 32 {
+		fields = append(fields, api.ProblemFieldError{Field: "client_id", Message: "supera los 32 caracteres"})
+	}
+	if _, err := corsParseOrigin(a.ClientUrl); err != nil {
+		fields = append(fields, api.ProblemFieldError{Field: "client_url", Message: err.Error()})
+	}
+	if a.ClientUrlCallback != nil && *a.ClientUrlCallback == "" {
+		a.ClientUrlCallback = nil
+	}
+	if a.ClientUrlCallback != nil {
+		if err := validateRedirectUriFormat(*a.ClientUrlCallback); err != nil {
+			fields = append(fields, api.ProblemFieldError{Field: "client_url_callback", Message: err.Error()})
+		}
+	}
+	if a.BackchannelLogoutUrl != nil && *a.BackchannelLogoutUrl == "" {
+		a.BackchannelLogoutUrl = nil
+	}
+	if a.BackchannelLogoutUrl != nil {
+		if err := validateRedirectUriFormat(*a.BackchannelLogoutUrl); err != nil {
+			fields = append(fields, api.ProblemFieldError{Field: "backchannel_logout_url", Message: err.Error()})
+		}
+	}
+	if err := validateRedirectUrisFormat(a.RedirectUris); err != nil {
+		fields = append(fields, api.ProblemFieldError{Field: "redirect_uris", Message: err.Error()})
+	}
+	if err := validateRedirectUrisFormat(a.PostLogoutRedirectUris); err != nil {
+		fields = append(fields, api.ProblemFieldError{Field: "post_logout_redirect_uris", Message: err.Error()})
+	}
+	a.TlsClientSubject = normalizeTlsClientSubject(a.TlsClientSubject)
+
+	if a.AllowedScopes == nil {
+		a.AllowedScopes = []string{}
+	}
+	if err := validateScopes(a.AllowedScopes); err != nil {
+		fields = append(fields, api.ProblemFieldError{Field: "allowed_scopes", Message: err.Error()})
+	}
+	if len(a.GrantTypes) == 0 {
+		a.GrantTypes = []string{grantTypeAuthorizationCode}
+	}
+	if err := validateGrantTypes(a.GrantTypes); err != nil {
+		fields = append(fields, api.ProblemFieldError{Field: "grant_types", Message: err.Error()})
+	}
+
+	a.LogoUrl = normalizeOptional(a.LogoUrl)
+	if a.LogoUrl != nil {
+		if err := validateLogoUrl(*a.LogoUrl); err != nil {
+			fields = append(fields, api.ProblemFieldError{Field: "logo_url", Message: err.Error()})
+		}
+	}
+	a.Description = normalizeOptional(a.Description)
+	if a.Description != nil && len(*a.Description) > 1000 {
+		fields = append(fields, api.ProblemFieldError{Field: "description", Message: "supera los 1000 caracteres"})
+	}
+	a.OwnerName = normalizeOptional(a.OwnerName)
+	if a.OwnerName != nil && len(*a.OwnerName) > 255 {
+		fields = append(fields, api.ProblemFieldError{Field: "owner_name", Message: "supera los 255 caracteres"})
+	}
+	a.OwnerEmail = normalizeOptional(a.OwnerEmail)
+	if a.OwnerEmail != nil {
+		if err := validateOwnerEmail(*a.OwnerEmail); err != nil {
+			fields = append(fields, api.ProblemFieldError{Field: "owner_email", Message: err.Error()})
+		}
+	}
+	return fields
+}
+
+// membershipProfile devuelve el profile a guardar; debe ser un objeto JSON o null
+func membershipProfile(m api.MembershipWriteResource) (*string, error) {
+	if len(m.Profile) == 0 || string(m.Profile) == "null" {
+		return nil, nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(m.Profile, &obj); err != nil {
+		return nil, fmt.Errorf("debe ser un objeto JSON")
+	}
+	profile := string(m.Profile)
+	return &profile, nil
+}
+
+// v1DecodeBody lee el cuerpo JSON rechazando campos desconocidos; con optional un cuerpo vacío es válido
+func v1DecodeBody(w http.ResponseWriter, r *http.Request, dst any, optional bool) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		if optional && err == io.EOF {
+			return true
+		}
+		writeProblem(w, r, http.StatusBadRequest, api.ProblemInvalidBody, fmt.Sprintf(`Error al decodificar el JSON: %v`, err))
+		return false
+	}
+	return true
+}
+
+// writeJsonStatus responde con el valor serializado en JSON y el código indicado
+func writeJsonStatus(w http.ResponseWriter, status int, data any) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		errJsonStatus(w, fmt.Sprintf(`Error al convertir a JSON: %v`, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
+
+// writeCreated responde 201 con la ubicación del recurso creado
+func writeCreated(w http.ResponseWriter, location string, data any) {
+	w.Header().Set("Location", location)
+	writeJsonStatus(w, http.StatusCreated, data)
+}
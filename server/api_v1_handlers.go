@@ -0,0 +1,737 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dummy-corp-erp-server/api"
+)
+
+// Manejadores de la API v1. Los de personas, aplicaciones y pertenencias delegan en los
+// servicios (services.go), que comparten con gRPC; el resto usa las funciones postgres_*
+// como las rutas sin versión. Cambian la forma de las respuestas y los errores (ver api_v1.go
+// y problem.go).
+
+// v1GetPersonsHandler lista las personas: GET /api/v1/persons?q=&dni=&email=&application_id=
+func v1GetPersonsHandler(db *sql.DB) http.HandlerFunc {
+	service := personService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := PersonFilter{
+			Q:     strings.TrimSpace(query.Get("q")),
+			Dni:   strings.TrimSpace(query.Get("dni")),
+			Email: strings.TrimSpace(query.Get("email")),
+		}
+		application_id, err := queryIntParam(r, "application_id")
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemInvalidParameter, err.Error())
+			return
+		}
+		filter.AuthClientID = application_id
+
+		list, err := service.List(r.Context(), filter)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, list)
+	}
+}
+
+// v1GetPersonHandler devuelve la persona con sus pertenencias: GET /api/v1/persons/{id}
+func v1GetPersonHandler(db *sql.DB) http.HandlerFunc {
+	service := personService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		detail, err := service.Get(r.Context(), iid)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, detail)
+	}
+}
+
+// v1PostPersonHandler da de alta una persona: POST /api/v1/persons
+func v1PostPersonHandler(db *sql.DB) http.HandlerFunc {
+	service := personService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sent api.PersonWriteResource
+		if !v1DecodeBody(w, r, &sent, false) {
+			return
+		}
+
+		created, err := service.Create(r.Context(), sent)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeCreated(w, fmt.Sprintf("%s/persons/%d", apiV1Prefix, created.ID), created)
+	}
+}
+
+// v1PutPersonHandler sustituye los datos de una persona: PUT /api/v1/persons/{id}
+func v1PutPersonHandler(db *sql.DB) http.HandlerFunc {
+	service := personService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		var sent api.PersonWriteResource
+		if !v1DecodeBody(w, r, &sent, false) {
+			return
+		}
+
+		updated, err := service.Update(r.Context(), iid, sent)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, updated)
+	}
+}
+
+// v1DeletePersonHandler elimina una persona: DELETE /api/v1/persons/{id}
+func v1DeletePersonHandler(db *sql.DB) http.HandlerFunc {
+	service := personService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		if err := service.Delete(r.Context(), iid); err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// v1PostLogoutHandler cierra todas las sesiones de una persona: POST /api/v1/persons/{id}/logout
+// cuerpo opcional {"client_id": "...", "post_logout_redirect_uri": "..."}
+func v1PostLogoutHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		var sent api.LogoutWriteResource
+		if !v1DecodeBody(w, r, &sent, true) {
+			return
+		}
+
+		post_logout_redirect_uri, err := logoutRedirectUri(ctx, db, sent.ClientID, sent.PostLogoutRedirectUri)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemValidation, err.Error(),
+				api.ProblemFieldError{Field: "post_logout_redirect_uri", Message: err.Error()})
+			return
+		}
+
+		person, err := postgres_person_by_id(ctx, db, iid)
+		if errors.Is(err, errPersonNotFound) {
+			writeProblem(w, r, http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La persona con id %d no existe`, iid))
+			return
+		}
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener la persona`, err)
+			return
+		}
+
+		lapp, deliveries, err := logoutPerson(ctx, db, person.ID)
+		if errors.Is(err, errLogoutAuthService) {
+			writeProblem(w, r, http.StatusBadGateway, api.ProblemUpstream, err.Error())
+			return
+		}
+		if err != nil {
+			writeProblem(w, r, http.StatusInternalServerError, api.ProblemInternal, err.Error())
+			return
+		}
+
+		res := api.LogoutResource{
+			PersonID:     person.ID,
+			Applications: len(lapp),
+			Deliveries:   listResource(deliveries, logoutDeliveryResource).Items,
+		}
+		if post_logout_redirect_uri != "" {
+			res.PostLogoutRedirectUri = &post_logout_redirect_uri
+		}
+		writeJsonStatus(w, http.StatusOK, res)
+	}
+}
+
+// v1GetMembershipHandler devuelve la pertenencia de una persona a una aplicación:
+// GET /api/v1/persons/{id}/memberships/{application_id}
+func v1GetMembershipHandler(db *sql.DB) http.HandlerFunc {
+	service := membershipService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+		iidApp, ok := pathInt(w, r, "application_id")
+		if !ok {
+			return
+		}
+
+		membership, err := service.Get(r.Context(), iidPer, iidApp)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, membership)
+	}
+}
+
+// v1PutMembershipHandler da de alta a la persona en la aplicación o cambia su profile:
+// PUT /api/v1/persons/{id}/memberships/{application_id} con {"profile": {...}} opcional.
+// Responde 201 si la pertenencia es nueva y 200 si ya existía.
+func v1PutMembershipHandler(db *sql.DB) http.HandlerFunc {
+	service := membershipService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+		iidApp, ok := pathInt(w, r, "application_id")
+		if !ok {
+			return
+		}
+
+		var sent api.MembershipWriteResource
+		if !v1DecodeBody(w, r, &sent, true) {
+			return
+		}
+
+		membership, created, err := service.Set(r.Context(), iidPer, iidApp, sent)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		if created {
+			writeCreated(w, fmt.Sprintf("%s/persons/%d/memberships/%d", apiV1Prefix, iidPer, iidApp), membership)
+			return
+		}
+		writeJsonStatus(w, http.StatusOK, membership)
+	}
+}
+
+// v1DeleteMembershipHandler da de baja a la persona en la aplicación:
+// DELETE /api/v1/persons/{id}/memberships/{application_id}
+func v1DeleteMembershipHandler(db *sql.DB) http.HandlerFunc {
+	service := membershipService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+		iidApp, ok := pathInt(w, r, "application_id")
+		if !ok {
+			return
+		}
+
+		if err := service.Delete(r.Context(), iidPer, iidApp); err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// v1PostSessionHandler crea el código de sesión de la persona en la aplicación:
+// POST /api/v1/persons/{id}/memberships/{application_id}/sessions con {"redirect_uri": "..."} opcional
+func v1PostSessionHandler(db *sql.DB) http.HandlerFunc {
+	service := membershipService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+		iidApp, ok := pathInt(w, r, "application_id")
+		if !ok {
+			return
+		}
+
+		var sent api.SessionWriteResource
+		if !v1DecodeBody(w, r, &sent, true) {
+			return
+		}
+
+		session, err := service.CreateSession(r.Context(), iidPer, iidApp, sent)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusCreated, session)
+	}
+}
+
+// v1GetApplicationsHandler lista las aplicaciones (sin secretos): GET /api/v1/applications
+func v1GetApplicationsHandler(db *sql.DB) http.HandlerFunc {
+	service := applicationService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := service.List(r.Context())
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, list)
+	}
+}
+
+// v1GetApplicationHandler devuelve la aplicación con sus personas: GET /api/v1/applications/{id}
+func v1GetApplicationHandler(db *sql.DB) http.HandlerFunc {
+	service := applicationService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		detail, err := service.Get(r.Context(), iid)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, detail)
+	}
+}
+
+// v1PostApplicationHandler registra una aplicación: POST /api/v1/applications
+// si se indica client_url_callback se genera el secreto, que solo se devuelve en esta respuesta
+func v1PostApplicationHandler(db *sql.DB) http.HandlerFunc {
+	service := applicationService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sent api.ApplicationWriteResource
+		if !v1DecodeBody(w, r, &sent, false) {
+			return
+		}
+
+		created, err := service.Create(r.Context(), sent)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeCreated(w, fmt.Sprintf("%s/applications/%d", apiV1Prefix, created.ID), created)
+	}
+}
+
+// v1PutApplicationHandler sustituye los datos de una aplicación: PUT /api/v1/applications/{id}
+// el secreto se conserva; si la aplicación no tenía y se indica client_url_callback se genera
+func v1PutApplicationHandler(db *sql.DB) http.HandlerFunc {
+	service := applicationService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		var sent api.ApplicationWriteResource
+		if !v1DecodeBody(w, r, &sent, false) {
+			return
+		}
+
+		updated, err := service.Update(r.Context(), iid, sent)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, updated)
+	}
+}
+
+// v1DeleteApplicationHandler elimina una aplicación: DELETE /api/v1/applications/{id}
+// con pertenencias responde 409 (se retira con PUT .../status); sesiones y webhooks se eliminan con ella
+func v1DeleteApplicationHandler(db *sql.DB) http.HandlerFunc {
+	service := applicationService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		if err := service.Delete(r.Context(), iid); err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// v1PutApplicationStatusHandler suspende, retira o reactiva una aplicación:
+// PUT /api/v1/applications/{id}/status
+func v1PutApplicationStatusHandler(db *sql.DB) http.HandlerFunc {
+	service := applicationService{db}
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		var sent api.ApplicationStatusWriteResource
+		if !v1DecodeBody(w, r, &sent, false) {
+			return
+		}
+
+		updated, err := service.SetStatus(r.Context(), iid, sent)
+		if err != nil {
+			writeProblemError(w, r, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, updated)
+	}
+}
+
+// v1GetAuthIniHandler prepara el inicio de sesión en la aplicación: GET /api/v1/authini/{client_id}
+func v1GetAuthIniHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		client_id := r.PathValue("client_id")
+
+		app, err := postgres_auth_client_by_client_id(ctx, db, client_id)
+		if errors.Is(err, errAuthClientNotFound) {
+			writeProblem(w, r, http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La aplicación %q no existe`, client_id))
+			return
+		}
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener la aplicación`, err)
+			return
+		}
+		if problem := applicationInactive(*app); problem != nil {
+			writeProblemError(w, r, problem)
+			return
+		}
+		if len(app.loginRedirectUris()) == 0 {
+			writeProblem(w, r, http.StatusConflict, api.ProblemConflict, `La aplicación no tiene registrada ninguna redirect_uri`)
+			return
+		}
+
+		lper, err := postgres_persons_all(ctx, db)
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener las personas`, err)
+			return
+		}
+
+		lpersonapp, err := postgres_personapp_by_auth_client_id(ctx, db, app.ID)
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener las pertenencias`, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, api.AuthIniResource{
+			Application: applicationResource(*app),
+			Persons:     listResource(lper, personResource).Items,
+			Memberships: listResource(lpersonapp, membershipResource).Items,
+		})
+	}
+}
+
+// v1GetLogoutDeliveriesHandler devuelve el registro de entregas de logout:
+// GET /api/v1/logout-deliveries?person_id=&application_id=
+func v1GetLogoutDeliveriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		person_id, err := queryIntParam(r, "person_id")
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemInvalidParameter, err.Error())
+			return
+		}
+		application_id, err := queryIntParam(r, "application_id")
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemInvalidParameter, err.Error())
+			return
+		}
+
+		list, err := postgres_logout_deliveries(r.Context(), db, person_id, application_id)
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener las entregas`, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, listResource(list, logoutDeliveryResource))
+	}
+}
+
+// v1GetWebhooksHandler lista las suscripciones (sin secretos): GET /api/v1/webhooks?application_id=
+func v1GetWebhooksHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		application_id, err := queryIntParam(r, "application_id")
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemInvalidParameter, err.Error())
+			return
+		}
+
+		list, err := postgres_webhook_subscriptions(r.Context(), db, application_id)
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener las suscripciones`, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, listResource(list, webhookResource))
+	}
+}
+
+// v1GetWebhookHandler devuelve una suscripción sin el secreto: GET /api/v1/webhooks/{id}
+func v1GetWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		item, err := postgres_webhook_subscription_by_id(r.Context(), db, iid)
+		if errors.Is(err, errWebhookNotFound) {
+			writeProblem(w, r, http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La suscripción con id %d no existe`, iid))
+			return
+		}
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener la suscripción`, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, webhookResource(*item))
+	}
+}
+
+// v1PostWebhookHandler crea una suscripción; el secreto solo se devuelve aquí: POST /api/v1/webhooks
+func v1PostWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var sent api.WebhookWriteResource
+		if !v1DecodeBody(w, r, &sent, false) {
+			return
+		}
+		if fields := validateWebhookWrite(sent); len(fields) > 0 {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemValidation, `La suscripción no es válida`, fields...)
+			return
+		}
+
+		active := true
+		if sent.Active != nil {
+			active = *sent.Active
+		}
+
+		secret, err := webhookSecretCreate()
+		if err != nil {
+			writeProblem(w, r, http.StatusInternalServerError, api.ProblemInternal, fmt.Sprintf(`Error al generar el secreto: %v`, err))
+			return
+		}
+
+		item, err := postgres_webhook_subscription_insert(ctx, db, sent.ApplicationID, sent.Url, secret, sent.Events, active)
+		if err != nil {
+			problemFromDbError(w, r, `Error al insertar la suscripción`, err)
+			return
+		}
+
+		res := webhookResource(*item)
+		res.Secret = item.Secret
+		writeCreated(w, fmt.Sprintf("%s/webhooks/%d", apiV1Prefix, item.ID), res)
+	}
+}
+
+// v1PutWebhookHandler actualiza una suscripción: PUT /api/v1/webhooks/{id}
+// la aplicación de una suscripción no cambia; si viene application_id debe ser la misma
+func v1PutWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		var sent api.WebhookWriteResource
+		if !v1DecodeBody(w, r, &sent, false) {
+			return
+		}
+
+		current, err := postgres_webhook_subscription_by_id(ctx, db, iid)
+		if errors.Is(err, errWebhookNotFound) {
+			writeProblem(w, r, http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La suscripción con id %d no existe`, iid))
+			return
+		}
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener la suscripción`, err)
+			return
+		}
+		if sent.ApplicationID == 0 {
+			sent.ApplicationID = current.AuthClientId
+		}
+		if sent.ApplicationID != current.AuthClientId {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemValidation, `La suscripción no es válida`,
+				api.ProblemFieldError{Field: "application_id", Message: "no se puede cambiar la aplicación de una suscripción"})
+			return
+		}
+		if fields := validateWebhookWrite(sent); len(fields) > 0 {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemValidation, `La suscripción no es válida`, fields...)
+			return
+		}
+
+		active := true
+		if sent.Active != nil {
+			active = *sent.Active
+		}
+
+		n, err := postgres_webhook_subscription_update(ctx, db, iid, sent.Url, sent.Events, active)
+		if err != nil {
+			problemFromDbError(w, r, `Error al actualizar la suscripción`, err)
+			return
+		}
+		if n == 0 {
+			writeProblem(w, r, http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La suscripción con id %d no existe`, iid))
+			return
+		}
+
+		current.Url, current.Events, current.Active = sent.Url, sent.Events, active
+		writeJsonStatus(w, http.StatusOK, webhookResource(*current))
+	}
+}
+
+// v1DeleteWebhookHandler elimina una suscripción: DELETE /api/v1/webhooks/{id}
+func v1DeleteWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		n, err := postgres_webhook_subscription_delete(r.Context(), db, iid)
+		if err != nil {
+			problemFromDbError(w, r, `Error al eliminar la suscripción`, err)
+			return
+		}
+		if n == 0 {
+			writeProblem(w, r, http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La suscripción con id %d no existe`, iid))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// v1GetWebhookDeliveriesHandler devuelve el estado de las entregas:
+// GET /api/v1/webhook-deliveries?subscription_id=&status=&limit=
+func v1GetWebhookDeliveriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription_id, err := queryIntParam(r, "subscription_id")
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemInvalidParameter, err.Error())
+			return
+		}
+		limit, err := queryIntParam(r, "limit")
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemInvalidParameter, err.Error())
+			return
+		}
+		if limit <= 0 || limit > 1000 {
+			limit = 100
+		}
+
+		list, err := postgres_webhook_deliveries(r.Context(), db, subscription_id, r.URL.Query().Get("status"), limit)
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener las entregas`, err)
+			return
+		}
+
+		writeJsonStatus(w, http.StatusOK, listResource(list, webhookDeliveryResource))
+	}
+}
+
+// v1PostWebhookDeliveryRetryHandler vuelve a poner en cola una entrega:
+// POST /api/v1/webhook-deliveries/{id}/retry, responde 202
+func v1PostWebhookDeliveryRetryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		n, err := postgres_webhook_delivery_retry(r.Context(), db, iid)
+		if err != nil {
+			problemFromDbError(w, r, `Error al reintentar la entrega`, err)
+			return
+		}
+		if n == 0 {
+			writeProblem(w, r, http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La entrega con id %d no existe`, iid))
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// v1GetEventsHandler devuelve los cambios posteriores al cursor en orden de commit:
+// GET /api/v1/events?since=<cursor>&limit=100&entity=person
+func v1GetEventsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, err := eventsCursor(r.URL.Query().Get("since"))
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemInvalidParameter, err.Error())
+			return
+		}
+		limit, err := queryIntParam(r, "limit")
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, api.ProblemInvalidParameter, err.Error())
+			return
+		}
+		if limit <= 0 || limit > eventsMaxLimit {
+			limit = eventsDefaultLimit
+		}
+
+		list, err := postgres_events_since(r.Context(), db, since, r.URL.Query().Get("entity"), limit)
+		if err != nil {
+			problemFromDbError(w, r, `Error al obtener los eventos`, err)
+			return
+		}
+
+		// si no hay eventos nuevos el cursor no avanza
+		next := since
+		if len(list) > 0 {
+			next = list[len(list)-1].ID
+		}
+		page := listResource(list, eventResource)
+
+		writeJsonStatus(w, http.StatusOK, api.EventsPageResource{Items: page.Items, Count: page.Count, NextCursor: strconv.FormatInt(next, 10)})
+	}
+}
+
+// validateWebhookWrite devuelve los campos no válidos de una suscripción
+func validateWebhookWrite(s api.WebhookWriteResource) []api.ProblemFieldError {
+	var fields []api.ProblemFieldError
+	if s.ApplicationID <= 0 {
+		fields = append(fields, api.ProblemFieldError{Field: "application_id", Message: "es requerido"})
+	}
+	if err := validateWebhookSubscription(WebhookSubscriptionPostSent{AuthClientId: s.ApplicationID, Url: s.Url, Events: s.Events}); err != nil {
+		fields = append(fields, api.ProblemFieldError{Field: "url/events", Message: err.Error()})
+	}
+	return fields
+}
@@ -0,0 +1,892 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+
+	"dummy-corp-erp-server/api"
+	"github.com/lib/pq"
+)
+
+// errAuthClientNotFound se devuelve cuando la aplicación no existe
+var errAuthClientNotFound = errors.New("cliente no encontrado")
+
+type AuthClient struct {
+	ID                int     `json:"id"`
+	ClientID          string  `json:"client_id"`
+	ClientUrl         string  `json:"client_url"`
+	ClientUrlCallback *string `json:"client_url_callback,omitempty"`
+	ClientSecret      *string `json:"client_secret,omitempty"`
+	CreatedAt         string  `json:"created_at"`
+	// URL a la que se notifica el logout por back-channel
+	BackchannelLogoutUrl *string `json:"backchannel_logout_url,omitempty"`
+	// URIs de redirección registradas (comparación exacta)
+	RedirectUris           []string `json:"redirect_uris,omitempty"`
+	PostLogoutRedirectUris []string `json:"post_logout_redirect_uris,omitempty"`
+	// subject del certificado de cliente (mTLS) que identifica a la aplicación, p. ej. "CN=crm,O=Dummy Corp"
+	TlsClientSubject *string  `json:"tls_client_subject,omitempty"`
+	AllowedScopes    []string `json:"allowed_scopes"`
+	GrantTypes       []string `json:"grant_types"`
+	LogoUrl          *string  `json:"logo_url,omitempty"`
+	Description      *string  `json:"description,omitempty"`
+	OwnerName        *string  `json:"owner_name,omitempty"`
+	OwnerEmail       *string  `json:"owner_email,omitempty"`
+	// active, suspended o retired (api.ApplicationStatus*)
+	Status          string  `json:"status"`
+	StatusReason    *string `json:"status_reason,omitempty"`
+	StatusChangedAt *string `json:"status_changed_at,omitempty"`
+}
+
+func getAuthClientsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		list, err := postgres_auth_clients_all(ctx, db)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener los clientes: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// el secreto solo se devuelve al generarlo (alta o rotate_secret)
+		for i := range list {
+			list[i].ClientSecret = nil
+		}
+
+		// Convierte los clientes a formato JSON
+		jsonList, err := json.Marshal(list)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir los clientes a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con los clientes en formato JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonList)
+	}
+}
+
+// PersonAppSession es la respuesta de POST /persons/{id}/applications/{app_id}/session
+type PersonAppSession struct {
+	Code         string `json:"code"`
+	ExpiresInMin int    `json:"expires_in_min"`
+	RedirectUri  string `json:"redirect_uri"`
+}
+
+// personAppSessionHandler crea el código de sesión de la persona en la aplicación:
+// POST /persons/{id}/applications/{app_id}/session?redirect_uri=...
+// la lógica es la de /api/v1 (membershipService.CreateSession): la persona debe tener acceso
+// y la aplicación estar activa
+func personAppSessionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+		iidApp, ok := pathInt(w, r, "app_id")
+		if !ok {
+			return
+		}
+
+		sent := api.SessionWriteResource{RedirectUri: r.URL.Query().Get("redirect_uri")}
+		session, err := membershipService{db}.CreateSession(r.Context(), iidPer, iidApp, sent)
+		if err != nil {
+			errJsonProblem(w, err)
+			return
+		}
+
+		writeJson(w, PersonAppSession{Code: session.Code, ExpiresInMin: session.ExpiresInMin, RedirectUri: session.RedirectUri})
+	}
+}
+
+type AuthClientPostSent struct {
+	ClientID               string   `json:"client_id"`
+	ClientUrl              string   `json:"client_url"`
+	ClientUrlCallback      *string  `json:"client_url_callback,omitempty"`
+	BackchannelLogoutUrl   *string  `json:"backchannel_logout_url,omitempty"`
+	RedirectUris           []string `json:"redirect_uris,omitempty"`
+	PostLogoutRedirectUris []string `json:"post_logout_redirect_uris,omitempty"`
+	TlsClientSubject       *string  `json:"tls_client_subject,omitempty"`
+	AllowedScopes          []string `json:"allowed_scopes,omitempty"`
+	GrantTypes             []string `json:"grant_types,omitempty"`
+	LogoUrl                *string  `json:"logo_url,omitempty"`
+	Description            *string  `json:"description,omitempty"`
+	OwnerName              *string  `json:"owner_name,omitempty"`
+	OwnerEmail             *string  `json:"owner_email,omitempty"`
+}
+
+// AuthClientDetail es la respuesta de GET /applications/{id}
+type AuthClientDetail struct {
+	Application *AuthClient  `json:"application"`
+	LPersonApp  []PersonApp  `json:"lpersonapp,omitempty"`
+	LPer        []PersonData `json:"lper,omitempty"`
+}
+
+// getAuthClientHandler devuelve la aplicación con sus personas: GET /applications/{id}
+func getAuthClientHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		application, err := postgres_auth_client_by_id(ctx, db, iid)
+		if errors.Is(err, errAuthClientNotFound) {
+			errJsonProblem(w, applicationNotFound(iid))
+			return
+		}
+		if err != nil {
+			errJsonProblem(w, dbProblem(`Error al obtener la aplicación`, err))
+			return
+		}
+		application.ClientSecret = nil
+
+		lpersonapp, err := postgres_personapp_by_auth_client_id(ctx, db, iid)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la personaapp: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		lper, err := postgres_person_by_auth_client_id(ctx, db, iid)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la persona: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		data := AuthClientDetail{Application: application, LPersonApp: lpersonapp, LPer: lper}
+
+		// Convierte el cliente a formato JSON
+		jsonItem, err := json.Marshal(data)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir el cliente a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con el cliente en formato JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonItem)
+	}
+}
+
+// postAuthClientHandler registra una aplicación: POST /applications
+// la lógica es la de /api/v1 (applicationService); el secreto solo se devuelve en esta respuesta
+func postAuthClientHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		// Decodifica el JSON recibido
+		var sent AuthClientPostSent
+		err := json.NewDecoder(r.Body).Decode(&sent)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al decodificar el JSON: %v`, err), http.StatusBadRequest)
+			return
+		}
+
+		item, err := applicationService{db}.Create(ctx, sent.writeResource())
+		if err != nil {
+			errJsonProblem(w, err)
+			return
+		}
+
+		// Convierte el cliente insertado a formato JSON
+		jsonItem, err := json.Marshal(item)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir el cliente a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con el cliente insertado en formato JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonItem)
+	}
+}
+
+// AuthClientPutSent es el cuerpo de PUT /applications/{id}
+type AuthClientPutSent struct {
+	ID int `json:"id"`
+	AuthClientPostSent
+	// genera un secreto nuevo; sin él se conserva el actual
+	RotateSecret bool `json:"rotate_secret,omitempty"`
+}
+
+// putAuthClientHandler actualiza una aplicación: PUT /applications/{id}
+// a diferencia de /api/v1, las URLs opcionales, el sujeto del certificado, las listas y los
+// campos de ficha que no vienen en el JSON se conservan
+func putAuthClientHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		// Decodifica el JSON recibido
+		var sent AuthClientPutSent
+		err := json.NewDecoder(r.Body).Decode(&sent)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al decodificar el JSON: %v`, err), http.StatusBadRequest)
+			return
+		}
+
+		// el id del cuerpo es opcional, pero si viene debe ser el de la URL
+		if sent.ID != 0 && sent.ID != iid {
+			errJsonStatus(w, `El id del cliente no coincide con el id de la URL`, http.StatusBadRequest)
+			return
+		}
+
+		// los campos que no vienen se toman de la aplicación actual; validación, secreto y
+		// eventos son los de applicationService.Update
+		current, err := postgres_auth_client_by_id(ctx, db, iid)
+		if errors.Is(err, errAuthClientNotFound) {
+			errJsonProblem(w, applicationNotFound(iid))
+			return
+		}
+		if err != nil {
+			errJsonProblem(w, dbProblem(`Error al obtener la aplicación`, err))
+			return
+		}
+
+		write := sent.writeResource()
+		write.RotateSecret = sent.RotateSecret
+		if write.ClientUrlCallback == nil {
+			write.ClientUrlCallback = current.ClientUrlCallback
+		}
+		if write.BackchannelLogoutUrl == nil {
+			write.BackchannelLogoutUrl = current.BackchannelLogoutUrl
+		}
+		if write.TlsClientSubject == nil {
+			write.TlsClientSubject = current.TlsClientSubject
+		}
+		if write.RedirectUris == nil {
+			write.RedirectUris = current.RedirectUris
+		}
+		if write.PostLogoutRedirectUris == nil {
+			write.PostLogoutRedirectUris = current.PostLogoutRedirectUris
+		}
+		if write.AllowedScopes == nil {
+			write.AllowedScopes = current.AllowedScopes
+		}
+		if write.GrantTypes == nil {
+			write.GrantTypes = current.GrantTypes
+		}
+		if write.LogoUrl == nil {
+			write.LogoUrl = current.LogoUrl
+		}
+		if write.Description == nil {
+			write.Description = current.Description
+		}
+		if write.OwnerName == nil {
+			write.OwnerName = current.OwnerName
+		}
+		if write.OwnerEmail == nil {
+			write.OwnerEmail = current.OwnerEmail
+		}
+
+		item, err := applicationService{db}.Update(ctx, iid, write)
+		if err != nil {
+			errJsonProblem(w, err)
+			return
+		}
+
+		// Convierte el cliente actualizado a formato JSON
+		jsonItem, err := json.Marshal(item)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir el cliente a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con el cliente actualizado en formato JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonItem)
+	}
+}
+
+// writeResource pasa el cuerpo de las rutas sin versión al de /api/v1
+func (sent AuthClientPostSent) writeResource() api.ApplicationWriteResource {
+	return api.ApplicationWriteResource{
+		ClientID:               sent.ClientID,
+		ClientUrl:              sent.ClientUrl,
+		ClientUrlCallback:      sent.ClientUrlCallback,
+		BackchannelLogoutUrl:   sent.BackchannelLogoutUrl,
+		RedirectUris:           sent.RedirectUris,
+		PostLogoutRedirectUris: sent.PostLogoutRedirectUris,
+		TlsClientSubject:       sent.TlsClientSubject,
+		AllowedScopes:          sent.AllowedScopes,
+		GrantTypes:             sent.GrantTypes,
+		LogoUrl:                sent.LogoUrl,
+		Description:            sent.Description,
+		OwnerName:              sent.OwnerName,
+		OwnerEmail:             sent.OwnerEmail,
+	}
+}
+
+// deleteAuthClientHandler elimina una aplicación: DELETE /applications/{id}
+// sus sesiones y webhooks se eliminan con ella; con pertenencias responde 409 y para darla de
+// baja conservándolas se retira
+func deleteAuthClientHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		if err := (applicationService{db}).Delete(r.Context(), iid); err != nil {
+			errJsonProblem(w, err)
+			return
+		}
+
+		// Responde con un mensaje de éxito
+		w.Write([]byte(`{"message": "Cliente eliminado"}`))
+	}
+}
+
+// putAuthClientStatusHandler suspende, retira o reactiva una aplicación:
+// PUT /applications/{id}/status con {"status": "suspended", "reason": "..."}
+func putAuthClientStatusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		// Decodifica el JSON recibido
+		var sent api.ApplicationStatusWriteResource
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al decodificar el JSON: %v`, err), http.StatusBadRequest)
+			return
+		}
+
+		item, err := applicationService{db}.SetStatus(r.Context(), iid, sent)
+		if err != nil {
+			errJsonProblem(w, err)
+			return
+		}
+
+		writeJson(w, item)
+	}
+}
+
+// tokenCreate genera un secreto alfanumérico con crypto/rand; los bytes de 248 en adelante se
+// descartan para que todos los caracteres tengan la misma probabilidad
+func tokenCreate(length int) string {
+	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	const limit = 256 - 256%len(charset)
+	b := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(b) < length {
+		rand.Read(buf)
+		for _, c := range buf {
+			if int(c) < limit && len(b) < length {
+				b = append(b, charset[int(c)%len(charset)])
+			}
+		}
+	}
+	return string(b)
+}
+
+// flujos OAuth que puede usar una aplicación
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypeClientCredentials = "client_credentials"
+)
+
+// validateGrantTypes comprueba que los flujos son conocidos y no se repiten
+func validateGrantTypes(list []string) error {
+	seen := make(map[string]bool, len(list))
+	for _, gt := range list {
+		switch gt {
+		case grantTypeAuthorizationCode, grantTypeRefreshToken, grantTypeClientCredentials:
+		default:
+			return fmt.Errorf("grant_type %q no admitido: se espera %s, %s o %s", gt,
+				grantTypeAuthorizationCode, grantTypeRefreshToken, grantTypeClientCredentials)
+		}
+		if seen[gt] {
+			return fmt.Errorf("grant_type %q repetido", gt)
+		}
+		seen[gt] = true
+	}
+	if seen[grantTypeRefreshToken] && !seen[grantTypeAuthorizationCode] {
+		return fmt.Errorf("refresh_token requiere %s", grantTypeAuthorizationCode)
+	}
+	return nil
+}
+
+// validateScopes comprueba que cada scope es un scope-token de RFC 6749 (sin espacios,
+// comillas ni barra invertida) y que no se repiten
+func validateScopes(list []string) error {
+	seen := make(map[string]bool, len(list))
+	for _, scope := range list {
+		if scope == "" {
+			return fmt.Errorf("el scope no puede estar vacío")
+		}
+		if len(scope) > 64 {
+			return fmt.Errorf("el scope %q supera los 64 caracteres", scope)
+		}
+		for _, c := range scope {
+			if c < 0x21 || c > 0x7e || c == '"' || c == '\\' {
+				return fmt.Errorf("el scope %q contiene caracteres no válidos", scope)
+			}
+		}
+		if seen[scope] {
+			return fmt.Errorf("scope %q repetido", scope)
+		}
+		seen[scope] = true
+	}
+	return nil
+}
+
+// validateLogoUrl exige una URL https absoluta, que el navegador pueda cargar desde el login
+func validateLogoUrl(raw string) error {
+	if len(raw) > 255 {
+		return fmt.Errorf("supera los 255 caracteres")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("no es una URL válida: %v", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("debe ser una URL https absoluta")
+	}
+	return nil
+}
+
+// validateOwnerEmail exige una dirección sin nombre ni ángulos, p. ej. "equipo-crm@mydomain.com"
+func validateOwnerEmail(raw string) error {
+	if len(raw) > 255 {
+		return fmt.Errorf("supera los 255 caracteres")
+	}
+	addr, err := mail.ParseAddress(raw)
+	if err != nil || addr.Address != raw {
+		return fmt.Errorf("no es una dirección de correo")
+	}
+	return nil
+}
+
+// normalizeOptional recorta el texto y guarda NULL en lugar de una cadena vacía
+func normalizeOptional(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// appStatusText es el estado tal como aparece en los mensajes de error
+var appStatusText = map[string]string{
+	api.ApplicationStatusActive:    "activa",
+	api.ApplicationStatusSuspended: "suspendida",
+	api.ApplicationStatusRetired:   "retirada",
+}
+
+// applicationInactive es el error de las operaciones que requieren una aplicación activa
+// (autenticación, inicio de sesión y códigos de sesión); nil si lo está
+func applicationInactive(app AuthClient) *api.Problem {
+	if app.Status == api.ApplicationStatusActive {
+		return nil
+	}
+	return newProblem(http.StatusForbidden, api.ProblemApplicationInactive,
+		fmt.Sprintf(`La aplicación %s está %s`, app.ClientID, appStatusText[app.Status]))
+}
+
+// confidential indica si la aplicación se autentica con secreto: tiene callback o usa client_credentials
+func (app AuthClient) confidential() bool {
+	return app.ClientUrlCallback != nil || slices.Contains(app.GrantTypes, grantTypeClientCredentials)
+}
+
+// normalizeTlsClientSubject guarda NULL en lugar de un subject vacío para no chocar con el índice único
+func normalizeTlsClientSubject(subject *string) *string {
+	if subject == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*subject)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+type AuthClientShort struct {
+	ID        int    `json:"id"`
+	ClientID  string `json:"client_id"`
+	ClientUrl string `json:"client_url"`
+}
+
+// eventData devuelve la aplicación tal como se publica en el outbox, sin el secreto
+func (app AuthClient) eventData() AuthClient {
+	app.ClientSecret = nil
+	return app
+}
+
+// authClientColumns son las columnas de auth_clients en el orden de scanFields
+const authClientColumns = `
+			id, client_id, client_url, client_url_callback, client_secret, created_at,
+			backchannel_logout_url, tls_client_subject,
+			allowed_scopes, grant_types, logo_url, description, owner_name, owner_email,
+			status, status_reason, status_changed_at`
+
+// scanFields devuelve los destinos de Scan para una fila con authClientColumns
+func (app *AuthClient) scanFields() []any {
+	return []any{&app.ID, &app.ClientID, &app.ClientUrl, &app.ClientUrlCallback, &app.ClientSecret, &app.CreatedAt,
+		&app.BackchannelLogoutUrl, &app.TlsClientSubject,
+		pq.Array(&app.AllowedScopes), pq.Array(&app.GrantTypes), &app.LogoUrl, &app.Description, &app.OwnerName, &app.OwnerEmail,
+		&app.Status, &app.StatusReason, &app.StatusChangedAt}
+}
+
+// postgres_auth_client_insert registra una aplicación dentro de una transacción
+func postgres_auth_client_insert(ctx context.Context, tx *sql.Tx, item AuthClient) (*AuthClient, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_insert")
+	defer span.End()
+
+	query := `
+		INSERT INTO auth_clients (
+			client_id, client_url, client_url_callback, client_secret, backchannel_logout_url, tls_client_subject,
+			allowed_scopes, grant_types, logo_url, description, owner_name, owner_email)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id, created_at, status;`
+	err := tx.QueryRowContext(ctx, query,
+		item.ClientID, item.ClientUrl,
+		item.ClientUrlCallback, item.ClientSecret,
+		item.BackchannelLogoutUrl, item.TlsClientSubject,
+		pq.Array(item.AllowedScopes), pq.Array(item.GrantTypes),
+		item.LogoUrl, item.Description,
+		item.OwnerName, item.OwnerEmail).Scan(&item.ID, &item.CreatedAt, &item.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// postgres_auth_clients_all devuelve todas las aplicaciones con sus redirect_uris
+func postgres_auth_clients_all(ctx context.Context, db *sql.DB) ([]AuthClient, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_clients_all")
+	defer span.End()
+
+	query := `
+		SELECT ` + authClientColumns + `
+		FROM auth_clients
+		ORDER BY id;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []AuthClient
+	for rows.Next() {
+		var item AuthClient
+		if err := rows.Scan(item.scanFields()...); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range list {
+		if err := postgres_auth_client_redirect_uris_load(ctx, db, &list[i]); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func postgres_auth_client_update(ctx context.Context, tx *sql.Tx, id int, item AuthClient) error {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_update")
+	defer span.End()
+
+	query := `
+		UPDATE
+			auth_clients
+		SET
+			client_id = $1, client_url = $2,
+			client_url_callback = $3, client_secret = $4,
+			backchannel_logout_url = $5, tls_client_subject = $6,
+			allowed_scopes = $7, grant_types = $8,
+			logo_url = $9, description = $10,
+			owner_name = $11, owner_email = $12
+		WHERE id = $13;`
+	_, err := tx.ExecContext(ctx,
+		query,
+		item.ClientID, item.ClientUrl,
+		item.ClientUrlCallback, item.ClientSecret,
+		item.BackchannelLogoutUrl, item.TlsClientSubject,
+		pq.Array(item.AllowedScopes), pq.Array(item.GrantTypes),
+		item.LogoUrl, item.Description,
+		item.OwnerName, item.OwnerEmail,
+		id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// postgres_auth_client_set_status cambia el estado de la aplicación dentro de una transacción
+func postgres_auth_client_set_status(ctx context.Context, tx *sql.Tx, id int, status string, reason *string) (*AuthClient, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_set_status")
+	defer span.End()
+
+	query := `
+		UPDATE
+			auth_clients
+		SET
+			status = $1, status_reason = $2,
+			status_changed_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+		RETURNING ` + authClientColumns + `;`
+
+	var item AuthClient
+	err := tx.QueryRowContext(ctx, query, status, reason, id).Scan(item.scanFields()...)
+	if err == sql.ErrNoRows {
+		return nil, errAuthClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// postgres_auth_client_status_by_client_id devuelve el estado de la aplicación; "" si no está registrada
+func postgres_auth_client_status_by_client_id(ctx context.Context, db *sql.DB, client_id string) (string, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_status_by_client_id")
+	defer span.End()
+
+	var status string
+	err := db.QueryRowContext(ctx, `SELECT status FROM auth_clients WHERE client_id = $1;`, client_id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return status, err
+}
+
+func postgres_auth_client_by_id(ctx context.Context, db *sql.DB, id int) (*AuthClient, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_by_id")
+	defer span.End()
+
+	query := fmt.Sprintf(`
+		SELECT `+authClientColumns+`
+		FROM
+			auth_clients
+		WHERE
+			id = %d;`, id)
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	row, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer row.Close()
+
+	var item AuthClient
+	if row.Next() {
+		if err := row.Scan(item.scanFields()...); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errAuthClientNotFound
+	}
+	row.Close()
+
+	if err := postgres_auth_client_redirect_uris_load(ctx, db, &item); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+func postgres_auth_client_by_client_id(ctx context.Context, db *sql.DB, client_id string) (*AuthClient, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_by_client_id")
+	defer span.End()
+
+	query := `
+		SELECT ` + authClientColumns + `
+		FROM
+			auth_clients
+		WHERE
+			client_id = $1;`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	row, err := stmt.QueryContext(ctx, client_id)
+	if err != nil {
+		return nil, err
+	}
+	defer row.Close()
+
+	var item AuthClient
+	if row.Next() {
+		if err := row.Scan(item.scanFields()...); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errAuthClientNotFound
+	}
+	row.Close()
+
+	if err := postgres_auth_client_redirect_uris_load(ctx, db, &item); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+func postgres_auth_client_by_person_id(ctx context.Context, db *sql.DB, id_person int) ([]AuthClientShort, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_by_person_id")
+	defer span.End()
+
+	query := fmt.Sprintf(`
+		SELECT
+			id, client_id, client_url
+		FROM
+			auth_clients
+		WHERE
+			id in (
+				SELECT
+					auth_client_id
+				FROM
+					person_auth_client
+				WHERE
+					person_id = %d
+			);`, id_person)
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []AuthClientShort
+	for rows.Next() {
+		var item AuthClientShort
+		if err := rows.Scan(&item.ID,
+			&item.ClientID, &item.ClientUrl); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+
+	return list, nil
+}
+
+func postgres_auth_clients_short_all(ctx context.Context, db *sql.DB) ([]AuthClientShort, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_clients_short_all")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, client_id, client_url
+		FROM
+			auth_clients
+		ORDER BY id;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []AuthClientShort
+	for rows.Next() {
+		var item AuthClientShort
+		if err := rows.Scan(&item.ID,
+			&item.ClientID, &item.ClientUrl); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+
+	return list, rows.Err()
+}
+
+// postgres_auth_clients_by_ids carga varias aplicaciones con sus redirect_uris en dos consultas
+func postgres_auth_clients_by_ids(ctx context.Context, db *sql.DB, ids []int) ([]AuthClient, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_clients_by_ids")
+	defer span.End()
+
+	query := `
+		SELECT ` + authClientColumns + `
+		FROM auth_clients
+		WHERE id = ANY($1);`
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []AuthClient
+	index := make(map[int]int)
+	for rows.Next() {
+		var item AuthClient
+		if err := rows.Scan(item.scanFields()...); err != nil {
+			return nil, err
+		}
+		index[item.ID] = len(list)
+		list = append(list, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	query = `
+		SELECT
+			auth_client_id, uri, kind
+		FROM
+			auth_client_redirect_uris
+		WHERE
+			auth_client_id = ANY($1)
+		ORDER BY id;`
+	rows, err = db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id_app int
+		var uri, kind string
+		if err := rows.Scan(&id_app, &uri, &kind); err != nil {
+			return nil, err
+		}
+		i, ok := index[id_app]
+		if !ok {
+			continue
+		}
+		if kind == redirectUriKindPostLogout {
+			list[i].PostLogoutRedirectUris = append(list[i].PostLogoutRedirectUris, uri)
+		} else {
+			list[i].RedirectUris = append(list[i].RedirectUris, uri)
+		}
+	}
+	return list, rows.Err()
+}
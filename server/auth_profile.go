@@ -1,12 +1,12 @@
-package main
+package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
+	"time"
 )
 
 // AuthProfile representa la estructura del perfil de autenticación
@@ -17,46 +17,59 @@ type AuthProfileData struct {
 	Attributes map[string]string `json:"attributes"`
 }
 
+// errAuthUnauthorized indica que el servicio de autenticación rechazó el token
+var errAuthUnauthorized = errors.New("no autorizado")
+
 // authProfile realiza la solicitud para obtener el perfil de autenticación
-func AuthProfile(token string) (*AuthProfileData, error) {
-	authProfileURL := os.Getenv("AUTH_PROFILE_URL")
+func AuthProfile(ctx context.Context, token string) (_ *AuthProfileData, err error) {
+
+	start := time.Now()
+	defer func() { observeAuthService("profile", start, err) }()
+
+	authProfileURL := appConfig.Auth.ProfileURL
 	if authProfileURL == "" {
 		return nil, errors.New("la variable de entorno AUTH_PROFILE_URL no está definida")
 	}
 
 	// Crear la solicitud HTTP
-	req, err := http.NewRequest("GET", authProfileURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", authProfileURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creando la solicitud: %v", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 
+	// span de la llamada, con traceparent hacia el servicio de autenticación
+	status_code := 0
+	span := startClientSpan(req, "auth_service profile")
+	defer func() { endClientSpan(span, status_code, err) }()
+
 	// Realizar la solicitud
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		// Manejar errores de conexión
-		log.Printf("Error obteniendo perfil: %v", err)
+		requestLogger(ctx).Error("error al obtener el perfil", "error", err)
 		return nil, errors.New("error de conexión con el servicio de autenticación")
 	}
 	defer resp.Body.Close()
+	status_code = resp.StatusCode
 
 	// Procesar la respuesta según el código de estado
 	switch resp.StatusCode {
 	case http.StatusOK:
 		var profile AuthProfileData
 		if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
-			log.Printf("Error parseando perfil: %v", err)
+			requestLogger(ctx).Error("error al leer el perfil", "error", err)
 			return nil, errors.New("error procesando la respuesta del servidor")
 		}
 		return &profile, nil
 
 	case http.StatusUnauthorized:
-		log.Println("auth_profile response status: 401 Unauthorized")
-		return nil, errors.New("no autorizado")
+		requestLogger(ctx).Warn("auth_profile rechaza el token", "status", resp.StatusCode)
+		return nil, errAuthUnauthorized
 
 	default:
-		log.Printf("auth_profile response status: %d", resp.StatusCode)
+		requestLogger(ctx).Error("auth_profile responde con un estado inesperado", "status", resp.StatusCode)
 		return nil, errors.New("error interno del servidor")
 	}
 }
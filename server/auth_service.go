@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type AuthServicePostSession struct {
+	ClientId     string                 `json:"client_id"`
+	UserId       int                    `json:"user_id"`
+	RedirectUri  string                 `json:"redirect_uri"`
+	ExpiresInMin int                    `json:"expires_in_min"`
+	Attributes   map[string]interface{} `json:"attributes"`
+}
+
+type AuthServicePostSessionResponse struct {
+	ClientId    string `json:"client_id"`
+	Code        string `json:"code"`
+	UserId      int    `json:"user_id"`
+	RedirectUri string `json:"redirect_uri"`
+	ExpiresAt   any    `json:"expires_at"`
+	Attributes  any    `json:"attributes"`
+}
+
+func auth_service_post_session(ctx context.Context, client_id string, user_id int, redirect_uri string, expires_in_min int, attributes map[string]any) (code string, err error) {
+
+	start := time.Now()
+	defer func() { observeAuthService("post_session", start, err) }()
+
+	auth_super_secret_token := appConfig.Auth.SuperSecretToken
+	if auth_super_secret_token == "" {
+		return "", fmt.Errorf("AUTH_SUPER_SECRET_TOKEN not set")
+	}
+
+	auth_service_url := appConfig.Auth.ServiceURL
+	if auth_service_url == "" {
+		return "", fmt.Errorf("AUTH_SERVICE_URL not set")
+	}
+
+	// crear la estructura con los datos a enviar
+	data := AuthServicePostSession{
+		ClientId:     client_id,
+		UserId:       user_id,
+		RedirectUri:  redirect_uri,
+		ExpiresInMin: expires_in_min,
+		Attributes:   attributes,
+	}
+
+	// Convertir los datos a JSON
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("error al convertir los datos a JSON: %v", err)
+	}
+
+	slog.Debug("auth_service_post_session", "url", auth_service_url, "client_id", client_id, "user_id", user_id)
+
+	// enviar los datos al servicio de autenticación
+	req, err := http.NewRequestWithContext(ctx, "POST", auth_service_url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("error al crear la solicitud HTTP: %v", err)
+	}
+	// Agregar el token de autenticación en el header
+	req.Header.Set("Authorization", "Bearer "+auth_super_secret_token)
+	req.Header.Set("Content-Type", "application/json")
+
+	// span de la llamada, con traceparent hacia el servicio de autenticación
+	status_code := 0
+	span := startClientSpan(req, "auth_service post_session")
+	defer func() { endClientSpan(span, status_code, err) }()
+
+	// Realizar la solicitud HTTP
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error al realizar la solicitud HTTP: %v", err)
+	}
+	defer resp.Body.Close()
+	status_code = resp.StatusCode
+
+	// Leer la respuesta del servidor
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error al leer la respuesta del servidor: %v", err)
+	}
+
+	// Verificar el código de estado de la respuesta
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("código de estado inesperado: %d, respuesta: %s", resp.StatusCode, string(body))
+	}
+
+	// Decodificar la respuesta JSON en la estructura ResponseData
+	var response AuthServicePostSessionResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error al decodificar la respuesta JSON: %v", err)
+	}
+
+	return response.Code, nil
+}
+
+type AuthServiceDeleteSessions struct {
+	UserId int `json:"user_id"`
+}
+
+// auth_service_delete_sessions revoca en el servicio de autenticación todas las sesiones de un usuario
+func auth_service_delete_sessions(ctx context.Context, user_id int) (err error) {
+
+	start := time.Now()
+	defer func() { observeAuthService("delete_sessions", start, err) }()
+
+	auth_super_secret_token := appConfig.Auth.SuperSecretToken
+	if auth_super_secret_token == "" {
+		return fmt.Errorf("AUTH_SUPER_SECRET_TOKEN not set")
+	}
+
+	auth_logout_url := appConfig.Auth.LogoutURL
+	if auth_logout_url == "" {
+		return fmt.Errorf("AUTH_LOGOUT_URL not set")
+	}
+
+	// Convertir los datos a JSON
+	jsonData, err := json.Marshal(AuthServiceDeleteSessions{UserId: user_id})
+	if err != nil {
+		return fmt.Errorf("error al convertir los datos a JSON: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", auth_logout_url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error al crear la solicitud HTTP: %v", err)
+	}
+	// Agregar el token de autenticación en el header
+	req.Header.Set("Authorization", "Bearer "+auth_super_secret_token)
+	req.Header.Set("Content-Type", "application/json")
+
+	// span de la llamada, con traceparent hacia el servicio de autenticación
+	status_code := 0
+	span := startClientSpan(req, "auth_service delete_sessions")
+	defer func() { endClientSpan(span, status_code, err) }()
+
+	// Realizar la solicitud HTTP
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error al realizar la solicitud HTTP: %v", err)
+	}
+	defer resp.Body.Close()
+	status_code = resp.StatusCode
+
+	// el servicio puede responder 200 o 204 sin cuerpo
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("código de estado inesperado: %d, respuesta: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// AuthIniData es la respuesta de GET /authini/{client_id}: la aplicación, las personas
+// que se pueden elegir y sus pertenencias
+type AuthIniData struct {
+	Application *AuthClient  `json:"application"`
+	LPer        []PersonData `json:"lper"`
+	LPersonApp  []PersonApp  `json:"lpersonapp,omitempty"`
+}
+
+// authIniHandler prepara el inicio de sesión en la aplicación: GET /authini/{client_id}
+func authIniHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		// Obtiene el client_id de la aplicación
+		id := r.PathValue("client_id")
+
+		app, err := postgres_auth_client_by_client_id(ctx, db, id)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la aplicación: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		if app == nil {
+			errJsonStatus(w, fmt.Sprintf(`No se encontró la aplicación con el id: %s`, id), http.StatusNotFound)
+			return
+		}
+		if problem := applicationInactive(*app); problem != nil {
+			errJsonProblem(w, problem)
+			return
+		}
+
+		if len(app.loginRedirectUris()) == 0 {
+			errJsonStatus(w, `La aplicación no tiene registrada ninguna redirect_uri`, http.StatusBadRequest)
+			return
+		}
+
+		lper, err := postgres_persons_all(ctx, db)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener las personas: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if len(lper) == 0 {
+			errJsonStatus(w, `No hay personas registradas`, http.StatusNotFound)
+			return
+		}
+
+		lpersonapp, err := postgres_personapp_by_auth_client_id(ctx, db, app.ID)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la personaapp: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// el secreto solo se devuelve al generarlo
+		app.ClientSecret = nil
+		data := AuthIniData{Application: app, LPer: lper, LPersonApp: lpersonapp}
+
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al serializar los datos: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con los clientes en formato JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonData)
+
+	}
+
+}
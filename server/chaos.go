@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Inyección de fallos para demos de latencia y errores. Desactivada por defecto:
+// se activa con CHAOS_ENABLED=true (reglas en CHAOS_RULES, JSON) o con la sección chaos
+// de CONFIG_FILE. Solo entonces existe /admin/chaos, que exige el AUTH_TOKEN maestro.
+//
+//	CHAOS_RULES='[{"method":"POST","path":"/persons","delay_ms":2000}]'
+
+// ChaosRule define el fallo a inyectar en las rutas que coinciden.
+// Un path terminado en "/" coincide por prefijo, como en http.ServeMux; si no, exacto.
+type ChaosRule struct {
+	Method      string  `json:"method,omitempty" yaml:"method,omitempty"`
+	Path        string  `json:"path" yaml:"path"`
+	DelayMs     int     `json:"delay_ms,omitempty" yaml:"delay_ms,omitempty"`
+	DelayMaxMs  int     `json:"delay_max_ms,omitempty" yaml:"delay_max_ms,omitempty"`
+	ErrorRate   float64 `json:"error_rate,omitempty" yaml:"error_rate,omitempty"`
+	StatusCodes []int   `json:"status_codes,omitempty" yaml:"status_codes,omitempty"`
+}
+
+type ChaosConfig struct {
+	Enabled bool        `json:"enabled" yaml:"enabled" env:"CHAOS_ENABLED"`
+	Rules   []ChaosRule `json:"rules" yaml:"rules" env:"CHAOS_RULES"`
+}
+
+var (
+	chaosMu     sync.RWMutex
+	chaosConfig = ChaosConfig{Rules: []ChaosRule{}}
+)
+
+// chaosInit aplica la configuración inicial, ya validada en loadConfig
+func chaosInit(config ChaosConfig) {
+	if config.Rules == nil {
+		config.Rules = []ChaosRule{}
+	}
+	chaosSet(config)
+	if config.Enabled {
+		slog.Info("Inyección de fallos activada", "rules", len(config.Rules))
+	}
+}
+
+func chaosGet() ChaosConfig {
+	chaosMu.RLock()
+	defer chaosMu.RUnlock()
+	return chaosConfig
+}
+
+func chaosSet(config ChaosConfig) {
+	chaosMu.Lock()
+	defer chaosMu.Unlock()
+	chaosConfig = config
+}
+
+func (c ChaosConfig) validate() error {
+	for i, rule := range c.Rules {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("regla %d: path debe empezar por /", i)
+		}
+		if rule.DelayMs < 0 || rule.DelayMaxMs < 0 {
+			return fmt.Errorf("regla %d: los retardos no pueden ser negativos", i)
+		}
+		if rule.DelayMaxMs != 0 && rule.DelayMaxMs < rule.DelayMs {
+			return fmt.Errorf("regla %d: delay_max_ms debe ser mayor o igual que delay_ms", i)
+		}
+		if rule.ErrorRate < 0 || rule.ErrorRate > 1 {
+			return fmt.Errorf("regla %d: error_rate debe estar entre 0 y 1", i)
+		}
+		for _, code := range rule.StatusCodes {
+			if code < 400 || code > 599 {
+				return fmt.Errorf("regla %d: status_codes solo admite códigos 4xx y 5xx", i)
+			}
+		}
+	}
+	return nil
+}
+
+func (rule ChaosRule) matches(r *http.Request) bool {
+	if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+		return false
+	}
+	if strings.HasSuffix(rule.Path, "/") {
+		return strings.HasPrefix(r.URL.Path, rule.Path)
+	}
+	return r.URL.Path == rule.Path
+}
+
+// delay devuelve el retardo fijo, o uno aleatorio entre delay_ms y delay_max_ms
+func (rule ChaosRule) delay() time.Duration {
+	ms := rule.DelayMs
+	if rule.DelayMaxMs > rule.DelayMs {
+		ms += rand.Intn(rule.DelayMaxMs - rule.DelayMs + 1)
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// middleware de inyección de fallos: se aplica la primera regla que coincide
+func withChaos(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := chaosGet()
+		if !config.Enabled {
+			handler(w, r)
+			return
+		}
+
+		for _, rule := range config.Rules {
+			if !rule.matches(r) {
+				continue
+			}
+
+			if d := rule.delay(); d > 0 {
+				requestLogger(r.Context()).Info("chaos: retardo inyectado", "delay", d.String(), "method", r.Method, "path", r.URL.Path)
+				select {
+				case <-time.After(d):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+				status := http.StatusInternalServerError
+				if len(rule.StatusCodes) > 0 {
+					status = rule.StatusCodes[rand.Intn(len(rule.StatusCodes))]
+				}
+				requestLogger(r.Context()).Info("chaos: error inyectado", "status", status, "method", r.Method, "path", r.URL.Path)
+				w.Header().Set("X-Chaos-Injected", "true")
+				errJsonStatus(w, `Error inyectado`, status)
+				return
+			}
+			break
+		}
+
+		handler(w, r)
+	}
+}
+
+// chaosAdminRoutes son las rutas de /admin/chaos; solo se registran con chaos.enabled
+func chaosAdminRoutes() []route {
+	return []route{
+		{method: http.MethodGet, path: "/admin/chaos", handler: chaosAdminHandler, noChaos: true, master: true},
+		{method: http.MethodPut, path: "/admin/chaos", handler: chaosAdminHandler, noChaos: true, master: true},
+		{method: http.MethodDelete, path: "/admin/chaos", handler: chaosAdminHandler, noChaos: true, master: true},
+	}
+}
+
+// chaosAdminHandler consulta y cambia la configuración en caliente: /admin/chaos
+//
+//	GET    devuelve la configuración actual
+//	PUT    la sustituye por {"enabled": true, "rules": [...]}
+//	DELETE desactiva la inyección y borra las reglas
+func chaosAdminHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, chaosGet())
+
+	case http.MethodPut:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al leer el cuerpo de la solicitud: %v`, err), http.StatusBadRequest)
+			return
+		}
+		var config ChaosConfig
+		if err := json.Unmarshal(body, &config); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al parsear el JSON: %v`, err), http.StatusBadRequest)
+			return
+		}
+		if config.Rules == nil {
+			config.Rules = []ChaosRule{}
+		}
+		if err := config.validate(); err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		chaosSet(config)
+		requestLogger(r.Context()).Info("chaos: configuración actualizada", "enabled", config.Enabled, "rules", len(config.Rules))
+		writeJson(w, config)
+
+	case http.MethodDelete:
+		chaosSet(ChaosConfig{Rules: []ChaosRule{}})
+		requestLogger(r.Context()).Info("chaos: desactivado")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		errJsonStatus(w, `Método no permitido`, http.StatusMethodNotAllowed)
+	}
+}
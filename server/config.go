@@ -0,0 +1,499 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuración centralizada. Se carga al arrancar en este orden:
+//
+//  1. valores por defecto (defaultConfig)
+//  2. fichero YAML opcional indicado en CONFIG_FILE
+//  3. variables de entorno (etiqueta env); NOMBRE_FILE lee el valor de un fichero,
+//     útil para los secretos montados por Kubernetes
+//
+// Los campos con secret:"true" se redactan en `config print`.
+
+type Config struct {
+	ListenAddr      string             `yaml:"listen_addr" env:"LISTEN_ADDR"`
+	ShutdownTimeout Duration           `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	HTTP            HTTPConfig         `yaml:"http"`
+	GRPC            GRPCConfig         `yaml:"grpc"`
+	TLS             TLSConfig          `yaml:"tls"`
+	Postgres        PostgresConfig     `yaml:"postgres"`
+	Auth            AuthConfig         `yaml:"auth"`
+	Log             LogConfig          `yaml:"log"`
+	Tracing         TracingConfig      `yaml:"tracing"`
+	Readyz          ReadyzConfig       `yaml:"readyz"`
+	CORS            CORSConfig         `yaml:"cors"`
+	Redis           RedisConfig        `yaml:"redis"`
+	RateLimit       RateLimitConfig    `yaml:"rate_limit"`
+	Chaos           ChaosConfig        `yaml:"chaos"`
+	LegacyRoutes    LegacyRoutesConfig `yaml:"legacy_routes"`
+}
+
+type HTTPConfig struct {
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	MaxHeaderBytes    int      `yaml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES"`
+}
+
+// TLSConfig activa HTTPS en el propio servidor; con client_ca_file se aceptan
+// certificados de cliente (mTLS) como alternativa a los tokens
+type TLSConfig struct {
+	CertFile       string   `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile        string   `yaml:"key_file" env:"TLS_KEY_FILE"`
+	ClientCAFile   string   `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	ClientAuth     string   `yaml:"client_auth" env:"TLS_CLIENT_AUTH"`
+	ReloadInterval Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL"`
+}
+
+// GRPCConfig es la API gRPC (grpc.go); escucha en su propio puerto con el mismo TLS que
+// HTTP y con listen_addr vacío no se arranca
+type GRPCConfig struct {
+	ListenAddr string `yaml:"listen_addr" env:"GRPC_LISTEN_ADDR"`
+	Reflection bool   `yaml:"reflection" env:"GRPC_REFLECTION"`
+}
+
+type PostgresConfig struct {
+	Host            string   `yaml:"host" env:"POSTGRES_SERVICE" required:"true"`
+	User            string   `yaml:"user" env:"POSTGRES_USER" required:"true"`
+	Password        string   `yaml:"password" env:"POSTGRES_PASSWORD" required:"true" secret:"true"`
+	DB              string   `yaml:"db" env:"POSTGRES_DB" required:"true"`
+	SSLMode         string   `yaml:"sslmode" env:"POSTGRES_SSLMODE"`
+	SSLRootCert     string   `yaml:"sslrootcert" env:"POSTGRES_SSLROOTCERT"`
+	SSLCert         string   `yaml:"sslcert" env:"POSTGRES_SSLCERT"`
+	SSLKey          string   `yaml:"sslkey" env:"POSTGRES_SSLKEY"`
+	MaxOpenConns    int      `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	InitOnStart     bool     `yaml:"init_on_start" env:"DB_INIT_ON_START"`
+	// datos de ejemplo con secretos conocidos al inicializar; nunca en producción
+	SeedDemoData bool `yaml:"seed_demo_data" env:"DB_SEED_DEMO_DATA"`
+}
+
+type AuthConfig struct {
+	Token            string `yaml:"token" env:"AUTH_TOKEN" required:"true" secret:"true"`
+	SuperSecretToken string `yaml:"super_secret_token" env:"AUTH_SUPER_SECRET_TOKEN" secret:"true"`
+	ServiceURL       string `yaml:"service_url" env:"AUTH_SERVICE_URL"`
+	ProfileURL       string `yaml:"profile_url" env:"AUTH_PROFILE_URL"`
+	LogoutURL        string `yaml:"logout_url" env:"AUTH_LOGOUT_URL"`
+}
+
+type RedisConfig struct {
+	Host     string   `yaml:"host" env:"REDIS_SERVICE"`
+	Port     int      `yaml:"port" env:"REDIS_PORT"`
+	Password string   `yaml:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int      `yaml:"db" env:"REDIS_DB"`
+	Timeout  Duration `yaml:"timeout" env:"REDIS_TIMEOUT"`
+}
+
+type LogConfig struct {
+	Level      string   `yaml:"level" env:"LOG_LEVEL"`
+	RedactKeys []string `yaml:"redact_keys" env:"LOG_REDACT_KEYS"`
+}
+
+type TracingConfig struct {
+	Exporter    string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	ServiceName string `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+}
+
+type ReadyzConfig struct {
+	CacheTTL Duration `yaml:"cache_ttl" env:"READYZ_CACHE_TTL"`
+	Timeout  Duration `yaml:"timeout" env:"READYZ_TIMEOUT"`
+}
+
+// appConfig es la configuración cargada al arrancar; solo se lee después de loadConfig
+var appConfig = defaultConfig()
+
+func defaultConfig() *Config {
+	return &Config{
+		ListenAddr:      ":8080",
+		ShutdownTimeout: Duration(25 * time.Second),
+		HTTP: HTTPConfig{
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(60 * time.Second),
+			WriteTimeout:      Duration(60 * time.Second),
+			IdleTimeout:       Duration(120 * time.Second),
+			MaxHeaderBytes:    1 << 20,
+		},
+		GRPC: GRPCConfig{
+			ListenAddr: ":9090",
+			Reflection: true,
+		},
+		TLS: TLSConfig{
+			ClientAuth:     "optional",
+			ReloadInterval: Duration(30 * time.Second),
+		},
+		Postgres: PostgresConfig{
+			SSLMode:         "disable",
+			MaxOpenConns:    20,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration(30 * time.Minute),
+		},
+		Log:     LogConfig{Level: "info"},
+		Tracing: TracingConfig{Exporter: "none", ServiceName: tracerName},
+		Readyz: ReadyzConfig{
+			CacheTTL: Duration(5 * time.Second),
+			Timeout:  Duration(2 * time.Second),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:    []string{},
+			AuthClientOrigins: true,
+			AllowedHeaders:    []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Last-Event-ID", "X-Request-ID"},
+			ExposedHeaders:    []string{"ETag", "Location", "Content-Disposition", "X-Request-ID"},
+			MaxAge:            Duration(10 * time.Minute),
+			RefreshInterval:   Duration(time.Minute),
+		},
+		Redis: RedisConfig{
+			Port:    6379,
+			Timeout: Duration(500 * time.Millisecond),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:     true,
+			Backend:     "memory",
+			TrustedHops: 1,
+			Rules: []RateLimitRule{
+				{Path: "/", Key: rateLimitKeyToken, Limit: 600, Period: Duration(time.Minute), Burst: 100},
+				{Path: "/persons/{id}/applications/{app_id}/session", Key: rateLimitKeyAuthClient, Limit: 30, Period: Duration(time.Minute), Burst: 10},
+				{Path: "/api/v1/persons/{id}/memberships/{application_id}/sessions", Key: rateLimitKeyAuthClient, Limit: 30, Period: Duration(time.Minute), Burst: 10},
+				{Path: "/personapp-session/", Key: rateLimitKeyAuthClient, Limit: 30, Period: Duration(time.Minute), Burst: 10},
+			},
+			AuthFailures: RateLimitRule{Limit: 10, Period: Duration(time.Minute), Burst: 10},
+		},
+		Chaos: ChaosConfig{Rules: []ChaosRule{}},
+		LegacyRoutes: LegacyRoutesConfig{
+			Enabled: true,
+			Sunset:  "2027-04-18",
+		},
+	}
+}
+
+// ConfigError reúne todos los problemas de configuración para mostrarlos de una vez
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "configuración no válida:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// loadConfig carga y valida la configuración; con error devuelve también lo cargado para `config print`
+func loadConfig() (*Config, error) {
+	cfg := defaultConfig()
+	var problems []string
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("error al leer CONFIG_FILE: %v", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("error al parsear %s: %v", path, err)
+		}
+	}
+
+	configWalk(reflect.ValueOf(cfg).Elem(), "", func(field reflect.StructField, v reflect.Value, path string) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		value, ok, err := configEnvValue(name)
+		if err != nil {
+			problems = append(problems, err.Error())
+			return
+		}
+		if ok {
+			if err := configSet(v, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+		if field.Tag.Get("required") == "true" && v.IsZero() {
+			problems = append(problems, fmt.Sprintf("falta %s (variable %s, %s_FILE o clave %s en CONFIG_FILE)", path, name, name, path))
+		}
+	})
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return cfg, &ConfigError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// configEnvValue lee NOMBRE o, si no está, el contenido del fichero indicado en NOMBRE_FILE
+func configEnvValue(name string) (string, bool, error) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true, nil
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %v", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	return "", false, nil
+}
+
+// configSet asigna el texto de la variable de entorno según el tipo del campo
+func configSet(v reflect.Value, value string) error {
+	switch v.Addr().Interface().(type) {
+	case *Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(Duration(d)))
+		return nil
+	}
+
+	// reglas y demás estructuras se escriben en JSON
+	if v.Kind() == reflect.Struct || (v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct) {
+		ptr := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+			return err
+		}
+		v.Set(ptr.Elem())
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(i))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("tipo no soportado %s", v.Type())
+	}
+	return nil
+}
+
+// configWalk recorre los campos hoja de la configuración con su ruta YAML
+func configWalk(v reflect.Value, prefix string, fn func(field reflect.StructField, v reflect.Value, path string)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		path := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && field.Type != reflect.TypeOf(Duration(0)) && field.Tag.Get("env") == "" {
+			configWalk(fv, path, fn)
+			continue
+		}
+		fn(field, fv, path)
+	}
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		problems = append(problems, "tls.cert_file y tls.key_file deben indicarse juntos")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		problems = append(problems, "tls.client_ca_file requiere tls.cert_file y tls.key_file")
+	}
+	for name, path := range map[string]string{
+		"tls.cert_file":      c.TLS.CertFile,
+		"tls.key_file":       c.TLS.KeyFile,
+		"tls.client_ca_file": c.TLS.ClientCAFile,
+	} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	switch c.TLS.ClientAuth {
+	case "none", "optional":
+	case "require":
+		if c.TLS.ClientCAFile == "" {
+			problems = append(problems, "tls.client_auth=require necesita tls.client_ca_file")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tls.client_auth no válido: %q (none, optional o require)", c.TLS.ClientAuth))
+	}
+	if c.TLS.ReloadInterval <= 0 {
+		problems = append(problems, "tls.reload_interval debe ser positivo")
+	}
+
+	switch c.Postgres.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		problems = append(problems, fmt.Sprintf("postgres.sslmode no válido: %q", c.Postgres.SSLMode))
+	}
+	for name, path := range map[string]string{
+		"postgres.sslrootcert": c.Postgres.SSLRootCert,
+		"postgres.sslcert":     c.Postgres.SSLCert,
+		"postgres.sslkey":      c.Postgres.SSLKey,
+	} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if (c.Postgres.SSLCert == "") != (c.Postgres.SSLKey == "") {
+		problems = append(problems, "postgres.sslcert y postgres.sslkey deben indicarse juntos")
+	}
+	if c.Postgres.MaxOpenConns <= 0 {
+		problems = append(problems, "postgres.max_open_conns debe ser positivo")
+	}
+	if c.Postgres.MaxIdleConns < 0 {
+		problems = append(problems, "postgres.max_idle_conns no puede ser negativo")
+	}
+
+	for name, value := range map[string]string{
+		"auth.service_url": c.Auth.ServiceURL,
+		"auth.profile_url": c.Auth.ProfileURL,
+		"auth.logout_url":  c.Auth.LogoutURL,
+	} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s no es una URL http(s) válida: %q", name, value))
+		}
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log.level no válido: %q (debug, info, warn o error)", c.Log.Level))
+	}
+
+	switch strings.ToLower(c.Tracing.Exporter) {
+	case "", "none", "otlp", "stdout", "console":
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter no válido: %q (otlp, stdout o none)", c.Tracing.Exporter))
+	}
+
+	if c.GRPC.ListenAddr != "" && c.GRPC.ListenAddr == c.ListenAddr {
+		problems = append(problems, "grpc.listen_addr no puede ser el mismo que listen_addr")
+	}
+
+	if c.HTTP.MaxHeaderBytes <= 0 {
+		problems = append(problems, "http.max_header_bytes debe ser positivo")
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdown_timeout debe ser positivo")
+	}
+
+	problems = append(problems, c.CORS.validate()...)
+
+	if c.RateLimit.Enabled {
+		problems = append(problems, c.RateLimit.validate()...)
+		if c.RateLimit.Backend == "redis" && c.Redis.Host == "" {
+			problems = append(problems, "rate_limit.backend=redis necesita redis.host (REDIS_SERVICE)")
+		}
+	}
+
+	if err := c.Chaos.validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("chaos: %v", err))
+	}
+
+	problems = append(problems, c.LegacyRoutes.validate()...)
+
+	return problems
+}
+
+// Redacted devuelve una copia con los secretos ocultos
+func (c *Config) Redacted() *Config {
+	cp := *c
+	configWalk(reflect.ValueOf(&cp).Elem(), "", func(field reflect.StructField, v reflect.Value, path string) {
+		if field.Tag.Get("secret") == "true" && v.String() != "" {
+			v.SetString(logRedacted)
+		}
+	})
+	return &cp
+}
+
+// configPrintCommand implementa `config print`: muestra la configuración efectiva sin secretos
+func configPrintCommand() int {
+	cfg, err := loadConfig()
+	out, merr := yaml.Marshal(cfg.Redacted())
+	if merr != nil {
+		fmt.Fprintln(os.Stderr, merr)
+		return 1
+	}
+	os.Stdout.Write(out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Duration es un time.Duration que en YAML se escribe como "30s"
+type Duration time.Duration
+
+func (d Duration) D() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duración no válida %s: se espera un texto como \"1m\"", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("duración no válida %q: %v", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("duración no válida %q: %v", node.Value, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Política CORS. Los orígenes permitidos salen de cors.allowed_origins y, si
+// cors.auth_client_origins está activo, del client_url de las aplicaciones activas
+// en auth_clients (se vuelven a leer cada cors.refresh_interval).
+// Cada ruta declara sus métodos; OPTIONS solo responde a preflights válidos.
+
+type CORSConfig struct {
+	AllowedOrigins    []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AuthClientOrigins bool     `yaml:"auth_client_origins" env:"CORS_AUTH_CLIENT_ORIGINS"`
+	AllowCredentials  bool     `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	AllowedHeaders    []string `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders    []string `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	MaxAge            Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+	RefreshInterval   Duration `yaml:"refresh_interval" env:"CORS_REFRESH_INTERVAL"`
+}
+
+func (c CORSConfig) validate() []string {
+	var problems []string
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			if c.AllowCredentials {
+				problems = append(problems, `cors: "*" no se puede combinar con allow_credentials`)
+			}
+			continue
+		}
+		if _, err := corsParseOrigin(strings.Replace(origin, "://*.", "://", 1)); err != nil {
+			problems = append(problems, "cors.allowed_origins: "+err.Error())
+		}
+	}
+	if c.MaxAge < 0 {
+		problems = append(problems, "cors.max_age no puede ser negativo")
+	}
+	if c.AuthClientOrigins && c.RefreshInterval <= 0 {
+		problems = append(problems, "cors.refresh_interval debe ser positivo")
+	}
+	return problems
+}
+
+type corsPolicy struct {
+	db     *sql.DB
+	config CORSConfig
+
+	mu          sync.Mutex
+	appOrigins  map[string]bool
+	refreshedAt time.Time
+}
+
+func newCorsPolicy(db *sql.DB, config CORSConfig) *corsPolicy {
+	return &corsPolicy{db: db, config: config}
+}
+
+// corsParseOrigin normaliza un origen o una URL a "esquema://host[:puerto]"
+func corsParseOrigin(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("origen no válido %q: se espera esquema://host", raw)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// allowedOrigin indica si el origen está permitido y qué valor devolver en Access-Control-Allow-Origin
+func (p *corsPolicy) allowedOrigin(ctx context.Context, origin string) (string, bool) {
+	normalized, err := corsParseOrigin(origin)
+	if err != nil {
+		return "", false
+	}
+	for _, allowed := range p.config.AllowedOrigins {
+		if allowed == "*" {
+			return "*", true
+		}
+		allowed = strings.ToLower(allowed)
+		if allowed == normalized {
+			return origin, true
+		}
+		// comodín de subdominio: https://*.mydomain.com
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok &&
+			strings.HasPrefix(normalized, scheme+"://") && strings.HasSuffix(normalized, "."+domain) {
+			return origin, true
+		}
+	}
+	if p.config.AuthClientOrigins && p.authClientOrigins(ctx)[normalized] {
+		return origin, true
+	}
+	return "", false
+}
+
+// authClientOrigins devuelve los orígenes de las aplicaciones; si la consulta falla se mantienen los anteriores
+func (p *corsPolicy) authClientOrigins(ctx context.Context) map[string]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.appOrigins != nil && time.Since(p.refreshedAt) < p.config.RefreshInterval.D() {
+		return p.appOrigins
+	}
+	p.refreshedAt = time.Now()
+
+	urls, err := postgres_auth_client_urls(ctx, p.db)
+	if err != nil {
+		slog.Warn("No se pudieron leer los orígenes CORS de auth_clients", "error", err)
+		if p.appOrigins == nil {
+			p.appOrigins = map[string]bool{}
+		}
+		return p.appOrigins
+	}
+	origins := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		if origin, err := corsParseOrigin(u); err == nil {
+			origins[origin] = true
+		}
+	}
+	p.appOrigins = origins
+	return origins
+}
+
+// middleware aplica la política a una ruta que admite los métodos indicados
+func (p *corsPolicy) middleware(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allowMethods := strings.Join(methods, ", ")
+	allow := allowMethods + ", " + http.MethodOptions
+	allowHeaders := strings.Join(p.config.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(p.config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(p.config.MaxAge.D().Seconds()))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// la respuesta depende del origen aunque no se permita, para que no la reutilice una cache
+		if preflight {
+			w.Header().Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+		} else {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		// OPTIONS sin preflight: solo se informa de los métodos de la ruta
+		if r.Method == http.MethodOptions && !preflight {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		allowOrigin, ok := "", false
+		if origin != "" {
+			allowOrigin, ok = p.allowedOrigin(r.Context(), origin)
+		}
+
+		if preflight {
+			if !ok {
+				errJsonStatus(w, `Origen no permitido`, http.StatusForbidden)
+				return
+			}
+			if !corsMethodAllowed(r.Header.Get("Access-Control-Request-Method"), methods) {
+				w.Header().Set("Allow", allow)
+				errJsonStatus(w, `Método no permitido`, http.StatusMethodNotAllowed)
+				return
+			}
+			if !corsHeadersAllowed(r.Header.Get("Access-Control-Request-Headers"), p.config.AllowedHeaders) {
+				errJsonStatus(w, `Cabeceras no permitidas`, http.StatusForbidden)
+				return
+			}
+			p.setOrigin(w, allowOrigin)
+			w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+			if allowHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+			}
+			if p.config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if ok {
+			p.setOrigin(w, allowOrigin)
+			if exposeHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+		}
+
+		// Ejecutar el manejador original
+		handler(w, r)
+	}
+}
+
+func (p *corsPolicy) setOrigin(w http.ResponseWriter, allowOrigin string) {
+	w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+	if p.config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func corsMethodAllowed(method string, methods []string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// corsHeadersAllowed compara sin distinguir mayúsculas las cabeceras pedidas en el preflight
+func corsHeadersAllowed(requested string, allowed []string) bool {
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		found := false
+		for _, a := range allowed {
+			if strings.EqualFold(a, h) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func postgres_auth_client_urls(ctx context.Context, db *sql.DB) ([]string, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_urls")
+	defer span.End()
+
+	rows, err := db.QueryContext(ctx, `SELECT client_url FROM auth_clients WHERE status = 'active';`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
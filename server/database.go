@@ -1,23 +1,20 @@
-package main
+package server
 
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
 )
 
-func initTables(connStr string) error {
-	// Abre la conexión a la base de datos
-	var err error
-	db, err := openDatabaseConnection(connStr)
+func initTables(db *sql.DB) error {
+	err := initTablePersons(db)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer db.Close()
 
-	err = initTablePersons(db)
+	err = alterTablePersons(db)
 	if err != nil {
 		return err
 	}
@@ -26,11 +23,72 @@ func initTables(connStr string) error {
 		return err
 	}
 
+	err = alterTableAuthClients(db)
+	if err != nil {
+		return err
+	}
+
 	err = initTablePersonAuthClient(db)
 	if err != nil {
 		return err
 	}
 
+	err = initTableAuthClientRedirectUris(db)
+	if err != nil {
+		return err
+	}
+
+	err = initTableErpAppSessions(db)
+	if err != nil {
+		return err
+	}
+
+	err = initTableLogoutDeliveries(db)
+	if err != nil {
+		return err
+	}
+
+	err = initTableEventsOutbox(db)
+	if err != nil {
+		return err
+	}
+
+	err = initTableWebhookSubscriptions(db)
+	if err != nil {
+		return err
+	}
+
+	err = initTableWebhookDeliveries(db)
+	if err != nil {
+		return err
+	}
+
+	err = initTablePersonImports(db)
+	if err != nil {
+		return err
+	}
+
+	err = initTableSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// seedDemoData carga las personas y aplicaciones de ejemplo, con secretos conocidos
+// (CRM_SECRET, ...): solo para entornos de demo, con postgres.seed_demo_data.
+// Se cargan únicamente en una base vacía, para no duplicarlos ni chocar con los índices únicos
+func seedDemoData(db *sql.DB) error {
+	var seeded bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM persons) OR EXISTS (SELECT 1 FROM auth_clients);`).Scan(&seeded)
+	if err != nil {
+		return fmt.Errorf("error al comprobar los datos de ejemplo: %v", err)
+	}
+	if seeded {
+		return nil
+	}
+
 	err = insertPersons(db)
 	if err != nil {
 		return err
@@ -41,6 +99,11 @@ func initTables(connStr string) error {
 		return err
 	}
 
+	err = insertAuthClientRedirectUris(db)
+	if err != nil {
+		return err
+	}
+
 	err = insertPersonAuthClient(db)
 	if err != nil {
 		return err
@@ -49,17 +112,21 @@ func initTables(connStr string) error {
 	return nil
 }
 
-func initTablesHandler(connStr string) http.HandlerFunc {
+func initTablesHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		err := initTables(connStr)
+		err := initTables(db)
+		if err == nil && appConfig.Postgres.SeedDemoData {
+			err = seedDemoData(db)
+		}
 		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"error\",\"%v\"}", err), http.StatusInternalServerError)
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		// Responde json indicando que las tablas se crearon o ya existían
+		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"message": "Tablas creadas o ya existentes"}`))
 	}
 }
@@ -176,6 +243,22 @@ func initTablePersons(db *sql.DB) error {
 	return nil
 }
 
+// alterTablePersons añade a "persons" lo que no está en el CREATE TABLE original
+// el índice único de dni falla si ya hay dni repetidos: hay que resolverlos antes de /init
+func alterTablePersons(db *sql.DB) error {
+
+	alterTableSQL := `
+		CREATE UNIQUE INDEX IF NOT EXISTS persons_dni_key ON persons (dni);`
+
+	// Ejecuta la modificación de la tabla
+	_, err := db.Exec(alterTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al modificar la tabla persons: %v", err)
+	}
+
+	return nil
+}
+
 // initTableAuthClients crea la tabla "auth_clients" si no existe
 // esta tabla se usa para almacenar los clientes que pueden acceder a la API
 func initTableAuthClients(db *sql.DB) error {
@@ -201,42 +284,108 @@ func initTableAuthClients(db *sql.DB) error {
 	return nil
 }
 
-func dropTables(connStr string) http.HandlerFunc {
+// alterTableAuthClients añade las columnas nuevas de "auth_clients" en bases de datos existentes
+func alterTableAuthClients(db *sql.DB) error {
+
+	alterTableSQL := `
+		ALTER TABLE auth_clients
+			ADD COLUMN IF NOT EXISTS backchannel_logout_url VARCHAR(255),
+			ADD COLUMN IF NOT EXISTS tls_client_subject VARCHAR(255),
+			ADD COLUMN IF NOT EXISTS allowed_scopes TEXT[] NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS grant_types TEXT[] NOT NULL DEFAULT '{authorization_code}',
+			ADD COLUMN IF NOT EXISTS logo_url VARCHAR(255),
+			ADD COLUMN IF NOT EXISTS description TEXT,
+			ADD COLUMN IF NOT EXISTS owner_name VARCHAR(255),
+			ADD COLUMN IF NOT EXISTS owner_email VARCHAR(255),
+			ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active',
+			ADD COLUMN IF NOT EXISTS status_reason TEXT,
+			ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP;
+		ALTER TABLE auth_clients DROP CONSTRAINT IF EXISTS auth_clients_status_check;
+		ALTER TABLE auth_clients ADD CONSTRAINT auth_clients_status_check
+			CHECK (status IN ('active', 'suspended', 'retired'));
+		CREATE UNIQUE INDEX IF NOT EXISTS auth_clients_tls_client_subject_key
+			ON auth_clients (tls_client_subject);`
+
+	// Ejecuta la modificación de la tabla
+	_, err := db.Exec(alterTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al modificar la tabla auth_clients: %v", err)
+	}
+
+	return nil
+}
+
+func dropTables(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		// Abre la conexión a la base de datos
-		var err error
-		db, err := openDatabaseConnection(connStr)
+		err := dropTableSchemaVersion(db)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = dropTablePersonImports(db)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = dropTableWebhookDeliveries(db)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = dropTableWebhookSubscriptions(db)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = dropTableEventsOutbox(db)
 		if err != nil {
-			log.Fatal(err)
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		defer db.Close()
 
 		err = dropTablePersonAuthClient(db)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"error\",\"%v\"}", err), http.StatusInternalServerError)
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = dropTableLogoutDeliveries(db)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = dropTableErpAppSessions(db)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		err = dropTablePersons(db)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"error\",\"%v\"}", err), http.StatusInternalServerError)
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		err = dropTableAuthClients(db)
+		err = dropTableAuthClientRedirectUris(db)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"error\",\"%v\"}", err), http.StatusInternalServerError)
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		err = dropTableAuthSessions(db)
+		err = dropTableAuthClients(db)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("{\"error\",\"%v\"}", err), http.StatusInternalServerError)
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		// Responde json indicando que las tablas se eliminaron o no existían
+		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"message": "Tablas eliminadas o no existían"}`))
 	}
 }
@@ -280,41 +429,34 @@ func dropTableAuthClients(db *sql.DB) error {
 	return nil
 }
 
-func dropTableAuthSessions(db *sql.DB) error {
+func dropTableErpAppSessions(db *sql.DB) error {
 
-	// SQL para eliminar la tabla "auth_sessions"
-	dropTableSQL := `DROP TABLE IF EXISTS auth_sessions;`
+	// SQL para eliminar la tabla "erp_app_sessions"
+	dropTableSQL := `DROP TABLE IF EXISTS erp_app_sessions;`
 
 	// Ejecuta la eliminación de la tabla
 	_, err := db.Exec(dropTableSQL)
 	if err != nil {
-		return fmt.Errorf("error al eliminar la tabla auth_sessions: %v", err)
+		return fmt.Errorf("error al eliminar la tabla erp_app_sessions: %v", err)
 	}
 	return nil
 }
 
 // checkTable verifica si la tabla "persons" existe
-func checkTable(connStr string) http.HandlerFunc {
+func checkTable(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		// Abre la conexión a la base de datos
-		var err error
-		db, err := openDatabaseConnection(connStr)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer db.Close()
-
 		// SQL para verificar si la tabla existe
 		var exists bool
 		query := `SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'persons');`
-		err = db.QueryRow(query).Scan(&exists)
+		err := db.QueryRow(query).Scan(&exists)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error al verificar la tabla: %v", err), http.StatusInternalServerError)
+			errJsonStatus(w, fmt.Sprintf(`Error al verificar la tabla: %v`, err), http.StatusInternalServerError)
 			return
 		}
 
 		// Responde json según si la tabla existe
+		w.Header().Set("Content-Type", "application/json")
 		if exists {
 			w.Write([]byte(`{"message": "La tabla 'persons' existe"}`))
 		} else {
@@ -323,32 +465,48 @@ func checkTable(connStr string) http.HandlerFunc {
 	}
 }
 
-func databaseConnString() (string, error) {
-
-	dbName := os.Getenv("POSTGRES_DB")
-	dbPassword := os.Getenv("POSTGRES_PASSWORD")
-	dbHost := os.Getenv("POSTGRES_SERVICE")
-	dbUser := os.Getenv("POSTGRES_USER")
+// databaseConnString construye la URL de conexión con las opciones TLS de la configuración
+func databaseConnString(config PostgresConfig) string {
 
-	// Si alguna variable de entorno no está definida, el programa falla
-	if dbName == "" || dbPassword == "" || dbHost == "" || dbUser == "" {
-		return "", fmt.Errorf("error: Las variables de entorno POSTGRES_USER, POSTGRES_PASSWORD, POSTGRES_SERVICE y POSTGRES_DB deben estar definidas")
+	// la contraseña y los certificados se escapan para que no rompan la URL
+	params := url.Values{}
+	params.Set("sslmode", config.SSLMode)
+	if config.SSLRootCert != "" {
+		params.Set("sslrootcert", config.SSLRootCert)
+	}
+	if config.SSLCert != "" {
+		params.Set("sslcert", config.SSLCert)
+		params.Set("sslkey", config.SSLKey)
 	}
 
-	return fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", dbUser, dbPassword, dbHost, dbName), nil
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(config.User, config.Password),
+		Host:     config.Host,
+		Path:     "/" + config.DB,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
 }
 
-func openDatabaseConnection(connStr string) (*sql.DB, error) {
+// openDatabasePool abre el pool de conexiones compartido por todos los manejadores.
+// El tamaño se ajusta con postgres.max_open_conns, max_idle_conns y conn_max_lifetime.
+func openDatabasePool(config PostgresConfig) (*sql.DB, error) {
 
 	// Conexión a PostgreSQL
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", databaseConnString(config))
 	if err != nil {
 		return nil, fmt.Errorf("error: Error al conectar a la base de datos: %v", err)
 	}
 
-	// Verifica que la base de datos se pueda acceder
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime.D())
+
+	// Verifica que la base de datos se pueda acceder; si aún no está disponible
+	// el pool reintentará en cada consulta
 	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("error: No se pudo conectar a la base de datos: %v", err)
+		slog.Warn("No se pudo conectar a la base de datos", "error", err)
 	}
 
 	return db, nil
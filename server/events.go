@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// parámetros del feed de eventos
+const (
+	eventsDefaultLimit    = 100
+	eventsMaxLimit        = 1000
+	eventsStreamInterval  = time.Second
+	eventsStreamHeartbeat = 15 * time.Second
+)
+
+type EventsPage struct {
+	Events     []OutboxEvent `json:"events"`
+	NextCursor string        `json:"next_cursor"`
+}
+
+// eventsCursor parsea el cursor opaco (el id del último evento recibido)
+func eventsCursor(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	cursor, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || cursor < 0 {
+		return 0, fmt.Errorf("cursor no válido: %q", value)
+	}
+	return cursor, nil
+}
+
+// getEventsHandler devuelve los cambios posteriores al cursor en orden de commit:
+// /events?since=<cursor>&limit=100&entity=person
+func getEventsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		since, err := eventsCursor(r.URL.Query().Get("since"))
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit, err := queryIntParam(r, "limit")
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if limit <= 0 || limit > eventsMaxLimit {
+			limit = eventsDefaultLimit
+		}
+
+		entity := r.URL.Query().Get("entity")
+
+		list, err := postgres_events_since(ctx, db, since, entity, limit)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener los eventos: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// si no hay eventos nuevos el cursor no avanza
+		next := since
+		if len(list) > 0 {
+			next = list[len(list)-1].ID
+		}
+
+		writeJson(w, EventsPage{Events: list, NextCursor: strconv.FormatInt(next, 10)})
+	}
+}
+
+// getEventsStreamHandler emite el mismo feed como Server-Sent Events:
+// /events/stream?since=<cursor> (o cabecera Last-Event-ID al reconectar)
+func getEventsStreamHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		cursorValue := r.Header.Get("Last-Event-ID")
+		if cursorValue == "" {
+			cursorValue = r.URL.Query().Get("since")
+		}
+		since, err := eventsCursor(cursorValue)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		entity := r.URL.Query().Get("entity")
+
+		rc := http.NewResponseController(w)
+
+		// el stream no tiene fin: sin plazo de escritura del servidor
+		rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			requestLogger(ctx).Error("getEventsStreamHandler flush no soportado", "error", err)
+			return
+		}
+
+		ticker := time.NewTicker(eventsStreamInterval)
+		defer ticker.Stop()
+		lastWrite := time.Now()
+
+		for {
+			list, err := postgres_events_since(ctx, db, since, entity, eventsMaxLimit)
+			if err != nil {
+				fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+				rc.Flush()
+				return
+			}
+
+			for _, event := range list {
+				data, err := json.Marshal(event)
+				if err != nil {
+					requestLogger(ctx).Error("getEventsStreamHandler error al serializar el evento", "event_id", event.ID, "error", err)
+					return
+				}
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+				since = event.ID
+			}
+
+			if len(list) > 0 {
+				lastWrite = time.Now()
+			} else if time.Since(lastWrite) >= eventsStreamHeartbeat {
+				// comentario para que proxies e ingress no cierren la conexión
+				fmt.Fprint(w, ": heartbeat\n\n")
+				lastWrite = time.Now()
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+			// si hay más eventos pendientes no espera al siguiente tick
+			if len(list) == eventsMaxLimit {
+				continue
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-lifecycle.Stopping():
+				// el cliente reconecta con Last-Event-ID a otra réplica
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+func postgres_events_since(ctx context.Context, db *sql.DB, since int64, entity string, limit int) ([]OutboxEvent, error) {
+	ctx, span := startDbSpan(ctx, "postgres_events_since")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, event_type, entity, entity_id, payload, created_at
+		FROM
+			events_outbox
+		WHERE
+			id > $1 AND ($2 = '' OR entity = $2)
+		ORDER BY id
+		LIMIT $3;`
+	rows, err := db.QueryContext(ctx, query, since, entity, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []OutboxEvent{}
+	for rows.Next() {
+		var item OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&item.ID, &item.Type, &item.Entity, &item.EntityID, &payload, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		item.Data = payload
+		list = append(list, item)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,448 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+// Endpoint GraphQL (POST /graphql) de solo lectura sobre personas, aplicaciones y pertenencias,
+// para que el frontend no tenga que combinar GET /persons/{id} y GET /applications/{id}.
+// Pasa por la misma cadena de middlewares que REST (autenticación, CORS, límites).
+//
+// Las relaciones se resuelven con cargadores (dataloader) por petición: las pertenencias de
+// todas las personas de una respuesta se leen de person_auth_client en una sola consulta, y
+// lo mismo las personas y aplicaciones a las que apuntan, en lugar de una consulta por fila.
+//
+//	{ person(id: 7) { nombre memberships { profile application { clientId } } } }
+
+const graphqlSchema = `
+	schema {
+		query: Query
+	}
+
+	type Query {
+		person(id: ID!): Person
+		persons(q: String, dni: String, email: String, applicationId: ID): [Person!]!
+		application(id: ID!): Application
+		applicationByClientId(clientId: String!): Application
+		applications: [Application!]!
+	}
+
+	type Person {
+		id: ID!
+		dni: String!
+		nombre: String!
+		apellidos: String!
+		email: String!
+		telefono: String
+		createdAt: String!
+		memberships: [Membership!]!
+		applications: [Application!]!
+	}
+
+	# sin client_secret: los secretos solo se devuelven al generarlos por REST
+	type Application {
+		id: ID!
+		clientId: String!
+		clientUrl: String!
+		clientUrlCallback: String
+		backchannelLogoutUrl: String
+		redirectUris: [String!]!
+		postLogoutRedirectUris: [String!]!
+		allowedScopes: [String!]!
+		grantTypes: [String!]!
+		logoUrl: String
+		description: String
+		ownerName: String
+		ownerEmail: String
+		# active, suspended o retired
+		status: String!
+		statusReason: String
+		statusChangedAt: String
+		createdAt: String!
+		memberships: [Membership!]!
+		persons: [Person!]!
+	}
+
+	# profile es el JSON guardado para la persona en la aplicación
+	type Membership {
+		id: ID!
+		profile: String
+		createdAt: String!
+		person: Person
+		application: Application
+	}
+`
+
+const (
+	graphqlMaxDepth       = 8
+	graphqlMaxParallelism = 10
+)
+
+// graphqlHandler sirve las consultas GraphQL: POST /graphql {"query": "...", "variables": {...}}
+func graphqlHandler(db *sql.DB) http.HandlerFunc {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlQuery{db: db},
+		graphql.MaxDepth(graphqlMaxDepth), graphql.MaxParallelism(graphqlMaxParallelism))
+	h := &relay.Handler{Schema: schema}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// los cargadores viven lo que dura la petición: su caché nunca sirve datos de otra
+		h.ServeHTTP(w, r.WithContext(graphqlWithLoaders(r.Context(), db)))
+	}
+}
+
+// graphqlLoaders agrupa las cargas de una petición
+type graphqlLoaders struct {
+	person                *dataloader.Loader[int, *PersonData]
+	application           *dataloader.Loader[int, *AuthClient]
+	membershipsByPerson   *dataloader.Loader[int, []PersonApp]
+	membershipsByAuthClnt *dataloader.Loader[int, []PersonApp]
+}
+
+type graphqlLoadersKey struct{}
+
+func graphqlWithLoaders(ctx context.Context, db *sql.DB) context.Context {
+	loaders := &graphqlLoaders{
+		person: dataloader.NewBatchedLoader(graphqlBatchByID(func(ctx context.Context, ids []int) ([]PersonData, error) {
+			return postgres_persons_by_ids(ctx, db, ids)
+		}, func(p PersonData) int { return p.ID })),
+		application: dataloader.NewBatchedLoader(graphqlBatchByID(func(ctx context.Context, ids []int) ([]AuthClient, error) {
+			return postgres_auth_clients_by_ids(ctx, db, ids)
+		}, func(app AuthClient) int { return app.ID })),
+		membershipsByPerson: dataloader.NewBatchedLoader(graphqlBatchGroup(func(ctx context.Context, ids []int) ([]PersonApp, error) {
+			return postgres_personapp_by_person_ids(ctx, db, ids)
+		}, func(pa PersonApp) int { return pa.PersonID })),
+		membershipsByAuthClnt: dataloader.NewBatchedLoader(graphqlBatchGroup(func(ctx context.Context, ids []int) ([]PersonApp, error) {
+			return postgres_personapp_by_auth_client_ids(ctx, db, ids)
+		}, func(pa PersonApp) int { return pa.AuthClientId })),
+	}
+	return context.WithValue(ctx, graphqlLoadersKey{}, loaders)
+}
+
+func loadersFrom(ctx context.Context) *graphqlLoaders {
+	return ctx.Value(graphqlLoadersKey{}).(*graphqlLoaders)
+}
+
+// graphqlPrefetch encola de una vez las claves de toda una lista, sin esperar el resultado.
+// Con MaxParallelism solo graphqlMaxParallelism resolvedores piden a la vez y cada lote
+// tendría ese número de claves; así la lista entera sale en una consulta y los resolvedores
+// de cada fila encuentran su resultado en la caché del cargador
+func graphqlPrefetch[V any](ctx context.Context, loader *dataloader.Loader[int, V], ids []int) {
+	// Load no bloquea: añade la clave al lote en curso y devuelve el thunk, que se descarta
+	for _, id := range ids {
+		loader.Load(ctx, id)
+	}
+}
+
+// graphqlBatchByID adapta una consulta por lista de ids al cargador: un resultado por clave,
+// en el mismo orden, y nil si el id no existe
+func graphqlBatchByID[V any](load func(context.Context, []int) ([]V, error), id func(V) int) dataloader.BatchFunc[int, *V] {
+	return func(ctx context.Context, keys []int) []*dataloader.Result[*V] {
+		results := make([]*dataloader.Result[*V], len(keys))
+		list, err := load(ctx, keys)
+		byID := make(map[int]*V, len(list))
+		for i := range list {
+			byID[id(list[i])] = &list[i]
+		}
+		for i, key := range keys {
+			results[i] = &dataloader.Result[*V]{Data: byID[key], Error: err}
+		}
+		return results
+	}
+}
+
+// graphqlBatchGroup es como graphqlBatchByID para relaciones uno a muchos
+func graphqlBatchGroup[V any](load func(context.Context, []int) ([]V, error), id func(V) int) dataloader.BatchFunc[int, []V] {
+	return func(ctx context.Context, keys []int) []*dataloader.Result[[]V] {
+		results := make([]*dataloader.Result[[]V], len(keys))
+		list, err := load(ctx, keys)
+		byID := make(map[int][]V, len(keys))
+		for _, item := range list {
+			byID[id(item)] = append(byID[id(item)], item)
+		}
+		for i, key := range keys {
+			results[i] = &dataloader.Result[[]V]{Data: byID[key], Error: err}
+		}
+		return results
+	}
+}
+
+// graphqlID convierte un ID de GraphQL en el id numérico de la tabla
+func graphqlID(id graphql.ID) (int, error) {
+	iid, err := strconv.Atoi(string(id))
+	if err != nil || iid <= 0 {
+		return 0, fmt.Errorf("id no válido: %q", id)
+	}
+	return iid, nil
+}
+
+func graphqlIDOf(id int) graphql.ID {
+	return graphql.ID(strconv.Itoa(id))
+}
+
+type graphqlQuery struct {
+	db *sql.DB
+}
+
+func (q *graphqlQuery) Person(ctx context.Context, args struct{ ID graphql.ID }) (*personResolver, error) {
+	iid, err := graphqlID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	person, err := loadersFrom(ctx).person.Load(ctx, iid)()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la persona: %w", err)
+	}
+	if person == nil {
+		return nil, nil
+	}
+	return &personResolver{*person}, nil
+}
+
+func (q *graphqlQuery) Persons(ctx context.Context, args struct {
+	Q, Dni, Email *string
+	ApplicationId *graphql.ID
+}) ([]*personResolver, error) {
+	var filter PersonFilter
+	if args.Q != nil {
+		filter.Q = strings.TrimSpace(*args.Q)
+	}
+	if args.Dni != nil {
+		filter.Dni = strings.TrimSpace(*args.Dni)
+	}
+	if args.Email != nil {
+		filter.Email = strings.TrimSpace(*args.Email)
+	}
+	if args.ApplicationId != nil {
+		iid, err := graphqlID(*args.ApplicationId)
+		if err != nil {
+			return nil, err
+		}
+		filter.AuthClientID = iid
+	}
+
+	list, err := postgres_persons_filtered(ctx, q.db, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las personas: %w", err)
+	}
+	loaders := loadersFrom(ctx)
+	ids := make([]int, 0, len(list))
+	res := make([]*personResolver, 0, len(list))
+	for _, person := range list {
+		loaders.person.Prime(ctx, person.ID, &person)
+		ids = append(ids, person.ID)
+		res = append(res, &personResolver{person})
+	}
+	graphqlPrefetch(ctx, loaders.membershipsByPerson, ids)
+	return res, nil
+}
+
+func (q *graphqlQuery) Application(ctx context.Context, args struct{ ID graphql.ID }) (*applicationResolver, error) {
+	iid, err := graphqlID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	app, err := loadersFrom(ctx).application.Load(ctx, iid)()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la aplicación: %w", err)
+	}
+	if app == nil {
+		return nil, nil
+	}
+	return &applicationResolver{*app}, nil
+}
+
+func (q *graphqlQuery) ApplicationByClientId(ctx context.Context, args struct{ ClientId string }) (*applicationResolver, error) {
+	app, err := postgres_auth_client_by_client_id(ctx, q.db, args.ClientId)
+	if errors.Is(err, errAuthClientNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la aplicación: %w", err)
+	}
+	return &applicationResolver{*app}, nil
+}
+
+func (q *graphqlQuery) Applications(ctx context.Context) ([]*applicationResolver, error) {
+	list, err := postgres_auth_clients_all(ctx, q.db)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las aplicaciones: %w", err)
+	}
+	loaders := loadersFrom(ctx)
+	ids := make([]int, 0, len(list))
+	res := make([]*applicationResolver, 0, len(list))
+	for _, app := range list {
+		loaders.application.Prime(ctx, app.ID, &app)
+		ids = append(ids, app.ID)
+		res = append(res, &applicationResolver{app})
+	}
+	graphqlPrefetch(ctx, loaders.membershipsByAuthClnt, ids)
+	return res, nil
+}
+
+type personResolver struct {
+	p PersonData
+}
+
+func (r *personResolver) ID() graphql.ID    { return graphqlIDOf(r.p.ID) }
+func (r *personResolver) Dni() string       { return r.p.Dni }
+func (r *personResolver) Nombre() string    { return r.p.Nombre }
+func (r *personResolver) Apellidos() string { return r.p.Apellidos }
+func (r *personResolver) Email() string     { return r.p.Email }
+func (r *personResolver) Telefono() *string { return r.p.Telefono }
+func (r *personResolver) CreatedAt() string { return r.p.CreatedAt.Format(time.RFC3339) }
+
+func (r *personResolver) Memberships(ctx context.Context) ([]*membershipResolver, error) {
+	list, err := loadersFrom(ctx).membershipsByPerson.Load(ctx, r.p.ID)()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las pertenencias: %w", err)
+	}
+	return membershipResolvers(list), nil
+}
+
+func (r *personResolver) Applications(ctx context.Context) ([]*applicationResolver, error) {
+	list, err := loadersFrom(ctx).membershipsByPerson.Load(ctx, r.p.ID)()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las pertenencias: %w", err)
+	}
+	ids := make([]int, 0, len(list))
+	for _, pa := range list {
+		ids = append(ids, pa.AuthClientId)
+	}
+	apps, errs := loadersFrom(ctx).application.LoadMany(ctx, ids)()
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("error al obtener las aplicaciones: %w", err)
+	}
+	graphqlPrefetch(ctx, loadersFrom(ctx).membershipsByAuthClnt, ids)
+	res := make([]*applicationResolver, 0, len(apps))
+	for _, app := range apps {
+		if app != nil {
+			res = append(res, &applicationResolver{*app})
+		}
+	}
+	return res, nil
+}
+
+type applicationResolver struct {
+	app AuthClient
+}
+
+func (r *applicationResolver) ID() graphql.ID                { return graphqlIDOf(r.app.ID) }
+func (r *applicationResolver) ClientId() string              { return r.app.ClientID }
+func (r *applicationResolver) ClientUrl() string             { return r.app.ClientUrl }
+func (r *applicationResolver) ClientUrlCallback() *string    { return r.app.ClientUrlCallback }
+func (r *applicationResolver) BackchannelLogoutUrl() *string { return r.app.BackchannelLogoutUrl }
+func (r *applicationResolver) LogoUrl() *string              { return r.app.LogoUrl }
+func (r *applicationResolver) Description() *string          { return r.app.Description }
+func (r *applicationResolver) OwnerName() *string            { return r.app.OwnerName }
+func (r *applicationResolver) OwnerEmail() *string           { return r.app.OwnerEmail }
+func (r *applicationResolver) Status() string                { return r.app.Status }
+func (r *applicationResolver) StatusReason() *string         { return r.app.StatusReason }
+func (r *applicationResolver) StatusChangedAt() *string      { return r.app.StatusChangedAt }
+func (r *applicationResolver) CreatedAt() string             { return r.app.CreatedAt }
+
+func (r *applicationResolver) RedirectUris() []string {
+	if r.app.RedirectUris == nil {
+		return []string{}
+	}
+	return r.app.RedirectUris
+}
+
+func (r *applicationResolver) PostLogoutRedirectUris() []string {
+	if r.app.PostLogoutRedirectUris == nil {
+		return []string{}
+	}
+	return r.app.PostLogoutRedirectUris
+}
+
+func (r *applicationResolver) AllowedScopes() []string {
+	if r.app.AllowedScopes == nil {
+		return []string{}
+	}
+	return r.app.AllowedScopes
+}
+
+func (r *applicationResolver) GrantTypes() []string {
+	if r.app.GrantTypes == nil {
+		return []string{}
+	}
+	return r.app.GrantTypes
+}
+
+func (r *applicationResolver) Memberships(ctx context.Context) ([]*membershipResolver, error) {
+	list, err := loadersFrom(ctx).membershipsByAuthClnt.Load(ctx, r.app.ID)()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las pertenencias: %w", err)
+	}
+	return membershipResolvers(list), nil
+}
+
+func (r *applicationResolver) Persons(ctx context.Context) ([]*personResolver, error) {
+	list, err := loadersFrom(ctx).membershipsByAuthClnt.Load(ctx, r.app.ID)()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las pertenencias: %w", err)
+	}
+	ids := make([]int, 0, len(list))
+	for _, pa := range list {
+		ids = append(ids, pa.PersonID)
+	}
+	persons, errs := loadersFrom(ctx).person.LoadMany(ctx, ids)()
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("error al obtener las personas: %w", err)
+	}
+	graphqlPrefetch(ctx, loadersFrom(ctx).membershipsByPerson, ids)
+	res := make([]*personResolver, 0, len(persons))
+	for _, person := range persons {
+		if person != nil {
+			res = append(res, &personResolver{*person})
+		}
+	}
+	return res, nil
+}
+
+type membershipResolver struct {
+	pa PersonApp
+}
+
+func membershipResolvers(list []PersonApp) []*membershipResolver {
+	res := make([]*membershipResolver, 0, len(list))
+	for _, pa := range list {
+		res = append(res, &membershipResolver{pa})
+	}
+	return res
+}
+
+func (r *membershipResolver) ID() graphql.ID    { return graphqlIDOf(r.pa.ID) }
+func (r *membershipResolver) Profile() *string  { return r.pa.Profile }
+func (r *membershipResolver) CreatedAt() string { return r.pa.CreatedAt.Format(time.RFC3339) }
+
+func (r *membershipResolver) Person(ctx context.Context) (*personResolver, error) {
+	person, err := loadersFrom(ctx).person.Load(ctx, r.pa.PersonID)()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la persona: %w", err)
+	}
+	if person == nil {
+		return nil, nil
+	}
+	return &personResolver{*person}, nil
+}
+
+func (r *membershipResolver) Application(ctx context.Context) (*applicationResolver, error) {
+	app, err := loadersFrom(ctx).application.Load(ctx, r.pa.AuthClientId)()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la aplicación: %w", err)
+	}
+	if app == nil {
+		return nil, nil
+	}
+	return &applicationResolver{*app}, nil
+}
@@ -0,0 +1,628 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"dummy-corp-erp-server/api"
+	"dummy-corp-erp-server/api/erpv1"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// API gRPC para los servicios internos: PersonService, ApplicationService y MembershipService
+// (api/erpv1/erp.proto). Escucha en grpc.listen_addr con el mismo TLS que HTTP; los métodos
+// llaman a los mismos servicios que /api/v1 (services.go) y se autentican como withAuth, con
+// el token en la cabecera authorization ("Bearer ...") o un certificado de cliente.
+// Con grpc.reflection los clientes como grpcurl descubren los servicios sin el .proto;
+// la reflexión es un stream y pasa por la misma autenticación.
+
+// errores de gRPC: el código de la API v1 viaja como ErrorInfo.reason con este dominio
+const grpcErrorDomain = "erp.v1"
+
+// newGrpcServer crea el servidor gRPC con los servicios registrados
+func newGrpcServer(config *Config, db *sql.DB, auth_token string) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(grpcLoggingInterceptor, grpcAuthInterceptor(db, auth_token)),
+		grpc.ChainStreamInterceptor(grpcAuthStreamInterceptor(db, auth_token)),
+	}
+	if config.TLS.CertFile != "" {
+		reloader, err := newTlsReloader(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.serverConfig())))
+	}
+
+	srv := grpc.NewServer(opts...)
+	erpv1.RegisterPersonServiceServer(srv, &grpcPersonServer{service: personService{db}})
+	erpv1.RegisterApplicationServiceServer(srv, &grpcApplicationServer{service: applicationService{db}})
+	erpv1.RegisterMembershipServiceServer(srv, &grpcMembershipServer{service: membershipService{db}})
+	if config.GRPC.Reflection {
+		reflection.Register(srv)
+	}
+	return srv, nil
+}
+
+// grpcHttpRequest traduce los metadatos de la llamada a la petición HTTP que esperan
+// authenticate, el limitador y los logs: cabeceras, dirección del cliente y certificado.
+// gRPC no pasa por el ingress, así que X-Forwarded-For no se copia: la IP es la de la conexión.
+func grpcHttpRequest(ctx context.Context, method string) *http.Request {
+	r := &http.Request{
+		Method:     http.MethodPost,
+		URL:        &url.URL{Path: method},
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     http.Header{},
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range []string{"authorization", "x-request-id", "user-agent", "traceparent", "tracestate"} {
+			if values := md.Get(key); len(values) > 0 {
+				r.Header.Set(key, values[0])
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state := info.State
+			r.TLS = &state
+		}
+	}
+	return r.WithContext(ctx)
+}
+
+// grpcLoggingInterceptor hace lo que withLogging y withTracing en HTTP: id de petición, span
+// de servidor y una línea de log por llamada
+func grpcLoggingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	r := grpcHttpRequest(ctx, info.FullMethod)
+
+	reqInfo := &requestInfo{ID: requestID(r)}
+	ctx = context.WithValue(ctx, requestInfoKey{}, reqInfo)
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", reqInfo.ID))
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	res, err := handler(ctx, req)
+
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+		level = slog.LevelError
+		span.SetStatus(otelcodes.Error, code.String())
+	default:
+		level = slog.LevelWarn
+	}
+	slog.LogAttrs(ctx, level, "grpc request",
+		slog.String("request_id", reqInfo.ID),
+		slog.String("method", info.FullMethod),
+		slog.String("code", code.String()),
+		slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		slog.String("principal", reqInfo.Principal),
+		slog.String("trace_id", traceIDFrom(ctx)),
+		slog.String("remote_addr", r.RemoteAddr),
+		slog.String("user_agent", r.UserAgent()),
+	)
+	return res, err
+}
+
+// grpcAuthInterceptor valida las credenciales con authenticate, como withAuth, y aplica
+// después las reglas de rate_limit, como withRateLimit
+func grpcAuthInterceptor(db *sql.DB, auth_token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		r := grpcHttpRequest(ctx, info.FullMethod)
+		if err := grpcAuthenticate(r, db, auth_token); err != nil {
+			return nil, err
+		}
+
+		// las reglas se escriben sobre rutas HTTP: los métodos con una regla propia se
+		// traducen a su ruta de /api/v1; el resto coincide con las reglas de prefijo "/"
+		if route, ok := grpcRateLimitRoutes[info.FullMethod]; ok {
+			r.URL.Path = route(req)
+		}
+		if err := grpcRateLimit(r); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// grpcAuthStreamInterceptor es grpcAuthInterceptor para los streams: la reflexión
+func grpcAuthStreamInterceptor(db *sql.DB, auth_token string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		r := grpcHttpRequest(ss.Context(), info.FullMethod)
+		if err := grpcAuthenticate(r, db, auth_token); err != nil {
+			return err
+		}
+		if err := grpcRateLimit(r); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// grpcRateLimitRoutes traduce a la ruta de /api/v1 equivalente los métodos que tienen
+// reglas propias, como el límite de sesiones por auth_client
+var grpcRateLimitRoutes = map[string]func(req any) string{
+	erpv1.MembershipService_CreateSession_FullMethodName: func(req any) string {
+		in := req.(*erpv1.CreateSessionRequest)
+		return fmt.Sprintf("%s/persons/%d/memberships/%d/sessions", apiV1Prefix, in.GetPersonId(), in.GetApplicationId())
+	},
+}
+
+// grpcAuthenticate hace lo que withAuth: espera si la IP ha agotado los intentos fallidos
+// y valida las credenciales con authenticate
+func grpcAuthenticate(r *http.Request, db *sql.DB, auth_token string) error {
+	if limited := rateLimitAuthCheck(r); limited != nil {
+		return grpcResourceExhausted(`Demasiados intentos de autenticación`, limited)
+	}
+
+	principal, ok := authenticate(r, db, auth_token)
+	if !ok {
+		return status.Error(codes.Unauthenticated, `No autorizado`)
+	}
+	setRequestPrincipal(r, principal)
+	return nil
+}
+
+// grpcRateLimit consume un token de cada regla que coincide, como withRateLimit
+func grpcRateLimit(r *http.Request) error {
+	limiter := rateLimits
+	if limiter == nil {
+		return nil
+	}
+	if result, ok := limiter.check(r); !ok {
+		return grpcResourceExhausted(`Demasiadas peticiones`, result)
+	}
+	return nil
+}
+
+// grpcResourceExhausted es la respuesta 429 de gRPC, con el tiempo de espera en RetryInfo
+func grpcResourceExhausted(msg string, limited *rateLimitResult) error {
+	st := status.New(codes.ResourceExhausted, msg)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(time.Duration(limited.retryAfter()) * time.Second),
+	}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// grpcCodes traduce el estado HTTP de los problemas de la API v1
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.FailedPrecondition,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusBadGateway:          codes.Unavailable,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// grpcError convierte el *api.Problem de un servicio en un status de gRPC: el código de la API
+// en ErrorInfo y los campos no válidos en BadRequest
+func grpcError(err error) error {
+	var problem *api.Problem
+	if !errors.As(err, &problem) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	code, ok := grpcCodes[problem.Status]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	st := status.New(code, problem.Detail)
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: problem.Code, Domain: grpcErrorDomain}}
+	if len(problem.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range problem.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations,
+				&errdetails.BadRequest_FieldViolation{Field: field.Field, Description: field.Message})
+		}
+		details = append(details, badRequest)
+	}
+	if detailed, err := st.WithDetails(details...); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// grpcID valida un id recibido; los ids de las tablas son positivos
+func grpcID(field string, id int64) (int, error) {
+	if id <= 0 {
+		return 0, grpcError(newProblem(http.StatusBadRequest, api.ProblemInvalidParameter,
+			fmt.Sprintf(`%s no válido: %d`, field, id)))
+	}
+	return int(id), nil
+}
+
+type grpcPersonServer struct {
+	erpv1.UnimplementedPersonServiceServer
+	service personService
+}
+
+func (s *grpcPersonServer) ListPersons(ctx context.Context, req *erpv1.ListPersonsRequest) (*erpv1.ListPersonsResponse, error) {
+	filter := PersonFilter{Q: req.GetQ(), Dni: req.GetDni(), Email: req.GetEmail()}
+	if req.GetApplicationId() != 0 {
+		iid, err := grpcID("application_id", req.GetApplicationId())
+		if err != nil {
+			return nil, err
+		}
+		filter.AuthClientID = iid
+	}
+
+	list, err := s.service.List(ctx, filter)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &erpv1.ListPersonsResponse{Items: make([]*erpv1.Person, 0, len(list.Items))}
+	for _, p := range list.Items {
+		res.Items = append(res.Items, personProto(p))
+	}
+	return res, nil
+}
+
+func (s *grpcPersonServer) GetPerson(ctx context.Context, req *erpv1.GetPersonRequest) (*erpv1.PersonDetail, error) {
+	iid, err := grpcID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	detail, err := s.service.Get(ctx, iid)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &erpv1.PersonDetail{Person: personProto(detail.PersonResource)}
+	for _, m := range detail.Memberships {
+		res.Memberships = append(res.Memberships, membershipProto(m))
+	}
+	return res, nil
+}
+
+func (s *grpcPersonServer) CreatePerson(ctx context.Context, req *erpv1.CreatePersonRequest) (*erpv1.Person, error) {
+	created, err := s.service.Create(ctx, personWriteResource(req.GetPerson()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return personProto(*created), nil
+}
+
+func (s *grpcPersonServer) UpdatePerson(ctx context.Context, req *erpv1.UpdatePersonRequest) (*erpv1.Person, error) {
+	iid, err := grpcID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.service.Update(ctx, iid, personWriteResource(req.GetPerson()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return personProto(*updated), nil
+}
+
+func (s *grpcPersonServer) DeletePerson(ctx context.Context, req *erpv1.DeletePersonRequest) (*emptypb.Empty, error) {
+	iid, err := grpcID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.Delete(ctx, iid); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+type grpcApplicationServer struct {
+	erpv1.UnimplementedApplicationServiceServer
+	service applicationService
+}
+
+func (s *grpcApplicationServer) ListApplications(ctx context.Context, req *erpv1.ListApplicationsRequest) (*erpv1.ListApplicationsResponse, error) {
+	list, err := s.service.List(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &erpv1.ListApplicationsResponse{Items: make([]*erpv1.Application, 0, len(list.Items))}
+	for _, app := range list.Items {
+		res.Items = append(res.Items, applicationProto(app))
+	}
+	return res, nil
+}
+
+func (s *grpcApplicationServer) GetApplication(ctx context.Context, req *erpv1.GetApplicationRequest) (*erpv1.ApplicationDetail, error) {
+	iid, err := grpcID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	detail, err := s.service.Get(ctx, iid)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &erpv1.ApplicationDetail{Application: applicationProto(detail.ApplicationResource)}
+	for _, m := range detail.Memberships {
+		res.Memberships = append(res.Memberships, membershipProto(m))
+	}
+	return res, nil
+}
+
+func (s *grpcApplicationServer) CreateApplication(ctx context.Context, req *erpv1.CreateApplicationRequest) (*erpv1.Application, error) {
+	created, err := s.service.Create(ctx, applicationWriteResource(req.GetApplication()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return applicationProto(*created), nil
+}
+
+func (s *grpcApplicationServer) UpdateApplication(ctx context.Context, req *erpv1.UpdateApplicationRequest) (*erpv1.Application, error) {
+	iid, err := grpcID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.service.Update(ctx, iid, applicationWriteResource(req.GetApplication()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return applicationProto(*updated), nil
+}
+
+func (s *grpcApplicationServer) DeleteApplication(ctx context.Context, req *erpv1.DeleteApplicationRequest) (*emptypb.Empty, error) {
+	iid, err := grpcID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.Delete(ctx, iid); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcApplicationServer) SetApplicationStatus(ctx context.Context, req *erpv1.SetApplicationStatusRequest) (*erpv1.Application, error) {
+	iid, err := grpcID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.service.SetStatus(ctx, iid, api.ApplicationStatusWriteResource{Status: req.GetStatus(), Reason: req.Reason})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return applicationProto(*updated), nil
+}
+
+type grpcMembershipServer struct {
+	erpv1.UnimplementedMembershipServiceServer
+	service membershipService
+}
+
+// membershipIDs valida el par persona/aplicación de las llamadas de MembershipService
+func membershipIDs(personID, applicationID int64) (int, int, error) {
+	iidPer, err := grpcID("person_id", personID)
+	if err != nil {
+		return 0, 0, err
+	}
+	iidApp, err := grpcID("application_id", applicationID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return iidPer, iidApp, nil
+}
+
+func (s *grpcMembershipServer) GetMembership(ctx context.Context, req *erpv1.GetMembershipRequest) (*erpv1.Membership, error) {
+	iidPer, iidApp, err := membershipIDs(req.GetPersonId(), req.GetApplicationId())
+	if err != nil {
+		return nil, err
+	}
+
+	membership, err := s.service.Get(ctx, iidPer, iidApp)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return membershipProto(*membership), nil
+}
+
+func (s *grpcMembershipServer) SetMembership(ctx context.Context, req *erpv1.SetMembershipRequest) (*erpv1.SetMembershipResponse, error) {
+	iidPer, iidApp, err := membershipIDs(req.GetPersonId(), req.GetApplicationId())
+	if err != nil {
+		return nil, err
+	}
+
+	var sent api.MembershipWriteResource
+	if req.GetProfile() != nil {
+		if sent.Profile, err = req.GetProfile().MarshalJSON(); err != nil {
+			return nil, grpcError(newProblem(http.StatusBadRequest, api.ProblemValidation, `El profile no es válido`,
+				api.ProblemFieldError{Field: "profile", Message: err.Error()}))
+		}
+	}
+
+	membership, created, err := s.service.Set(ctx, iidPer, iidApp, sent)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &erpv1.SetMembershipResponse{Membership: membershipProto(*membership), Created: created}, nil
+}
+
+func (s *grpcMembershipServer) DeleteMembership(ctx context.Context, req *erpv1.DeleteMembershipRequest) (*emptypb.Empty, error) {
+	iidPer, iidApp, err := membershipIDs(req.GetPersonId(), req.GetApplicationId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.Delete(ctx, iidPer, iidApp); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcMembershipServer) CreateSession(ctx context.Context, req *erpv1.CreateSessionRequest) (*erpv1.Session, error) {
+	iidPer, iidApp, err := membershipIDs(req.GetPersonId(), req.GetApplicationId())
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.service.CreateSession(ctx, iidPer, iidApp, api.SessionWriteResource{RedirectUri: req.GetRedirectUri()})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &erpv1.Session{Code: session.Code, RedirectUri: session.RedirectUri, ExpiresInMin: int32(session.ExpiresInMin)}, nil
+}
+
+func personProto(p api.PersonResource) *erpv1.Person {
+	return &erpv1.Person{
+		Id:        int64(p.ID),
+		Dni:       p.Dni,
+		Nombre:    p.Nombre,
+		Apellidos: p.Apellidos,
+		Email:     p.Email,
+		Telefono:  p.Telefono,
+		CreatedAt: timestamppb.New(p.CreatedAt),
+	}
+}
+
+func personWriteResource(p *erpv1.PersonWrite) api.PersonWriteResource {
+	return api.PersonWriteResource{
+		Dni:       p.GetDni(),
+		Nombre:    p.GetNombre(),
+		Apellidos: p.GetApellidos(),
+		Email:     p.GetEmail(),
+		Telefono:  p.Telefono,
+	}
+}
+
+func applicationProto(app api.ApplicationResource) *erpv1.Application {
+	return &erpv1.Application{
+		Id:                     int64(app.ID),
+		ClientId:               app.ClientID,
+		ClientUrl:              app.ClientUrl,
+		ClientUrlCallback:      app.ClientUrlCallback,
+		BackchannelLogoutUrl:   app.BackchannelLogoutUrl,
+		RedirectUris:           app.RedirectUris,
+		PostLogoutRedirectUris: app.PostLogoutRedirectUris,
+		TlsClientSubject:       app.TlsClientSubject,
+		CreatedAt:              app.CreatedAt,
+		ClientSecret:           app.ClientSecret,
+		AllowedScopes:          app.AllowedScopes,
+		GrantTypes:             app.GrantTypes,
+		LogoUrl:                app.LogoUrl,
+		Description:            app.Description,
+		OwnerName:              app.OwnerName,
+		OwnerEmail:             app.OwnerEmail,
+		Status:                 app.Status,
+		StatusReason:           app.StatusReason,
+		StatusChangedAt:        app.StatusChangedAt,
+	}
+}
+
+func applicationWriteResource(app *erpv1.ApplicationWrite) api.ApplicationWriteResource {
+	return api.ApplicationWriteResource{
+		ClientID:               app.GetClientId(),
+		ClientUrl:              app.GetClientUrl(),
+		ClientUrlCallback:      app.ClientUrlCallback,
+		BackchannelLogoutUrl:   app.BackchannelLogoutUrl,
+		RedirectUris:           app.GetRedirectUris(),
+		PostLogoutRedirectUris: app.GetPostLogoutRedirectUris(),
+		TlsClientSubject:       app.TlsClientSubject,
+		AllowedScopes:          app.GetAllowedScopes(),
+		GrantTypes:             app.GetGrantTypes(),
+		LogoUrl:                app.LogoUrl,
+		Description:            app.Description,
+		OwnerName:              app.OwnerName,
+		OwnerEmail:             app.OwnerEmail,
+		RotateSecret:           app.GetRotateSecret(),
+	}
+}
+
+// membershipProto pasa el profile JSON a Struct; un profile null o que no sea un objeto no se envía
+func membershipProto(m api.MembershipResource) *erpv1.Membership {
+	res := &erpv1.Membership{
+		Id:            int64(m.ID),
+		PersonId:      int64(m.PersonID),
+		ApplicationId: int64(m.ApplicationID),
+		CreatedAt:     timestamppb.New(m.CreatedAt),
+	}
+	var profile map[string]any
+	if err := json.Unmarshal(m.Profile, &profile); err == nil && profile != nil {
+		if st, err := structpb.NewStruct(profile); err == nil {
+			res.Profile = st
+		}
+	}
+	if m.Application != nil {
+		res.Application = &erpv1.ApplicationSummary{
+			Id:        int64(m.Application.ID),
+			ClientId:  m.Application.ClientID,
+			ClientUrl: m.Application.ClientUrl,
+		}
+	}
+	if m.Person != nil {
+		res.Person = personProto(*m.Person)
+	}
+	return res
+}
+
+// grpcServe arranca el servidor gRPC en segundo plano; los errores al escuchar van a serveErr
+func grpcServe(srv *grpc.Server, addr string, serveErr chan<- error) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		slog.Info("Servidor gRPC iniciado", "addr", addr)
+		if err := srv.Serve(lis); err != nil {
+			serveErr <- err
+		}
+	}()
+	return nil
+}
+
+// grpcStop espera a las llamadas en curso hasta el plazo y después corta las que queden
+func grpcStop(ctx context.Context, srv *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("Llamadas gRPC sin terminar al agotar el plazo", "error", ctx.Err())
+		srv.Stop()
+	}
+}
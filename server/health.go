@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// schemaVersion es la versión del esquema que espera este binario; se incrementa
+// cada vez que initTables crea o modifica tablas o columnas
+const schemaVersion = 6
+
+// initTableSchemaVersion crea la tabla "schema_version" y registra la versión actual
+func initTableSchemaVersion(db *sql.DB) error {
+
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			id INT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+			version INT NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`
+
+	// Ejecuta la creación de la tabla
+	_, err := db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al crear la tabla schema_version: %v", err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO schema_version (id, version) VALUES (1, $1)
+		ON CONFLICT (id) DO UPDATE SET version = EXCLUDED.version, updated_at = CURRENT_TIMESTAMP
+			WHERE schema_version.version < EXCLUDED.version;`, schemaVersion)
+	if err != nil {
+		return fmt.Errorf("error al registrar la versión del esquema: %v", err)
+	}
+
+	return nil
+}
+
+func dropTableSchemaVersion(db *sql.DB) error {
+
+	// SQL para eliminar la tabla "schema_version"
+	dropTableSQL := `DROP TABLE IF EXISTS schema_version;`
+
+	// Ejecuta la eliminación de la tabla
+	_, err := db.Exec(dropTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al eliminar la tabla schema_version: %v", err)
+	}
+	return nil
+}
+
+// HealthCheck es el resultado de comprobar una dependencia
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	Detail    any     `json:"detail,omitempty"`
+}
+
+type HealthReport struct {
+	Status    string                 `json:"status"`
+	Checks    map[string]HealthCheck `json:"checks"`
+	CheckedAt time.Time              `json:"checked_at"`
+}
+
+const (
+	healthOk   = "ok"
+	healthFail = "fail"
+)
+
+// readiness comprueba las dependencias y guarda el resultado durante un tiempo
+// para que las sondas de Kubernetes no carguen la base de datos ni el servicio de autenticación
+type readiness struct {
+	db      *sql.DB
+	client  *http.Client
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu     sync.Mutex
+	report *HealthReport
+}
+
+// newReadiness configura la comprobación con la sección readyz de la configuración
+func newReadiness(db *sql.DB, config ReadyzConfig) *readiness {
+	return &readiness{
+		db:      db,
+		client:  &http.Client{Timeout: config.Timeout.D()},
+		ttl:     config.CacheTTL.D(),
+		timeout: config.Timeout.D(),
+	}
+}
+
+// check devuelve el último informe si sigue vigente o vuelve a comprobar las dependencias
+func (rd *readiness) check(ctx context.Context) HealthReport {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	if rd.report != nil && time.Since(rd.report.CheckedAt) < rd.ttl {
+		return *rd.report
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rd.timeout)
+	defer cancel()
+
+	checks := map[string]HealthCheck{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	run := func(name string, fn func(context.Context) HealthCheck) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			c := fn(ctx)
+			c.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+			mu.Lock()
+			checks[name] = c
+			mu.Unlock()
+		}()
+	}
+	run("database", rd.checkDatabase)
+	run("schema", rd.checkSchema)
+	run("auth_service", rd.checkAuthService)
+	wg.Wait()
+
+	report := HealthReport{Status: healthOk, Checks: checks, CheckedAt: time.Now()}
+	for _, c := range checks {
+		if c.Status != healthOk {
+			report.Status = healthFail
+		}
+	}
+	rd.report = &report
+	return report
+}
+
+func (rd *readiness) checkDatabase(ctx context.Context) HealthCheck {
+	if err := rd.db.PingContext(ctx); err != nil {
+		return HealthCheck{Status: healthFail, Error: err.Error()}
+	}
+	stats := rd.db.Stats()
+	return HealthCheck{Status: healthOk, Detail: map[string]int{
+		"open_connections": stats.OpenConnections,
+		"in_use":           stats.InUse,
+		"idle":             stats.Idle,
+	}}
+}
+
+func (rd *readiness) checkSchema(ctx context.Context) HealthCheck {
+	detail := map[string]int{"expected": schemaVersion}
+	var version int
+	err := rd.db.QueryRowContext(ctx, `SELECT version FROM schema_version WHERE id = 1;`).Scan(&version)
+	if err != nil {
+		return HealthCheck{Status: healthFail, Error: fmt.Sprintf("no se pudo leer la versión del esquema: %v", err), Detail: detail}
+	}
+	detail["version"] = version
+	if version < schemaVersion {
+		return HealthCheck{Status: healthFail, Error: "el esquema no está actualizado, ejecutar /init", Detail: detail}
+	}
+	return HealthCheck{Status: healthOk, Detail: detail}
+}
+
+// checkAuthService solo comprueba que el servicio responde: un 401 sin token es una respuesta válida
+func (rd *readiness) checkAuthService(ctx context.Context) HealthCheck {
+	url := appConfig.Auth.ProfileURL
+	if url == "" {
+		return HealthCheck{Status: healthFail, Error: "la variable de entorno AUTH_PROFILE_URL no está definida"}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return HealthCheck{Status: healthFail, Error: err.Error()}
+	}
+	resp, err := rd.client.Do(req)
+	if err != nil {
+		return HealthCheck{Status: healthFail, Error: err.Error()}
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return HealthCheck{Status: healthFail, Error: fmt.Sprintf("código de estado %d", resp.StatusCode)}
+	}
+	return HealthCheck{Status: healthOk, Detail: map[string]int{"status_code": resp.StatusCode}}
+}
+
+// livezHandler indica que el proceso está vivo; no depende de nada externo
+// para que Kubernetes no reinicie el pod por una caída de la base de datos
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// readyzHandler devuelve 503 si alguna dependencia falla, con el detalle por dependencia
+func readyzHandler(rd *readiness) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// durante el apagado se deja de recibir tráfico aunque las dependencias estén bien
+		if lifecycle.IsStopping() {
+			errJsonStatus(w, `El servidor se está deteniendo`, http.StatusServiceUnavailable)
+			return
+		}
+
+		report := rd.check(r.Context())
+
+		jsonData, err := json.Marshal(report)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != healthOk {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(jsonData)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// serverLifecycle coordina el apagado ordenado: avisa a los streams y trabajos en
+// segundo plano de que el servidor se detiene y espera a que terminen
+type serverLifecycle struct {
+	wg       sync.WaitGroup
+	stopping chan struct{}
+	once     sync.Once
+}
+
+var lifecycle = &serverLifecycle{stopping: make(chan struct{})}
+
+// Go lanza un trabajo en segundo plano al que se espera en el apagado
+func (l *serverLifecycle) Go(fn func()) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		fn()
+	}()
+}
+
+// Stopping se cierra cuando empieza el apagado
+func (l *serverLifecycle) Stopping() <-chan struct{} {
+	return l.stopping
+}
+
+func (l *serverLifecycle) IsStopping() bool {
+	select {
+	case <-l.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// BeginStop marca el inicio del apagado; se puede llamar varias veces
+func (l *serverLifecycle) BeginStop() {
+	l.once.Do(func() { close(l.stopping) })
+}
+
+// Wait espera a los trabajos en segundo plano hasta el plazo del contexto
+func (l *serverLifecycle) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Logs estructurados en JSON con log/slog. El nivel se elige con log.level / LOG_LEVEL
+// (debug, info, warn, error) y los atributos sensibles se redactan por nombre.
+
+// claves que nunca se escriben en claro; log.redact_keys / LOG_REDACT_KEYS añade más
+var logRedactKeys = map[string]bool{
+	"authorization":           true,
+	"token":                   true,
+	"auth_token":              true,
+	"secret":                  true,
+	"client_secret":           true,
+	"password":                true,
+	"auth_super_secret_token": true,
+	"dni":                     true,
+	"email":                   true,
+	"telefono":                true,
+}
+
+const logRedacted = "[REDACTED]"
+
+// initLogger instala el logger JSON por defecto; log.Printf también pasa por él
+func initLogger(config LogConfig) {
+	level := slog.LevelInfo
+	switch strings.ToLower(config.Level) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+
+	for _, key := range config.RedactKeys {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			logRedactKeys[key] = true
+		}
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: logRedactAttr,
+	})
+	slog.SetDefault(slog.New(handler))
+}
+
+// logFatal registra el error y termina el proceso; sustituye a log.Fatal en el arranque
+func logFatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func logRedactAttr(groups []string, a slog.Attr) slog.Attr {
+	if logRedactKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, logRedacted)
+	}
+	return a
+}
+
+type requestInfoKey struct{}
+
+// requestInfo viaja en el contexto de la petición; withAuth rellena el principal
+type requestInfo struct {
+	ID        string
+	Principal string
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// requestLogger devuelve el logger con el id de la petición, para usar desde los manejadores
+func requestLogger(ctx context.Context) *slog.Logger {
+	if info := requestInfoFrom(ctx); info != nil {
+		return slog.Default().With("request_id", info.ID)
+	}
+	return slog.Default()
+}
+
+// setRequestPrincipal anota quién hace la petición para el log de acceso
+func setRequestPrincipal(r *http.Request, principal string) {
+	if info := requestInfoFrom(r.Context()); info != nil {
+		info.Principal = principal
+	}
+}
+
+// requestID respeta el X-Request-ID recibido si es razonable, si no genera uno
+func requestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-ID")
+	if id != "" && len(id) <= 128 && !strings.ContainsFunc(id, func(c rune) bool { return c < 0x21 || c > 0x7e }) {
+		return id
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder captura el código de estado y los bytes escritos
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Flush permite el streaming (SSE, exportaciones) a través del envoltorio
+func (s *statusRecorder) Flush() {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap deja a http.ResponseController llegar al ResponseWriter original
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Middleware para registrar solicitudes HTTP
+func withLogging(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		info := &requestInfo{ID: requestID(r)}
+		w.Header().Set("X-Request-ID", info.ID)
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+
+		rec := &statusRecorder{ResponseWriter: w}
+
+		// Ejecutar el manejador original
+		handler(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		} else if rec.status >= 400 {
+			level = slog.LevelWarn
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("request_id", info.ID),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("principal", info.Principal),
+			slog.String("trace_id", traceIDFrom(r.Context())),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	}
+}
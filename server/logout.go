@@ -0,0 +1,515 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+	CREATE TABLE IF NOT EXISTS erp_app_sessions (
+		id SERIAL PRIMARY KEY,
+		person_id INT NOT NULL,
+		auth_client_id INT NOT NULL,
+		redirect_uri VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		ended_at TIMESTAMP,
+		...
+	);
+
+	CREATE TABLE IF NOT EXISTS logout_deliveries (
+		id SERIAL PRIMARY KEY,
+		person_id INT NOT NULL,
+		auth_client_id INT NOT NULL,
+		url VARCHAR(255) NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		...
+	);
+*/
+
+// reintentos de la notificación back-channel a cada aplicación
+const (
+	logoutMaxAttempts  = 5
+	logoutFirstBackoff = time.Second
+	logoutHttpTimeout  = 5 * time.Second
+)
+
+type LogoutDelivery struct {
+	ID             int        `json:"id"`
+	PersonID       int        `json:"person_id"`
+	AuthClientId   int        `json:"auth_client_id"`
+	Url            string     `json:"url"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// LogoutNotification es el cuerpo que se envía a la aplicación por back-channel
+type LogoutNotification struct {
+	Event    string `json:"event"`
+	PersonID int    `json:"person_id"`
+	ClientID string `json:"client_id"`
+	Iat      int64  `json:"iat"`
+}
+
+// initTableErpAppSessions crea la tabla "erp_app_sessions" si no existe
+// registra las sesiones emitidas en POST /persons/{id}/applications/{app_id}/session para poder cerrarlas;
+// no se llama auth_sessions porque ese nombre es del servicio de autenticación, que comparte la base de datos
+func initTableErpAppSessions(db *sql.DB) error {
+
+	// SQL para crear la tabla si no existe
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS erp_app_sessions (
+			id SERIAL PRIMARY KEY,
+			person_id INT NOT NULL,
+			auth_client_id INT NOT NULL,
+			redirect_uri VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			ended_at TIMESTAMP,
+			FOREIGN KEY (person_id) REFERENCES persons(id) ON DELETE CASCADE,
+			FOREIGN KEY (auth_client_id) REFERENCES auth_clients(id) ON DELETE CASCADE
+		);`
+
+	// Ejecuta la creación de la tabla
+	_, err := db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al crear la tabla erp_app_sessions: %v", err)
+	}
+
+	return nil
+}
+
+// initTableLogoutDeliveries crea la tabla "logout_deliveries" si no existe
+// es el registro de las notificaciones de logout enviadas a cada aplicación
+func initTableLogoutDeliveries(db *sql.DB) error {
+
+	// SQL para crear la tabla si no existe
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS logout_deliveries (
+			id SERIAL PRIMARY KEY,
+			person_id INT NOT NULL,
+			auth_client_id INT NOT NULL,
+			url VARCHAR(255) NOT NULL,
+			status VARCHAR(16) NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			last_status_code INT,
+			last_error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP,
+			FOREIGN KEY (person_id) REFERENCES persons(id) ON DELETE CASCADE,
+			FOREIGN KEY (auth_client_id) REFERENCES auth_clients(id) ON DELETE CASCADE,
+			CONSTRAINT status_check CHECK (status IN ('pending', 'delivered', 'failed'))
+		);`
+
+	// Ejecuta la creación de la tabla
+	_, err := db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al crear la tabla logout_deliveries: %v", err)
+	}
+
+	return nil
+}
+
+func dropTableLogoutDeliveries(db *sql.DB) error {
+
+	// SQL para eliminar la tabla "logout_deliveries"
+	dropTableSQL := `DROP TABLE IF EXISTS logout_deliveries;`
+
+	// Ejecuta la eliminación de la tabla
+	_, err := db.Exec(dropTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al eliminar la tabla logout_deliveries: %v", err)
+	}
+	return nil
+}
+
+// LogoutResult es la respuesta de POST /persons/{id}/logout
+type LogoutResult struct {
+	Message               string           `json:"message"`
+	PersonID              int              `json:"person_id"`
+	Applications          int              `json:"applications"`
+	Deliveries            []LogoutDelivery `json:"deliveries"`
+	PostLogoutRedirectUri string           `json:"post_logout_redirect_uri,omitempty"`
+}
+
+// logoutHandler cierra todas las sesiones de una persona: POST /persons/{id}/logout
+// opcionalmente valida ?client_id=...&post_logout_redirect_uri=... de la aplicación que lo inicia
+func logoutHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		// Obtiene el ID de la persona
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		// si la aplicación que inicia el logout pide volver a una URI, debe estar registrada
+		post_logout_redirect_uri, err := logoutRedirectUri(ctx, db, r.URL.Query().Get("client_id"), r.URL.Query().Get("post_logout_redirect_uri"))
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		person, err := postgres_person_by_id(ctx, db, iidPer)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la persona: %v`, err), http.StatusNotFound)
+			return
+		}
+
+		lapp, deliveries, err := logoutPerson(ctx, db, person.ID)
+		if errors.Is(err, errLogoutAuthService) {
+			errJsonStatus(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := LogoutResult{
+			Message:               "Sesiones cerradas",
+			PersonID:              person.ID,
+			Applications:          len(lapp),
+			Deliveries:            deliveries,
+			PostLogoutRedirectUri: post_logout_redirect_uri,
+		}
+
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al serializar los datos: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonData)
+	}
+}
+
+// errLogoutAuthService indica que el servicio de autenticación no revocó las sesiones
+var errLogoutAuthService = errors.New("Error al revocar las sesiones")
+
+// logoutRedirectUri resuelve la post_logout_redirect_uri de la aplicación que inicia el logout
+// ("" si no se indica aplicación o no hay URI a la que volver)
+func logoutRedirectUri(ctx context.Context, db *sql.DB, client_id, supplied string) (string, error) {
+	if client_id == "" {
+		return "", nil
+	}
+	app, err := postgres_auth_client_by_client_id(ctx, db, client_id)
+	if err != nil {
+		return "", fmt.Errorf(`Error al obtener la app: %v`, err)
+	}
+	if supplied == "" && len(app.PostLogoutRedirectUris) == 0 {
+		return "", nil
+	}
+	return resolveRedirectUri(app.PostLogoutRedirectUris, supplied)
+}
+
+// logoutPerson revoca las sesiones en el servicio de autenticación, cierra las locales y
+// programa en segundo plano las notificaciones back-channel; devuelve las aplicaciones afectadas
+func logoutPerson(ctx context.Context, db *sql.DB, person_id int) ([]AuthClient, []LogoutDelivery, error) {
+	// revoca las sesiones en el servicio de autenticación
+	if err := auth_service_delete_sessions(ctx, person_id); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errLogoutAuthService, err)
+	}
+
+	// cierra las sesiones locales y obtiene las aplicaciones afectadas
+	lapp, err := postgres_erp_app_sessions_end_by_person_id(ctx, db, person_id)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`Error al cerrar las sesiones: %v`, err)
+	}
+
+	// registra una entrega por cada aplicación con URL de back-channel
+	var deliveries []LogoutDelivery
+	for _, app := range lapp {
+		if app.BackchannelLogoutUrl == nil || *app.BackchannelLogoutUrl == "" {
+			continue
+		}
+		delivery, err := postgres_logout_delivery_insert(ctx, db, person_id, app.ID, *app.BackchannelLogoutUrl)
+		if err != nil {
+			return nil, nil, fmt.Errorf(`Error al registrar la notificación de logout: %v`, err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	// las notificaciones se envían en segundo plano con reintentos
+	if len(deliveries) > 0 {
+		deliverCtx := context.WithoutCancel(ctx)
+		lifecycle.Go(func() { logoutDeliver(deliverCtx, db, person_id, lapp, deliveries) })
+	}
+	return lapp, deliveries, nil
+}
+
+// logoutDeliveriesHandler devuelve el registro de entregas: /logout-deliveries?person_id=1&auth_client_id=2
+func logoutDeliveriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		person_id, err := queryIntParam(r, "person_id")
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		auth_client_id, err := queryIntParam(r, "auth_client_id")
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		list, err := postgres_logout_deliveries(ctx, db, person_id, auth_client_id)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener las entregas: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		jsonList, err := json.Marshal(list)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir las entregas a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonList)
+	}
+}
+
+// queryIntParam parsea un parámetro entero opcional de la query (0 si no viene)
+func queryIntParam(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("error al parsear %s: %v", name, err)
+	}
+	return i, nil
+}
+
+// logoutDeliver envía la notificación de logout a cada aplicación con backoff exponencial
+func logoutDeliver(ctx context.Context, db *sql.DB, person_id int, lapp []AuthClient, deliveries []LogoutDelivery) {
+
+	apps := make(map[int]AuthClient)
+	for _, app := range lapp {
+		apps[app.ID] = app
+	}
+
+	client := &http.Client{Timeout: logoutHttpTimeout}
+
+	for _, delivery := range deliveries {
+		app := apps[delivery.AuthClientId]
+		backoff := logoutFirstBackoff
+
+		for attempt := 1; attempt <= logoutMaxAttempts; attempt++ {
+			status_code, err := logoutNotify(client, delivery.Url, person_id, app)
+
+			status := "pending"
+			if err == nil {
+				status = "delivered"
+			} else if attempt == logoutMaxAttempts {
+				status = "failed"
+			}
+
+			if uerr := postgres_logout_delivery_update(ctx, db, delivery.ID, status, attempt, status_code, err); uerr != nil {
+				requestLogger(ctx).Error("logoutDeliver error al actualizar la entrega", "delivery_id", delivery.ID, "error", uerr)
+			}
+
+			if err == nil {
+				break
+			}
+			requestLogger(ctx).Warn("logoutDeliver intento fallido", "delivery_id", delivery.ID, "attempt", attempt, "max_attempts", logoutMaxAttempts, "url", delivery.Url, "error", err)
+
+			if attempt < logoutMaxAttempts {
+				select {
+				case <-time.After(backoff):
+				case <-lifecycle.Stopping():
+					// al apagar no se espera a los reintentos: la entrega queda pendiente
+					requestLogger(ctx).Info("logoutDeliver apagando, la entrega queda pendiente", "delivery_id", delivery.ID)
+					attempt = logoutMaxAttempts
+				}
+				backoff *= 2
+			}
+		}
+	}
+}
+
+// logoutNotify hace el POST back-channel; la aplicación se autentica con su client_secret
+func logoutNotify(client *http.Client, url string, person_id int, app AuthClient) (int, error) {
+
+	jsonData, err := json.Marshal(LogoutNotification{
+		Event:    "logout",
+		PersonID: person_id,
+		ClientID: app.ClientID,
+		Iat:      time.Now().Unix(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error al convertir los datos a JSON: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, fmt.Errorf("error al crear la solicitud HTTP: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if app.ClientSecret != nil && *app.ClientSecret != "" {
+		req.Header.Set("Authorization", "Bearer "+*app.ClientSecret)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error al realizar la solicitud HTTP: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("código de estado inesperado: %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func postgres_erp_app_session_insert(ctx context.Context, db *sql.DB, person_id, auth_client_id int, redirect_uri string, expires_in_min int) error {
+	ctx, span := startDbSpan(ctx, "postgres_erp_app_session_insert")
+	defer span.End()
+
+	query := `
+		INSERT INTO erp_app_sessions (person_id, auth_client_id, redirect_uri, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(mins => $4));`
+	_, err := db.ExecContext(ctx, query, person_id, auth_client_id, redirect_uri, expires_in_min)
+	return err
+}
+
+// postgres_erp_app_sessions_end_by_person_id marca como cerradas las sesiones activas
+// de la persona y devuelve las aplicaciones que tenían alguna
+func postgres_erp_app_sessions_end_by_person_id(ctx context.Context, db *sql.DB, person_id int) ([]AuthClient, error) {
+	ctx, span := startDbSpan(ctx, "postgres_erp_app_sessions_end_by_person_id")
+	defer span.End()
+
+	query := `
+		UPDATE
+			erp_app_sessions
+		SET
+			ended_at = CURRENT_TIMESTAMP
+		WHERE
+			person_id = $1 AND ended_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING auth_client_id;`
+	rows, err := db.QueryContext(ctx, query, person_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[int]bool)
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	var list []AuthClient
+	for _, id := range ids {
+		app, err := postgres_auth_client_by_id(ctx, db, id)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *app)
+	}
+	return list, nil
+}
+
+func postgres_logout_delivery_insert(ctx context.Context, db *sql.DB, person_id, auth_client_id int, url string) (*LogoutDelivery, error) {
+	ctx, span := startDbSpan(ctx, "postgres_logout_delivery_insert")
+	defer span.End()
+
+	query := `
+		INSERT INTO logout_deliveries (person_id, auth_client_id, url)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, attempts, created_at;`
+	item := LogoutDelivery{PersonID: person_id, AuthClientId: auth_client_id, Url: url}
+	err := db.QueryRowContext(ctx, query, person_id, auth_client_id, url).Scan(&item.ID, &item.Status, &item.Attempts, &item.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func postgres_logout_delivery_update(ctx context.Context, db *sql.DB, id int, status string, attempts int, status_code int, deliveryErr error) error {
+	ctx, span := startDbSpan(ctx, "postgres_logout_delivery_update")
+	defer span.End()
+
+	var last_status_code *int
+	if status_code != 0 {
+		last_status_code = &status_code
+	}
+	var last_error *string
+	if deliveryErr != nil {
+		msg := deliveryErr.Error()
+		last_error = &msg
+	}
+
+	query := `
+		UPDATE
+			logout_deliveries
+		SET
+			status = $1, attempts = $2,
+			last_status_code = $3, last_error = $4,
+			delivered_at = CASE WHEN $1 = 'delivered' THEN CURRENT_TIMESTAMP ELSE NULL END
+		WHERE id = $5;`
+	_, err := db.ExecContext(ctx, query, status, attempts, last_status_code, last_error, id)
+	return err
+}
+
+func postgres_logout_deliveries(ctx context.Context, db *sql.DB, person_id, auth_client_id int) ([]LogoutDelivery, error) {
+	ctx, span := startDbSpan(ctx, "postgres_logout_deliveries")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, person_id, auth_client_id, url,
+			status, attempts, last_status_code, last_error,
+			created_at, delivered_at
+		FROM
+			logout_deliveries
+		WHERE
+			($1 = 0 OR person_id = $1) AND ($2 = 0 OR auth_client_id = $2)
+		ORDER BY id DESC;`
+	rows, err := db.QueryContext(ctx, query, person_id, auth_client_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []LogoutDelivery{}
+	for rows.Next() {
+		var item LogoutDelivery
+		if err := rows.Scan(&item.ID, &item.PersonID, &item.AuthClientId, &item.Url,
+			&item.Status, &item.Attempts, &item.LastStatusCode, &item.LastError,
+			&item.CreatedAt, &item.DeliveredAt); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"dummy-corp-erp-server/api"
+	_ "github.com/lib/pq"
+	"google.golang.org/grpc"
+)
+
+// Main arranca el servidor; el binario (main.go en la raíz) solo la llama
+func Main() {
+
+	// `config print` muestra la configuración efectiva sin secretos
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		os.Exit(configPrintCommand())
+	}
+
+	// Configuración: valores por defecto, CONFIG_FILE y variables de entorno
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	appConfig = cfg
+
+	// Logs estructurados en JSON
+	initLogger(cfg.Log)
+
+	// Pool de conexiones compartido
+	db, err := openDatabasePool(cfg.Postgres)
+	if err != nil {
+		logFatal("error al abrir la base de datos", err)
+	}
+
+	// token de autenticación estático
+	auth_token := cfg.Auth.Token
+
+	// inyección de fallos opcional (desactivada salvo chaos.enabled)
+	chaosInit(cfg.Chaos)
+
+	// Trazas OpenTelemetry
+	ctx := context.Background()
+	shutdownTracing, err := initTracing(ctx, cfg.Tracing)
+	if err != nil {
+		logFatal("error al iniciar las trazas", err)
+	}
+
+	// Rutas en un ServeMux propio, no en el global de net/http
+	mux := http.NewServeMux()
+
+	// Métricas Prometheus
+	initMetrics(db)
+	mux.Handle("/metrics", metricsHandler())
+
+	// Sondas de Kubernetes: /livez solo el proceso, /readyz las dependencias
+	ready := newReadiness(db, cfg.Readyz)
+	mux.HandleFunc("/livez", livezHandler)
+	mux.HandleFunc("/readyz", readyzHandler(ready))
+	mux.HandleFunc("/healthz", livezHandler)
+
+	// Limitación de peticiones e intentos de autenticación
+	rateLimitInit(cfg.RateLimit, cfg.Redis)
+
+	// Política CORS: orígenes configurados y los de las aplicaciones registradas
+	cors := newCorsPolicy(db, cfg.CORS)
+
+	// Manejadores de las rutas: patrones "MÉTODO /ruta/{param}"; el ServeMux responde 405 con Allow
+	routes := append(apiRoutes(db), apiV1Routes(db)...)
+	if cfg.Chaos.Enabled {
+		routes = append(routes, chaosAdminRoutes()...)
+	}
+	registerRoutes(mux, routes, cors, db, auth_token)
+
+	// Rutas antiguas (/person/{id}, /application/{id}, ...) marcadas como obsoletas
+	if cfg.LegacyRoutes.Enabled {
+		registerLegacyRoutes(mux, legacyRoutes(db), cfg.LegacyRoutes, cors, db, auth_token)
+	}
+
+	// Inicializa las tablas al arrancar solo si se pide; si no, con /init.
+	// Los datos de ejemplo van aparte, con postgres.seed_demo_data
+	if cfg.Postgres.InitOnStart {
+		if err := initTables(db); err != nil {
+			logFatal("error al inicializar las tablas", err)
+		}
+		if cfg.Postgres.SeedDemoData {
+			if err := seedDemoData(db); err != nil {
+				logFatal("error al cargar los datos de ejemplo", err)
+			}
+		}
+	}
+
+	// Envía en segundo plano los webhooks pendientes del outbox
+	lifecycle.Go(func() { webhookDispatcher(ctx, db) })
+
+	srv, err := newHttpServer(cfg, withRouteErrors(mux, cors))
+	if err != nil {
+		logFatal("error al crear el servidor HTTP", err)
+	}
+	shutdownTimeout := cfg.ShutdownTimeout.D()
+
+	// API gRPC en su propio puerto, con los mismos servicios que /api/v1
+	var grpcSrv *grpc.Server
+	if cfg.GRPC.ListenAddr != "" {
+		grpcSrv, err = newGrpcServer(cfg, db, auth_token)
+		if err != nil {
+			logFatal("error al crear el servidor gRPC", err)
+		}
+	}
+
+	// SIGTERM (Kubernetes) o SIGINT inician el apagado ordenado
+	sigCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Servidor iniciado", "addr", srv.Addr, "tls", srv.TLSConfig != nil)
+		if srv.TLSConfig != nil {
+			// los certificados los aporta srv.TLSConfig, con recarga en caliente
+			serveErr <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		serveErr <- srv.ListenAndServe()
+	}()
+	if grpcSrv != nil {
+		if err := grpcServe(grpcSrv, cfg.GRPC.ListenAddr, serveErr); err != nil {
+			logFatal("error al iniciar el servidor gRPC", err)
+		}
+	}
+
+	select {
+	case err := <-serveErr:
+		logFatal("el servidor se ha detenido", err)
+	case <-sigCtx.Done():
+	}
+	stop()
+
+	slog.Info("Apagando el servidor", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// primero se avisa a streams y trabajos, después se espera a las peticiones en curso
+	lifecycle.BeginStop()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error al esperar a las peticiones en curso", "error", err)
+	}
+	if grpcSrv != nil {
+		grpcStop(shutdownCtx, grpcSrv)
+	}
+	if err := lifecycle.Wait(shutdownCtx); err != nil {
+		slog.Warn("Trabajos en segundo plano sin terminar al agotar el plazo", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("Error al enviar las trazas pendientes", "error", err)
+	}
+	if err := db.Close(); err != nil {
+		slog.Warn("Error al cerrar el pool de base de datos", "error", err)
+	}
+	slog.Info("Servidor detenido")
+}
+
+func getAuthHandler(w http.ResponseWriter, r *http.Request) {
+	// la cache en el cliente podría ser de dos minutos
+	// w.Header().Set("Cache-Control", "public, max-age=120")
+	w.Write([]byte(`{"status": "success"}`))
+}
+
+// middleware para autenticación
+func withAuth(handler http.HandlerFunc, db *sql.DB, auth_token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// una IP que ha agotado los intentos fallidos espera antes de volver a probar
+		if rateLimitAuthBlocked(w, r) {
+			errJsonStatus(w, `Demasiados intentos de autenticación`, http.StatusTooManyRequests)
+			return
+		}
+
+		principal, ok := authenticate(r, db, auth_token)
+		if !ok {
+			errJsonStatus(w, `No autorizado`, http.StatusUnauthorized)
+			return
+		}
+		setRequestPrincipal(r, principal)
+
+		// Ejecutar el manejador original
+		handler(w, r)
+	}
+}
+
+// withMasterToken restringe la ruta al AUTH_TOKEN estático; va dentro de withAuth
+func withMasterToken(handler http.HandlerFunc, auth_token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != auth_token {
+			errJsonStatus(w, `Esta ruta requiere el token maestro`, http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// authenticate valida las credenciales de la petición y devuelve quién la hace; los fallos
+// cuentan para el límite de intentos. La comparten withAuth y el interceptor de gRPC.
+func authenticate(r *http.Request, db *sql.DB, auth_token string) (string, bool) {
+	authorizationHeader := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(authorizationHeader, "Bearer ")
+
+	// sin token, un certificado de cliente verificado (mTLS) identifica a la aplicación
+	if subject := tlsClientSubject(r); authorizationHeader == "" && subject != "" {
+		app, ok := mtls_autorizado(r, db, subject)
+		if !ok {
+			rateLimitAuthFailed(r)
+			return "", false
+		}
+		return "mtls:" + app.ClientID, true
+	}
+
+	if token != auth_token {
+		auth_profile, ok := oauth_token_autorizado(r, token)
+		if !ok || !oauth_client_activo(r, db, auth_profile.ClientID) {
+			rateLimitAuthFailed(r)
+			return "", false
+		}
+		return authProfilePrincipal(auth_profile), true
+	}
+	return "auth_token", true
+}
+
+// errJsonStatus responde {"error": msg}; en las rutas /api/v1 el mismo error sale como problema RFC 7807
+func errJsonStatus(w http.ResponseWriter, msg string, status int) {
+	if p, ok := w.(*problemWriter); ok {
+		p.problem(status, msg)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	data := map[string]string{"error": msg}
+	json.NewEncoder(w).Encode(data)
+}
+
+func oauth_token_autorizado(r *http.Request, token string) (*AuthProfileData, bool) {
+	logger := requestLogger(r.Context())
+
+	auth_profile, err := AuthProfile(r.Context(), token)
+	if err != nil {
+		logger.Debug("token no autorizado", "error", err)
+		return nil, false
+	}
+	if auth_profile == nil || auth_profile.ClientID == "" {
+		logger.Debug("token no autorizado: perfil sin client_id")
+		return nil, false
+	}
+	if api_client_autorizado(auth_profile.UserID, auth_profile.ClientID) {
+		return auth_profile, true
+	}
+
+	logger.Debug("token no autorizado para esta API", "client_id", auth_profile.ClientID, "user_id", auth_profile.UserID)
+	return auth_profile, false
+}
+
+// api_client_autorizado es la lista de clientes con acceso a la API, común a tokens y mTLS:
+// tokens de usuario del ERP y tokens de cliente del CRM
+func api_client_autorizado(user_id int, client_id string) bool {
+	if user_id != 0 {
+		// autorizaciones de usuario
+		return client_id == "ERP"
+	}
+	// autorizaciones de cliente
+	return client_id == "CRM"
+}
+
+// oauth_client_activo rechaza los tokens de aplicaciones suspendidas o retiradas; los client_id
+// que no están en auth_clients (p. ej. ERP) no tienen estado y se admiten
+func oauth_client_activo(r *http.Request, db *sql.DB, client_id string) bool {
+	logger := requestLogger(r.Context())
+
+	status, err := postgres_auth_client_status_by_client_id(r.Context(), db, client_id)
+	if err != nil {
+		logger.Warn("error al obtener el estado de la aplicación del token", "client_id", client_id, "error", err)
+		return false
+	}
+	if status != "" && status != api.ApplicationStatusActive {
+		logger.Info("token de una aplicación no activa", "client_id", client_id, "status", status)
+		return false
+	}
+	return true
+}
+
+// authProfilePrincipal identifica al usuario o cliente del token para los logs
+func authProfilePrincipal(p *AuthProfileData) string {
+	if p.UserID != 0 {
+		return fmt.Sprintf("user:%d@%s", p.UserID, p.ClientID)
+	}
+	return "client:" + p.ClientID
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Métricas Prometheus expuestas en /metrics
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "erp_http_requests_total",
+		Help: "Peticiones HTTP atendidas por ruta, método y código de estado.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "erp_http_request_duration_seconds",
+		Help:    "Duración de las peticiones HTTP por ruta y método.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	authServiceDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "erp_auth_service_request_duration_seconds",
+		Help:    "Duración de las llamadas al servicio de autenticación por operación.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	authServiceRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "erp_auth_service_requests_total",
+		Help: "Llamadas al servicio de autenticación por operación y resultado (ok, unauthorized, error).",
+	}, []string{"operation", "result"})
+
+	rateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "erp_rate_limited_total",
+		Help: "Peticiones rechazadas con 429 por regla (path y clave).",
+	}, []string{"path", "key"})
+
+	legacyRouteRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "erp_legacy_route_requests_total",
+		Help: "Peticiones a rutas obsoletas por prefijo, para saber cuándo se pueden retirar.",
+	}, []string{"prefix"})
+)
+
+// initMetrics registra los colectores; el pool de base de datos y los
+// contadores de negocio se leen en cada scrape
+func initMetrics(db *sql.DB) {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "erp"),
+		httpRequestsTotal,
+		httpRequestDuration,
+		authServiceDuration,
+		authServiceRequestsTotal,
+		rateLimitedTotal,
+		legacyRouteRequestsTotal,
+		&businessCollector{db: db},
+	)
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// middleware de métricas; route es el patrón registrado para no disparar la cardinalidad con ids
+func withMetrics(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		handler(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeAuthService registra la duración y el resultado de una llamada al servicio de autenticación
+func observeAuthService(operation string, start time.Time, err error) {
+	authServiceDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	result := "ok"
+	if err == errAuthUnauthorized {
+		result = "unauthorized"
+	} else if err != nil {
+		result = "error"
+	}
+	authServiceRequestsTotal.WithLabelValues(operation, result).Inc()
+}
+
+func observeRateLimited(rule RateLimitRule) {
+	rateLimitedTotal.WithLabelValues(rule.Path, rule.Key).Inc()
+}
+
+func observeLegacyRoute(prefix string) {
+	legacyRouteRequestsTotal.WithLabelValues(prefix).Inc()
+}
+
+// businessCollector publica contadores de negocio consultando la base de datos
+type businessCollector struct {
+	db *sql.DB
+}
+
+var (
+	businessPersonsDesc      = prometheus.NewDesc("erp_persons", "Número de personas.", nil, nil)
+	businessApplicationsDesc = prometheus.NewDesc("erp_applications", "Número de aplicaciones (auth_clients).", nil, nil)
+	businessMembershipsDesc  = prometheus.NewDesc("erp_memberships", "Número de accesos de personas a aplicaciones.", nil, nil)
+)
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- businessPersonsDesc
+	ch <- businessApplicationsDesc
+	ch <- businessMembershipsDesc
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var persons, applications, memberships int64
+	err := c.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT count(*) FROM persons),
+			(SELECT count(*) FROM auth_clients),
+			(SELECT count(*) FROM person_auth_client)
+		;`).Scan(&persons, &applications, &memberships)
+	if err != nil {
+		// sin tablas o sin base de datos no se publican los contadores
+		slog.Debug("businessCollector error", "error", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(businessPersonsDesc, prometheus.GaugeValue, float64(persons))
+	ch <- prometheus.MustNewConstMetric(businessApplicationsDesc, prometheus.GaugeValue, float64(applications))
+	ch <- prometheus.MustNewConstMetric(businessMembershipsDesc, prometheus.GaugeValue, float64(memberships))
+}
@@ -0,0 +1,448 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dummy-corp-erp-server/api"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// Especificación OpenAPI 3 de la API en /openapi.json, con Swagger UI en /docs/.
+// Los esquemas se generan por reflexión de los tipos que usan los manejadores (PersonData,
+// PersonPostData, AuthClient, AuthClientPostSent, PersonApp, los recursos v1, ...), de modo que
+// un campo nuevo aparece en la especificación sin tocar este fichero. Las operaciones se
+// describen en openapiOperations; openapi_test.go falla si no coinciden con la tabla de rutas.
+
+const openapiVersion = "3.0.3"
+
+type openapiOperation struct {
+	method, path string
+	tag, summary string
+	query        []openapiParam
+	body         any // valor del tipo del cuerpo, p. ej. PersonPostData{}; nil si no lleva
+	bodyOptional bool
+	responses    []openapiResponse
+}
+
+type openapiParam struct {
+	name, schema, description string
+}
+
+type openapiResponse struct {
+	status      int
+	description string
+	body        any // valor del tipo de la respuesta; nil sin cuerpo
+}
+
+// MessageResponse es la respuesta de las rutas sin versión que solo confirman la operación
+type MessageResponse struct {
+	Message string `json:"message"`
+	ID      int    `json:"id,omitempty"`
+}
+
+// ErrorResponse es el error de las rutas sin versión (errJsonStatus)
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// AuthStatus es la respuesta de GET /auth
+type AuthStatus struct {
+	Status string `json:"status"`
+}
+
+// openapiUndocumented son las rutas que quedan fuera de la especificación: GraphQL
+// publica su propio esquema, import/export y los streams SSE no son JSON, y el resto es de
+// administración o de la propia documentación
+var openapiUndocumented = map[string]bool{
+	"/persons/export":              true,
+	"/persons/import":              true,
+	"/persons/import/{id}":         true,
+	"/events/stream":               true,
+	apiV1Prefix + "/events/stream": true,
+	"/graphql":                     true,
+	"/admin/chaos":                 true,
+	"/init":                        true,
+	"/clean":                       true,
+	"/status":                      true,
+	"/openapi.json":                true,
+	"/docs/":                       true,
+}
+
+func openapiOk(body any) openapiResponse { return openapiResponse{http.StatusOK, "OK", body} }
+
+func openapiCreated(body any) openapiResponse {
+	return openapiResponse{http.StatusCreated, "Creado; Location apunta al recurso", body}
+}
+
+var (
+	openapiNoContent = openapiResponse{http.StatusNoContent, "Sin contenido", nil}
+	openapiMessage   = openapiOk(MessageResponse{})
+
+	openapiPersonFilters = []openapiParam{
+		{"q", "string", "busca en dni, nombre, apellidos y email"},
+		{"dni", "string", "coincidencia exacta"},
+		{"email", "string", "coincidencia exacta sin distinguir mayúsculas"},
+	}
+)
+
+// openapiOperations describe cada operación documentada de apiRoutes y apiV1Routes
+var openapiOperations = []openapiOperation{
+	{method: http.MethodGet, path: "/auth", tag: "auth", summary: "Comprueba el token", responses: []openapiResponse{openapiOk(AuthStatus{})}},
+
+	{method: http.MethodGet, path: "/persons", tag: "persons", summary: "Lista las personas",
+		query: append(openapiPersonFilters, openapiParam{"auth_client_id", "integer", "solo las personas con acceso a la aplicación"}), responses: []openapiResponse{openapiOk([]PersonData{})}},
+	{method: http.MethodPost, path: "/persons", tag: "persons", summary: "Da de alta una persona", body: PersonPostData{}, responses: []openapiResponse{openapiMessage}},
+	{method: http.MethodGet, path: "/persons/{id}", tag: "persons", summary: "Persona con sus aplicaciones", responses: []openapiResponse{openapiOk(PersonDetail{})}},
+	{method: http.MethodPut, path: "/persons/{id}", tag: "persons", summary: "Actualiza una persona", body: PersonData{}, responses: []openapiResponse{openapiMessage}},
+	{method: http.MethodDelete, path: "/persons/{id}", tag: "persons", summary: "Elimina una persona", responses: []openapiResponse{openapiMessage}},
+	{method: http.MethodPost, path: "/persons/{id}/logout", tag: "persons", summary: "Cierra todas las sesiones de la persona",
+		query:     []openapiParam{{"client_id", "string", "aplicación que inicia el logout"}, {"post_logout_redirect_uri", "string", "debe estar registrada en la aplicación"}},
+		responses: []openapiResponse{openapiOk(LogoutResult{})}},
+
+	{method: http.MethodGet, path: "/persons/{id}/applications/{app_id}", tag: "personapp", summary: "Pertenencia de la persona a la aplicación", responses: []openapiResponse{openapiOk(PersonAppDetail{})}},
+	{method: http.MethodPost, path: "/persons/{id}/applications/{app_id}", tag: "personapp", summary: "Da de alta a la persona en la aplicación", body: PersonApp{}, bodyOptional: true, responses: []openapiResponse{openapiOk(PersonApp{})}},
+	{method: http.MethodPut, path: "/persons/{id}/applications/{app_id}", tag: "personapp", summary: "Cambia el profile de la persona en la aplicación", body: PersonApp{}, responses: []openapiResponse{openapiMessage}},
+	{method: http.MethodDelete, path: "/persons/{id}/applications/{app_id}", tag: "personapp", summary: "Da de baja a la persona en la aplicación", responses: []openapiResponse{openapiMessage}},
+	{method: http.MethodPost, path: "/persons/{id}/applications/{app_id}/session", tag: "personapp-session", summary: "Crea el código de sesión de la persona en la aplicación",
+		query: []openapiParam{{"redirect_uri", "string", "una de las redirect_uris de la aplicación; obligatoria si tiene varias"}}, responses: []openapiResponse{openapiOk(PersonAppSession{})}},
+
+	{method: http.MethodGet, path: "/applications", tag: "applications", summary: "Lista las aplicaciones", responses: []openapiResponse{openapiOk([]AuthClient{})}},
+	{method: http.MethodPost, path: "/applications", tag: "applications", summary: "Registra una aplicación; client_secret solo se devuelve aquí", body: AuthClientPostSent{}, responses: []openapiResponse{openapiOk(api.ApplicationResource{})}},
+	{method: http.MethodGet, path: "/applications/{id}", tag: "applications", summary: "Aplicación con sus personas", responses: []openapiResponse{openapiOk(AuthClientDetail{})}},
+	{method: http.MethodPut, path: "/applications/{id}", tag: "applications", summary: "Actualiza una aplicación; los campos que no vienen se conservan y el secreto solo cambia con rotate_secret", body: AuthClientPutSent{}, responses: []openapiResponse{openapiOk(api.ApplicationResource{})}},
+	{method: http.MethodDelete, path: "/applications/{id}", tag: "applications", summary: "Elimina una aplicación sin pertenencias", responses: []openapiResponse{openapiMessage}},
+	{method: http.MethodPut, path: "/applications/{id}/status", tag: "applications", summary: "Suspende, retira o reactiva una aplicación", body: api.ApplicationStatusWriteResource{}, responses: []openapiResponse{openapiOk(api.ApplicationResource{})}},
+	{method: http.MethodGet, path: "/authini/{client_id}", tag: "authini", summary: "Prepara el inicio de sesión en la aplicación", responses: []openapiResponse{openapiOk(AuthIniData{})}},
+	{method: http.MethodGet, path: "/logout-deliveries", tag: "applications", summary: "Registro de entregas de logout por back-channel",
+		query: []openapiParam{{"person_id", "integer", ""}, {"auth_client_id", "integer", ""}}, responses: []openapiResponse{openapiOk([]LogoutDelivery{})}},
+
+	{method: http.MethodGet, path: "/webhooks", tag: "webhooks", summary: "Lista las suscripciones", query: []openapiParam{{"auth_client_id", "integer", ""}}, responses: []openapiResponse{openapiOk([]WebhookSubscription{})}},
+	{method: http.MethodPost, path: "/webhooks", tag: "webhooks", summary: "Crea una suscripción; el secreto solo se devuelve aquí", body: WebhookSubscriptionPostSent{}, responses: []openapiResponse{openapiOk(WebhookSubscription{})}},
+	{method: http.MethodGet, path: "/webhooks/{id}", tag: "webhooks", summary: "Suscripción sin el secreto", responses: []openapiResponse{openapiOk(WebhookSubscription{})}},
+	{method: http.MethodPut, path: "/webhooks/{id}", tag: "webhooks", summary: "Actualiza una suscripción", body: WebhookSubscriptionPostSent{}, responses: []openapiResponse{openapiMessage}},
+	{method: http.MethodDelete, path: "/webhooks/{id}", tag: "webhooks", summary: "Elimina una suscripción", responses: []openapiResponse{openapiMessage}},
+	{method: http.MethodGet, path: "/webhook-deliveries", tag: "webhooks", summary: "Estado de las entregas",
+		query: []openapiParam{{"subscription_id", "integer", ""}, {"status", "string", "pending, delivered o failed"}, {"limit", "integer", "1..1000, por defecto 100"}}, responses: []openapiResponse{openapiOk([]WebhookDelivery{})}},
+	{method: http.MethodPost, path: "/webhook-deliveries/{id}/retry", tag: "webhooks", summary: "Vuelve a poner en cola una entrega", responses: []openapiResponse{openapiMessage}},
+
+	{method: http.MethodGet, path: "/events", tag: "events", summary: "Cambios posteriores al cursor",
+		query: []openapiParam{{"since", "string", "cursor opaco (next_cursor de la página anterior)"}, {"limit", "integer", ""}, {"entity", "string", ""}}, responses: []openapiResponse{openapiOk(EventsPage{})}},
+
+	// API v1
+	{method: http.MethodGet, path: apiV1Prefix + "/persons", tag: "v1 persons", summary: "Lista las personas",
+		query: append(openapiPersonFilters, openapiParam{"application_id", "integer", "solo las personas con acceso a la aplicación"}), responses: []openapiResponse{openapiOk(api.ListResource[api.PersonResource]{})}},
+	{method: http.MethodPost, path: apiV1Prefix + "/persons", tag: "v1 persons", summary: "Da de alta una persona", body: api.PersonWriteResource{}, responses: []openapiResponse{openapiCreated(api.PersonResource{})}},
+	{method: http.MethodGet, path: apiV1Prefix + "/persons/{id}", tag: "v1 persons", summary: "Persona con sus pertenencias", responses: []openapiResponse{openapiOk(api.PersonDetailResource{})}},
+	{method: http.MethodPut, path: apiV1Prefix + "/persons/{id}", tag: "v1 persons", summary: "Sustituye los datos de una persona", body: api.PersonWriteResource{}, responses: []openapiResponse{openapiOk(api.PersonResource{})}},
+	{method: http.MethodDelete, path: apiV1Prefix + "/persons/{id}", tag: "v1 persons", summary: "Elimina una persona", responses: []openapiResponse{openapiNoContent}},
+	{method: http.MethodPost, path: apiV1Prefix + "/persons/{id}/logout", tag: "v1 persons", summary: "Cierra todas las sesiones de la persona", body: api.LogoutWriteResource{}, bodyOptional: true, responses: []openapiResponse{openapiOk(api.LogoutResource{})}},
+	{method: http.MethodGet, path: apiV1Prefix + "/persons/{id}/memberships/{application_id}", tag: "v1 memberships", summary: "Pertenencia de la persona a la aplicación", responses: []openapiResponse{openapiOk(api.MembershipResource{})}},
+	{method: http.MethodPut, path: apiV1Prefix + "/persons/{id}/memberships/{application_id}", tag: "v1 memberships", summary: "Da de alta la pertenencia o cambia su profile", body: api.MembershipWriteResource{}, bodyOptional: true,
+		responses: []openapiResponse{openapiOk(api.MembershipResource{}), openapiCreated(api.MembershipResource{})}},
+	{method: http.MethodDelete, path: apiV1Prefix + "/persons/{id}/memberships/{application_id}", tag: "v1 memberships", summary: "Da de baja la pertenencia", responses: []openapiResponse{openapiNoContent}},
+	{method: http.MethodPost, path: apiV1Prefix + "/persons/{id}/memberships/{application_id}/sessions", tag: "v1 memberships", summary: "Crea el código de sesión", body: api.SessionWriteResource{}, bodyOptional: true,
+		responses: []openapiResponse{{http.StatusCreated, "Creado", api.SessionResource{}}}},
+
+	{method: http.MethodGet, path: apiV1Prefix + "/applications", tag: "v1 applications", summary: "Lista las aplicaciones", responses: []openapiResponse{openapiOk(api.ListResource[api.ApplicationResource]{})}},
+	{method: http.MethodPost, path: apiV1Prefix + "/applications", tag: "v1 applications", summary: "Registra una aplicación; client_secret solo se devuelve aquí", body: api.ApplicationWriteResource{}, responses: []openapiResponse{openapiCreated(api.ApplicationResource{})}},
+	{method: http.MethodGet, path: apiV1Prefix + "/applications/{id}", tag: "v1 applications", summary: "Aplicación con sus pertenencias", responses: []openapiResponse{openapiOk(api.ApplicationDetailResource{})}},
+	{method: http.MethodPut, path: apiV1Prefix + "/applications/{id}", tag: "v1 applications", summary: "Sustituye los datos de una aplicación; el secreto se conserva salvo con rotate_secret", body: api.ApplicationWriteResource{}, responses: []openapiResponse{openapiOk(api.ApplicationResource{})}},
+	{method: http.MethodDelete, path: apiV1Prefix + "/applications/{id}", tag: "v1 applications", summary: "Elimina una aplicación sin pertenencias", responses: []openapiResponse{openapiNoContent}},
+	{method: http.MethodPut, path: apiV1Prefix + "/applications/{id}/status", tag: "v1 applications", summary: "Suspende, retira o reactiva una aplicación; las pertenencias se conservan", body: api.ApplicationStatusWriteResource{}, responses: []openapiResponse{openapiOk(api.ApplicationResource{})}},
+	{method: http.MethodGet, path: apiV1Prefix + "/authini/{client_id}", tag: "v1 applications", summary: "Prepara el inicio de sesión en la aplicación", responses: []openapiResponse{openapiOk(api.AuthIniResource{})}},
+	{method: http.MethodGet, path: apiV1Prefix + "/logout-deliveries", tag: "v1 applications", summary: "Registro de entregas de logout por back-channel",
+		query: []openapiParam{{"person_id", "integer", ""}, {"application_id", "integer", ""}}, responses: []openapiResponse{openapiOk(api.ListResource[api.LogoutDeliveryResource]{})}},
+
+	{method: http.MethodGet, path: apiV1Prefix + "/webhooks", tag: "v1 webhooks", summary: "Lista las suscripciones", query: []openapiParam{{"application_id", "integer", ""}}, responses: []openapiResponse{openapiOk(api.ListResource[api.WebhookResource]{})}},
+	{method: http.MethodPost, path: apiV1Prefix + "/webhooks", tag: "v1 webhooks", summary: "Crea una suscripción; el secreto solo se devuelve aquí", body: api.WebhookWriteResource{}, responses: []openapiResponse{openapiCreated(api.WebhookResource{})}},
+	{method: http.MethodGet, path: apiV1Prefix + "/webhooks/{id}", tag: "v1 webhooks", summary: "Suscripción sin el secreto", responses: []openapiResponse{openapiOk(api.WebhookResource{})}},
+	{method: http.MethodPut, path: apiV1Prefix + "/webhooks/{id}", tag: "v1 webhooks", summary: "Actualiza una suscripción", body: api.WebhookWriteResource{}, responses: []openapiResponse{openapiOk(api.WebhookResource{})}},
+	{method: http.MethodDelete, path: apiV1Prefix + "/webhooks/{id}", tag: "v1 webhooks", summary: "Elimina una suscripción", responses: []openapiResponse{openapiNoContent}},
+	{method: http.MethodGet, path: apiV1Prefix + "/webhook-deliveries", tag: "v1 webhooks", summary: "Estado de las entregas",
+		query: []openapiParam{{"subscription_id", "integer", ""}, {"status", "string", ""}, {"limit", "integer", "1..1000, por defecto 100"}}, responses: []openapiResponse{openapiOk(api.ListResource[WebhookDelivery]{})}},
+	{method: http.MethodPost, path: apiV1Prefix + "/webhook-deliveries/{id}/retry", tag: "v1 webhooks", summary: "Vuelve a poner en cola una entrega", responses: []openapiResponse{{http.StatusAccepted, "En cola", nil}}},
+
+	{method: http.MethodGet, path: apiV1Prefix + "/events", tag: "v1 events", summary: "Cambios posteriores al cursor",
+		query: []openapiParam{{"since", "string", ""}, {"limit", "integer", ""}, {"entity", "string", ""}}, responses: []openapiResponse{openapiOk(api.EventsPageResource{})}},
+
+	// SCIM 2.0 (RFC 7644): cuerpos y errores en application/scim+json
+	{method: http.MethodGet, path: "/scim/v2/ServiceProviderConfig", tag: "scim", summary: "Capacidades del servidor SCIM", responses: []openapiResponse{openapiOk(map[string]any{})}},
+	{method: http.MethodGet, path: "/scim/v2/Users", tag: "scim", summary: "Lista las personas como Users",
+		query: openapiScimListParams, responses: []openapiResponse{openapiOk(ScimListResponse{})}},
+	{method: http.MethodPost, path: "/scim/v2/Users", tag: "scim", summary: "Da de alta una persona", body: ScimUser{}, responses: []openapiResponse{openapiCreated(ScimUser{})}},
+	{method: http.MethodGet, path: "/scim/v2/Users/{id}", tag: "scim", summary: "Persona como User", responses: []openapiResponse{openapiOk(ScimUser{})}},
+	{method: http.MethodPut, path: "/scim/v2/Users/{id}", tag: "scim", summary: "Sustituye los datos de una persona; active=false revoca sus pertenencias", body: ScimUser{}, responses: []openapiResponse{openapiOk(ScimUser{})}},
+	{method: http.MethodPatch, path: "/scim/v2/Users/{id}", tag: "scim", summary: "Modifica una persona con operaciones PatchOp", body: ScimPatchRequest{}, responses: []openapiResponse{openapiOk(ScimUser{})}},
+	{method: http.MethodDelete, path: "/scim/v2/Users/{id}", tag: "scim", summary: "Elimina una persona", responses: []openapiResponse{openapiNoContent}},
+	{method: http.MethodGet, path: "/scim/v2/Groups", tag: "scim", summary: "Lista las aplicaciones como Groups",
+		query: openapiScimListParams, responses: []openapiResponse{openapiOk(ScimListResponse{})}},
+	{method: http.MethodPost, path: "/scim/v2/Groups", tag: "scim", summary: "No admitido: las aplicaciones se registran en /applications", responses: []openapiResponse{{http.StatusNotImplemented, "No implementado", ScimError{}}}},
+	{method: http.MethodGet, path: "/scim/v2/Groups/{id}", tag: "scim", summary: "Aplicación como Group con sus personas", responses: []openapiResponse{openapiOk(ScimGroup{})}},
+	{method: http.MethodPut, path: "/scim/v2/Groups/{id}", tag: "scim", summary: "Sustituye los miembros de la aplicación", body: ScimGroup{}, responses: []openapiResponse{openapiOk(ScimGroup{})}},
+	{method: http.MethodPatch, path: "/scim/v2/Groups/{id}", tag: "scim", summary: "Añade o quita miembros con operaciones PatchOp", body: ScimPatchRequest{}, responses: []openapiResponse{openapiOk(ScimGroup{})}},
+	{method: http.MethodDelete, path: "/scim/v2/Groups/{id}", tag: "scim", summary: "No admitido: las aplicaciones se eliminan en /applications", responses: []openapiResponse{{http.StatusNotImplemented, "No implementado", ScimError{}}}},
+}
+
+// openapiScimListParams son los parámetros de filtro y paginación de SCIM
+var openapiScimListParams = []openapiParam{
+	{"filter", "string", `p. ej. userName eq "jperez@mydomain.com"`},
+	{"startIndex", "integer", "desde 1"},
+	{"count", "integer", ""},
+}
+
+// openapiPathParam encuentra los parámetros {nombre} de una ruta
+var openapiPathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// openapiSpec genera el documento a partir de openapiOperations y los tipos de Go
+func openapiSpec() map[string]any {
+	schemas := openapiSchemas{}
+	paths := map[string]map[string]any{}
+
+	for _, op := range openapiOperations {
+		var params []map[string]any
+		for _, m := range openapiPathParam.FindAllStringSubmatch(op.path, -1) {
+			// client_id es el identificador textual de la aplicación; el resto son ids numéricos
+			typ := "integer"
+			if m[1] == "client_id" {
+				typ = "string"
+			}
+			params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": typ}})
+		}
+		for _, q := range op.query {
+			p := map[string]any{"name": q.name, "in": "query", "schema": map[string]any{"type": q.schema}}
+			if q.description != "" {
+				p["description"] = q.description
+			}
+			params = append(params, p)
+		}
+
+		// los errores de /api/v1 son problem+json, los de SCIM su propio formato y los de las
+		// rutas sin versión {"error": "..."}
+		contentType := "application/json"
+		errorType, errorSchema := "application/json", schemas.of(reflect.TypeOf(ErrorResponse{}))
+		switch {
+		case strings.HasPrefix(op.path, apiV1Prefix+"/"):
+			errorType, errorSchema = api.ProblemContentType, schemas.of(reflect.TypeOf(api.Problem{}))
+		case strings.HasPrefix(op.path, "/scim/v2/"):
+			contentType = "application/scim+json"
+			errorType, errorSchema = contentType, schemas.of(reflect.TypeOf(ScimError{}))
+		}
+		responses := map[string]any{
+			"default": map[string]any{"description": "Error", "content": map[string]any{errorType: map[string]any{"schema": errorSchema}}},
+		}
+		for _, res := range op.responses {
+			item := map[string]any{"description": res.description}
+			if res.body != nil {
+				item["content"] = map[string]any{contentType: map[string]any{"schema": schemas.of(reflect.TypeOf(res.body))}}
+			}
+			responses[strconv.Itoa(res.status)] = item
+		}
+
+		operation := map[string]any{
+			"tags":        []string{op.tag},
+			"summary":     op.summary,
+			"operationId": openapiOperationId(op.method, op.path),
+			"responses":   responses,
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.body != nil {
+			operation["requestBody"] = map[string]any{
+				"required": !op.bodyOptional,
+				"content":  map[string]any{contentType: map[string]any{"schema": schemas.of(reflect.TypeOf(op.body))}},
+			}
+		}
+
+		if paths[op.path] == nil {
+			paths[op.path] = map[string]any{}
+		}
+		paths[op.path][strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": openapiVersion,
+		"info": map[string]any{
+			"title":   "Dummy Corp ERP API",
+			"version": "1",
+			"description": "Personas, aplicaciones y sus pertenencias. Las rutas sin versión se mantienen por compatibilidad; " +
+				"las nuevas integraciones deben usar /api/v1. Las rutas antiguas (/person/, /application/, ...) no se documentan: " +
+				"responden con las cabeceras Deprecation y Sunset.",
+		},
+		// relativo al documento, para que funcione detrás del prefijo del ingress
+		"servers":  []map[string]any{{"url": "."}},
+		"security": []map[string]any{{"bearerAuth": []string{}}},
+		"paths":    paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Token de la aplicación (AUTH_TOKEN o perfil del servicio de autenticación); con mTLS basta el certificado de cliente",
+				},
+			},
+		},
+	}
+}
+
+// openapiOperationId genera un identificador estable: "GET /api/v1/persons/{id}" -> "getApiV1PersonsById"
+func openapiOperationId(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+		if m := openapiPathParam.FindStringSubmatch(part); m != nil {
+			b.WriteString("By")
+			part = m[1]
+		}
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// openapiSchemas son los esquemas de components/schemas, por nombre del tipo de Go
+type openapiSchemas map[string]any
+
+var (
+	openapiTimeType       = reflect.TypeOf(time.Time{})
+	openapiRawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// of devuelve el esquema del tipo; los structs con nombre se registran en components y se
+// referencian con $ref, los genéricos (ListResource[T]) se incluyen en línea
+func (s openapiSchemas) of(t reflect.Type) map[string]any {
+	switch {
+	case t == openapiTimeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == openapiRawMessageType:
+		return map[string]any{"description": "JSON libre"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.of(t.Elem())
+		if _, ref := schema["$ref"]; ref {
+			return schema
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int16, reflect.Int8, reflect.Uint, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" || strings.Contains(t.Name(), "[") {
+			return s.object(t)
+		}
+		if _, done := s[t.Name()]; !done {
+			s[t.Name()] = map[string]any{} // evita la recursión en tipos que se contienen
+			s[t.Name()] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+// object describe un struct a partir de sus etiquetas json: los campos con omitempty o
+// punteros son opcionales y los embebidos aportan sus campos
+func (s openapiSchemas) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				walk(field.Type)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = s.of(field.Type)
+			if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+	}
+	walk(t)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+var openapiDocument = sync.OnceValues(func() ([]byte, error) {
+	return json.MarshalIndent(openapiSpec(), "", "  ")
+})
+
+// openapiHandler sirve la especificación: GET /openapi.json
+func openapiHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := openapiDocument()
+	if err != nil {
+		errJsonStatus(w, `Error al generar la especificación: `+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// swaggerInitializer sustituye al de la distribución de Swagger UI para cargar nuestra
+// especificación; la ruta es relativa para que funcione detrás del prefijo del ingress
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "../openapi.json",
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// docsHandler sirve Swagger UI, incluido en el binario: GET /docs/
+func docsHandler() http.HandlerFunc {
+	files := http.StripPrefix("/docs/", http.FileServerFS(swaggerFiles.FS))
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/docs/swagger-initializer.js" {
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			w.Write([]byte(swaggerInitializer))
+			return
+		}
+		files.ServeHTTP(w, r)
+	}
+}
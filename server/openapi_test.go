@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIMatchesRoutes falla si una ruta de la API no está en la especificación o si la
+// especificación describe una operación que no existe
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	registered := map[string]bool{}
+	for _, rt := range append(apiRoutes(nil), apiV1Routes(nil)...) {
+		if openapiUndocumented[rt.path] {
+			continue
+		}
+		if rt.method == "" {
+			t.Errorf("la ruta %s admite cualquier método: documentarla por método o añadirla a openapiUndocumented", rt.path)
+			continue
+		}
+		registered[rt.pattern()] = true
+	}
+
+	documented := map[string]bool{}
+	for _, op := range openapiOperations {
+		pattern := op.method + " " + op.path
+		if documented[pattern] {
+			t.Errorf("operación duplicada en la especificación: %s", pattern)
+		}
+		documented[pattern] = true
+		if !registered[pattern] {
+			t.Errorf("la especificación describe %s, que no está en la tabla de rutas", pattern)
+		}
+	}
+	for pattern := range registered {
+		if !documented[pattern] {
+			t.Errorf("la ruta %s no está en la especificación (openapiOperations)", pattern)
+		}
+	}
+}
+
+// TestOpenAPISpec comprueba que el documento se sirve y que todas las referencias existen
+func TestOpenAPISpec(t *testing.T) {
+	rec := httptest.NewRecorder()
+	openapiHandler(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: estado %d", rec.Code)
+	}
+
+	var spec struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("la especificación no es JSON válido: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("versión de OpenAPI %q", spec.OpenAPI)
+	}
+	for _, name := range []string{"PersonData", "PersonPostData", "AuthClient", "AuthClientPostSent", "PersonApp"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("falta el esquema %s", name)
+		}
+	}
+
+	var refs []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, item := range v {
+				if ref, ok := item.(string); ok && k == "$ref" {
+					refs = append(refs, ref)
+				}
+				walk(item)
+			}
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	var doc any
+	json.Unmarshal(rec.Body.Bytes(), &doc)
+	walk(doc)
+	for _, ref := range refs {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("referencia sin esquema: %s", ref)
+		}
+	}
+
+	// cada parámetro {nombre} de la ruta debe estar declarado en la operación
+	for path, operations := range spec.Paths {
+		for method, op := range operations {
+			declared := map[string]bool{}
+			params, _ := op["parameters"].([]any)
+			for _, p := range params {
+				p := p.(map[string]any)
+				if p["in"] == "path" {
+					declared[p["name"].(string)] = true
+				}
+			}
+			for _, m := range openapiPathParam.FindAllStringSubmatch(path, -1) {
+				if !declared[m[1]] {
+					t.Errorf("%s %s: falta el parámetro de ruta %s", method, path, m[1])
+				}
+			}
+		}
+	}
+}
+
+func TestDocsHandler(t *testing.T) {
+	for path, want := range map[string]string{
+		"/docs/":                       "swagger-ui",
+		"/docs/swagger-initializer.js": "../openapi.json",
+	} {
+		rec := httptest.NewRecorder()
+		docsHandler()(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET %s: estado %d, sin %q", path, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"dummy-corp-erp-server/api"
+)
+
+/*
+	CREATE TABLE IF NOT EXISTS events_outbox (
+		id BIGSERIAL PRIMARY KEY,
+		event_type VARCHAR(64) NOT NULL,
+		entity VARCHAR(32) NOT NULL,
+		entity_id INT NOT NULL,
+		payload JSONB NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+*/
+
+// tipos de evento que se escriben en el outbox
+const (
+	eventPersonCreated     = "person.created"
+	eventPersonUpdated     = "person.updated"
+	eventPersonDeleted     = "person.deleted"
+	eventMembershipGranted = "membership.granted"
+	eventMembershipRevoked = "membership.revoked"
+	eventProfileChanged    = "profile.changed"
+
+	eventApplicationCreated = "application.created"
+	eventApplicationUpdated = "application.updated"
+	eventApplicationDeleted = "application.deleted"
+
+	eventApplicationSuspended   = "application.suspended"
+	eventApplicationRetired     = "application.retired"
+	eventApplicationReactivated = "application.reactivated"
+)
+
+// applicationStatusEvents es el evento de cada cambio de estado de una aplicación
+var applicationStatusEvents = map[string]string{
+	api.ApplicationStatusActive:    eventApplicationReactivated,
+	api.ApplicationStatusSuspended: eventApplicationSuspended,
+	api.ApplicationStatusRetired:   eventApplicationRetired,
+}
+
+// clave del advisory lock que serializa las escrituras en el outbox:
+// se mantiene hasta el commit, así los id quedan en orden de commit
+const outboxLockKey = 4711
+
+// entidades a las que se refieren los eventos
+const (
+	entityPerson     = "person"
+	entityPersonApp  = "person_auth_client"
+	entityAuthClient = "auth_client"
+)
+
+type OutboxEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Entity    string          `json:"entity"`
+	EntityID  int             `json:"entity_id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// initTableEventsOutbox crea la tabla "events_outbox" si no existe
+// cada mutación escribe aquí su evento en la misma transacción
+func initTableEventsOutbox(db *sql.DB) error {
+
+	// SQL para crear la tabla si no existe
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS events_outbox (
+			id BIGSERIAL PRIMARY KEY,
+			event_type VARCHAR(64) NOT NULL,
+			entity VARCHAR(32) NOT NULL,
+			entity_id INT NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`
+
+	// Ejecuta la creación de la tabla
+	_, err := db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al crear la tabla events_outbox: %v", err)
+	}
+
+	return nil
+}
+
+func dropTableEventsOutbox(db *sql.DB) error {
+
+	// SQL para eliminar la tabla "events_outbox"
+	dropTableSQL := `DROP TABLE IF EXISTS events_outbox;`
+
+	// Ejecuta la eliminación de la tabla
+	_, err := db.Exec(dropTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al eliminar la tabla events_outbox: %v", err)
+	}
+	return nil
+}
+
+// outboxEvent es un evento pendiente de escribir en el outbox
+type outboxEvent struct {
+	EventType string
+	Entity    string
+	EntityID  int
+	Data      any
+}
+
+// outbox_enqueue escribe el evento en el outbox dentro de la transacción de la mutación
+// y crea una entrega pendiente por cada suscripción de webhook interesada
+func outbox_enqueue(ctx context.Context, tx *sql.Tx, event_type string, entity string, entity_id int, data any) (int64, error) {
+	ids, err := outbox_enqueue_batch(ctx, tx, []outboxEvent{{EventType: event_type, Entity: entity, EntityID: entity_id, Data: data}})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// outbox_enqueue_batch escribe varios eventos tomando el bloqueo del outbox una sola vez;
+// las mutaciones masivas lo llaman al final para no retener el bloqueo durante toda la transacción
+func outbox_enqueue_batch(ctx context.Context, tx *sql.Tx, events []outboxEvent) ([]int64, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	// espera a que confirme o aborte cualquier otra transacción que esté escribiendo eventos
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1);`, outboxLockKey); err != nil {
+		return nil, fmt.Errorf("error al bloquear el outbox: %v", err)
+	}
+
+	query := `
+		INSERT INTO events_outbox (event_type, entity, entity_id, payload)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id;`
+
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		payload, err := json.Marshal(event.Data)
+		if err != nil {
+			return nil, fmt.Errorf("error al convertir el evento a JSON: %v", err)
+		}
+
+		var id int64
+		err = tx.QueryRow(query, event.EventType, event.Entity, event.EntityID, payload).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("error al insertar el evento en el outbox: %v", err)
+		}
+
+		err = postgres_webhook_deliveries_enqueue(ctx, tx, id, event.EventType)
+		if err != nil {
+			return nil, fmt.Errorf("error al encolar las entregas del evento: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
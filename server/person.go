@@ -0,0 +1,575 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// errPersonNotFound se devuelve envuelto cuando la persona no existe
+var errPersonNotFound = errors.New("persona no encontrada")
+
+type PersonData struct {
+	ID        int       `json:"id"`
+	Dni       string    `json:"dni"`
+	Nombre    string    `json:"nombre"`
+	Apellidos string    `json:"apellidos"`
+	Email     string    `json:"email"`
+	Telefono  *string   `json:"telefono,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func getPersonsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		filter, err := parsePersonFilter(r)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		list, err := postgres_persons_filtered(ctx, db, filter)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener las personas: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Convierte las personas a formato JSON
+		jsonList, err := json.Marshal(list)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir las personas a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con las personas en formato JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonList)
+	}
+}
+
+// PersonFilter son los filtros del listado de personas, compartidos con la exportación
+//
+//	?q=texto            busca en dni, nombre, apellidos y email
+//	?dni=, ?email=      coincidencia exacta (email sin distinguir mayúsculas)
+//	?auth_client_id=N   solo las personas con acceso a esa aplicación
+type PersonFilter struct {
+	Q            string
+	Dni          string
+	Email        string
+	AuthClientID int
+}
+
+func parsePersonFilter(r *http.Request) (PersonFilter, error) {
+	query := r.URL.Query()
+	filter := PersonFilter{
+		Q:     strings.TrimSpace(query.Get("q")),
+		Dni:   strings.TrimSpace(query.Get("dni")),
+		Email: strings.TrimSpace(query.Get("email")),
+	}
+	id, err := queryIntParam(r, "auth_client_id")
+	if err != nil {
+		return filter, err
+	}
+	filter.AuthClientID = id
+	return filter, nil
+}
+
+// where construye la condición SQL sobre la tabla persons con alias p
+func (f PersonFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.Q != "" {
+		args = append(args, "%"+escapeLike(f.Q)+"%")
+		n := len(args)
+		conds = append(conds, fmt.Sprintf(`(p.dni ILIKE $%d OR p.nombre ILIKE $%d OR p.apellidos ILIKE $%d OR p.email ILIKE $%d)`, n, n, n, n))
+	}
+	if f.Dni != "" {
+		args = append(args, f.Dni)
+		conds = append(conds, fmt.Sprintf(`p.dni = $%d`, len(args)))
+	}
+	if f.Email != "" {
+		args = append(args, f.Email)
+		conds = append(conds, fmt.Sprintf(`lower(p.email) = lower($%d)`, len(args)))
+	}
+	if f.AuthClientID != 0 {
+		args = append(args, f.AuthClientID)
+		conds = append(conds, fmt.Sprintf(`p.id IN (SELECT person_id FROM person_auth_client WHERE auth_client_id = $%d)`, len(args)))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// escapeLike escapa los comodines de LIKE para buscar el texto literal
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+type PersonPostData struct {
+	Dni       string `json:"dni"`
+	Nombre    string `json:"nombre"`
+	Apellidos string `json:"apellidos"`
+	Email     string `json:"email"`
+	Telefono  string `json:"telefono"`
+}
+
+// PersonDetail es la respuesta de GET /persons/{id}
+type PersonDetail struct {
+	Person     *PersonData       `json:"person"`
+	LPersonApp []PersonApp       `json:"lpersonapp,omitempty"`
+	LApp       []AuthClientShort `json:"lapp,omitempty"`
+}
+
+// getPersonHandler devuelve la persona con sus aplicaciones: GET /persons/{id}
+func getPersonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		person, err := postgres_person_by_id(ctx, db, iid)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la persona: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		lpersonapp, err := postgres_personapp_by_person_id(ctx, db, iid)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la personaapp: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		lapp, err := postgres_auth_client_by_person_id(ctx, db, iid)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la app: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		data := PersonDetail{Person: person, LPersonApp: lpersonapp, LApp: lapp}
+
+		// Convierte data a formato JSON
+		jsonPerson, err := json.Marshal(data)
+
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir la persona a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con la persona en formato JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonPerson)
+	}
+}
+
+// postPersonHandler da de alta una persona: POST /persons
+func postPersonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		// Parsea el cuerpo de la solicitud en json
+		var person PersonPostData
+		if err := json.NewDecoder(r.Body).Decode(&person); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al parsear el cuerpo de la solicitud: %v`, err), http.StatusBadRequest)
+			return
+		}
+
+		// Verifica que los campos no estén vacíos
+		if person.Dni == "" || person.Nombre == "" || person.Apellidos == "" || person.Email == "" {
+			errJsonStatus(w, `Los campos dni, nombre, apellidos y email son requeridos`, http.StatusBadRequest)
+			return
+		}
+
+		// la inserción y su evento se escriben en la misma transacción
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al iniciar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		created, err := postgres_person_insert(ctx, tx, person)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al insertar la persona: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		id := created.ID
+
+		if _, err := outbox_enqueue(ctx, tx, eventPersonCreated, entityPerson, id, created); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al registrar el evento: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al confirmar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con un mensaje en formato JSON
+		w.Write([]byte(`{"message": "Persona creada", "id": ` + fmt.Sprintf("%d", id) + `}`))
+	}
+}
+
+// putPersonHandler actualiza una persona: PUT /persons/{id}
+func putPersonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		// Parsea el cuerpo de la solicitud en json
+		var person PersonData
+		if err := json.NewDecoder(r.Body).Decode(&person); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al parsear el cuerpo de la solicitud: %v`, err), http.StatusBadRequest)
+			return
+		}
+
+		// el id del cuerpo es opcional, pero si viene debe ser el de la URL
+		if person.ID != 0 && person.ID != iid {
+			errJsonStatus(w, `El id de la persona no coincide con el id de la URL`, http.StatusBadRequest)
+			return
+		}
+		person.ID = iid
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al iniciar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		updated, err := postgres_person_update(ctx, tx, person)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al actualizar la persona: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		if updated == nil {
+			errJsonStatus(w, fmt.Sprintf(`La persona con id %d no existe`, person.ID), http.StatusNotFound)
+			return
+		}
+
+		if _, err := outbox_enqueue(ctx, tx, eventPersonUpdated, entityPerson, updated.ID, updated); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al registrar el evento: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al confirmar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con un mensaje en formato JSON
+		w.Write([]byte(`{"message": "Persona actualizada"}`))
+	}
+}
+
+// deletePersonHandler elimina una persona: DELETE /persons/{id}
+func deletePersonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		idDel, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al iniciar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		deleted, err := postgres_person_delete(ctx, tx, idDel)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al eliminar la persona: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if deleted {
+			if _, err := outbox_enqueue(ctx, tx, eventPersonDeleted, entityPerson, idDel, map[string]int{"id": idDel}); err != nil {
+				errJsonStatus(w, fmt.Sprintf(`Error al registrar el evento: %v`, err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al confirmar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con un mensaje en formato JSON
+		w.Write([]byte(`{"message": "Persona eliminada"}`))
+	}
+}
+
+func postgres_person_by_id(ctx context.Context, db *sql.DB, id int) (*PersonData, error) {
+	ctx, span := startDbSpan(ctx, "postgres_person_by_id")
+	defer span.End()
+
+	query := fmt.Sprintf(`SELECT id, dni, nombre, apellidos, email, telefono, created_at FROM persons WHERE id = %d;`, id)
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	row, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer row.Close()
+
+	person := &PersonData{}
+	if row.Next() {
+		if err := row.Scan(&person.ID, &person.Dni, &person.Nombre, &person.Apellidos, &person.Email, &person.Telefono, &person.CreatedAt); err != nil {
+			return person, err
+		}
+	} else {
+		return nil, fmt.Errorf("%w con id %d", errPersonNotFound, id)
+	}
+	return person, nil
+}
+
+// postgres_person_insert inserta una persona dentro de una transacción
+func postgres_person_insert(ctx context.Context, tx *sql.Tx, person PersonPostData) (*PersonData, error) {
+	ctx, span := startDbSpan(ctx, "postgres_person_insert")
+	defer span.End()
+
+	query := `
+		INSERT INTO persons (dni, nombre, apellidos, email, telefono)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, dni, nombre, apellidos, email, telefono, created_at;`
+	// un teléfono vacío se guarda como NULL para no violar telefono_check
+	var telefono *string
+	if person.Telefono != "" {
+		telefono = &person.Telefono
+	}
+	var item PersonData
+	err := tx.QueryRowContext(ctx, query, person.Dni, person.Nombre, person.Apellidos, person.Email, telefono).Scan(
+		&item.ID, &item.Dni, &item.Nombre, &item.Apellidos, &item.Email, &item.Telefono, &item.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// postgres_person_update actualiza una persona dentro de una transacción (nil si no existe)
+func postgres_person_update(ctx context.Context, tx *sql.Tx, person PersonData) (*PersonData, error) {
+	ctx, span := startDbSpan(ctx, "postgres_person_update")
+	defer span.End()
+
+	query := `
+		UPDATE persons
+		SET dni = $1, nombre = $2, apellidos = $3, email = $4, telefono = $5
+		WHERE id = $6
+		RETURNING id, dni, nombre, apellidos, email, telefono, created_at;`
+	var item PersonData
+	err := tx.QueryRowContext(ctx, query, person.Dni, person.Nombre, person.Apellidos, person.Email, person.Telefono, person.ID).Scan(
+		&item.ID, &item.Dni, &item.Nombre, &item.Apellidos, &item.Email, &item.Telefono, &item.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// postgres_person_delete elimina una persona dentro de una transacción
+func postgres_person_delete(ctx context.Context, tx *sql.Tx, id int) (bool, error) {
+	ctx, span := startDbSpan(ctx, "postgres_person_delete")
+	defer span.End()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM persons WHERE id = $1;`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func postgres_person_by_auth_client_id(ctx context.Context, db *sql.DB, id_app int) ([]PersonData, error) {
+	ctx, span := startDbSpan(ctx, "postgres_person_by_auth_client_id")
+	defer span.End()
+
+	query := fmt.Sprintf(`
+		SELECT
+			id, dni, nombre, apellidos, email, telefono, created_at
+		FROM
+			persons
+		WHERE id in (
+			SELECT
+				person_id
+			FROM person_auth_client
+				WHERE auth_client_id = %d
+		);`, id_app)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []PersonData
+	for rows.Next() {
+		var item PersonData
+		if err := rows.Scan(&item.ID, &item.Dni, &item.Nombre, &item.Apellidos, &item.Email, &item.Telefono, &item.CreatedAt); err != nil {
+			return list, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+func postgres_persons_all(ctx context.Context, db *sql.DB) ([]PersonData, error) {
+	ctx, span := startDbSpan(ctx, "postgres_persons_all")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, dni,
+			nombre, apellidos,
+			email, telefono,
+			created_at
+		FROM persons
+			order by apellidos, nombre
+		;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []PersonData
+	for rows.Next() {
+		var item PersonData
+		if err := rows.Scan(&item.ID, &item.Dni,
+			&item.Nombre, &item.Apellidos,
+			&item.Email, &item.Telefono,
+			&item.CreatedAt); err != nil {
+			return list, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+func postgres_persons_filtered(ctx context.Context, db *sql.DB, filter PersonFilter) ([]PersonData, error) {
+	ctx, span := startDbSpan(ctx, "postgres_persons_filtered")
+	defer span.End()
+
+	where, args := filter.where()
+	query := fmt.Sprintf(`
+		SELECT
+			p.id, p.dni,
+			p.nombre, p.apellidos,
+			p.email, p.telefono,
+			p.created_at
+		FROM persons p
+			%s
+			order by p.apellidos, p.nombre
+		;`, where)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []PersonData
+	for rows.Next() {
+		var item PersonData
+		if err := rows.Scan(&item.ID, &item.Dni,
+			&item.Nombre, &item.Apellidos,
+			&item.Email, &item.Telefono,
+			&item.CreatedAt); err != nil {
+			return list, err
+		}
+		list = append(list, item)
+	}
+	return list, rows.Err()
+}
+
+// postgres_person_by_id_for_update lee y bloquea una persona dentro de una transacción (nil si no existe)
+func postgres_person_by_id_for_update(ctx context.Context, tx *sql.Tx, id int) (*PersonData, error) {
+	ctx, span := startDbSpan(ctx, "postgres_person_by_id_for_update")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, dni, nombre, apellidos, email, telefono, created_at
+		FROM persons
+		WHERE id = $1
+		FOR UPDATE;`
+	var item PersonData
+	err := tx.QueryRowContext(ctx, query, id).Scan(&item.ID, &item.Dni, &item.Nombre, &item.Apellidos, &item.Email, &item.Telefono, &item.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// postgres_person_by_dni busca una persona por su dni (nil si no existe)
+func postgres_person_by_dni(ctx context.Context, db *sql.DB, dni string) (*PersonData, error) {
+	ctx, span := startDbSpan(ctx, "postgres_person_by_dni")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, dni, nombre, apellidos, email, telefono, created_at
+		FROM persons
+		WHERE dni = $1
+		ORDER BY id
+		LIMIT 1;`
+	var item PersonData
+	err := db.QueryRowContext(ctx, query, dni).Scan(&item.ID, &item.Dni, &item.Nombre, &item.Apellidos, &item.Email, &item.Telefono, &item.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// postgres_persons_by_ids carga varias personas en una consulta (cargadores de GraphQL)
+func postgres_persons_by_ids(ctx context.Context, db *sql.DB, ids []int) ([]PersonData, error) {
+	ctx, span := startDbSpan(ctx, "postgres_persons_by_ids")
+	defer span.End()
+
+	query := `SELECT id, dni, nombre, apellidos, email, telefono, created_at FROM persons WHERE id = ANY($1);`
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []PersonData
+	for rows.Next() {
+		var person PersonData
+		if err := rows.Scan(&person.ID, &person.Dni, &person.Nombre, &person.Apellidos, &person.Email, &person.Telefono, &person.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, person)
+	}
+	return list, rows.Err()
+}
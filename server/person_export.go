@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// cada cuántas filas se vuelca la respuesta al cliente
+const personExportFlushRows = 500
+
+// PersonExportRow es una fila de la exportación; Applications y Profiles solo se rellenan con include
+type PersonExportRow struct {
+	PersonData
+	Applications []string                   `json:"applications,omitempty"`
+	Profiles     map[string]json.RawMessage `json:"profiles,omitempty"`
+}
+
+// personsExportHandler exporta personas en streaming: GET /persons/export
+//
+//	?format=csv|ndjson|xlsx          (por defecto csv; jsonl es sinónimo de ndjson)
+//	?include=memberships,profiles    añade las aplicaciones y los perfiles de person_auth_client
+//
+// Admite los mismos filtros que GET /persons (q, dni, email, auth_client_id).
+func personsExportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		query := r.URL.Query()
+
+		format := strings.ToLower(query.Get("format"))
+		switch format {
+		case "":
+			format = "csv"
+		case "jsonl":
+			format = "ndjson"
+		case "csv", "ndjson", "xlsx":
+		default:
+			errJsonStatus(w, `Formato no soportado, se admite csv, ndjson o xlsx`, http.StatusBadRequest)
+			return
+		}
+
+		var withMemberships, withProfiles bool
+		if include := query.Get("include"); include != "" {
+			for _, part := range strings.Split(include, ",") {
+				switch strings.TrimSpace(part) {
+				case "memberships":
+					withMemberships = true
+				case "profiles":
+					withProfiles = true
+				default:
+					errJsonStatus(w, fmt.Sprintf(`Valor de include no soportado: %s`, part), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		filter, err := parsePersonFilter(r)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// un solo span para la consulta y la lectura del cursor, con el número de filas;
+		// uno por fila inundaría el exportador de trazas en las exportaciones grandes
+		ctx, span := startDbSpan(ctx, "postgres_persons_export")
+		defer span.End()
+		n := 0
+		defer func() { span.SetAttributes(attribute.Int("db.response.returned_rows", n)) }()
+
+		rows, err := postgres_persons_export_query(ctx, db, filter)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener las personas: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		header := []string{"id", "dni", "nombre", "apellidos", "email", "telefono", "created_at"}
+		if withMemberships {
+			header = append(header, "applications")
+		}
+		if withProfiles {
+			header = append(header, "profiles")
+		}
+
+		filename := "persons-" + time.Now().Format("20060102")
+		var write func(item PersonExportRow) error
+		flush := func() error { return nil }
+		var finish func() error
+
+		switch format {
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+			cw := csv.NewWriter(w)
+			cw.Write(header)
+			write = func(item PersonExportRow) error {
+				return cw.Write(personExportRecord(item, withMemberships, withProfiles))
+			}
+			flush = func() error {
+				cw.Flush()
+				return cw.Error()
+			}
+			finish = flush
+		case "ndjson":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.ndjson"`, filename))
+			enc := json.NewEncoder(w)
+			write = func(item PersonExportRow) error {
+				if !withMemberships {
+					item.Applications = nil
+				}
+				if !withProfiles {
+					item.Profiles = nil
+				}
+				return enc.Encode(item)
+			}
+			finish = func() error { return nil }
+		case "xlsx":
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xlsx"`, filename))
+			xw, err := newXlsxStreamWriter(w, "persons")
+			if err != nil {
+				requestLogger(ctx).Error("error al iniciar la exportación XLSX", "error", err)
+				return
+			}
+			xw.WriteRow(header)
+			write = func(item PersonExportRow) error {
+				return xw.WriteRow(personExportRecord(item, withMemberships, withProfiles))
+			}
+			finish = xw.Close
+		}
+
+		// a partir de aquí la respuesta ya está en marcha: los errores solo se pueden registrar
+		rc := http.NewResponseController(w)
+
+		// las exportaciones grandes pueden superar el plazo de escritura del servidor
+		rc.SetWriteDeadline(time.Time{})
+		for rows.Next() {
+			item, err := postgres_persons_export_scan(rows)
+			if err != nil {
+				requestLogger(ctx).Error("error al leer la exportación de personas", "rows", n, "error", err)
+				return
+			}
+			if err := write(item); err != nil {
+				requestLogger(ctx).Error("error al escribir la exportación de personas", "rows", n, "error", err)
+				return
+			}
+			n++
+			if n%personExportFlushRows == 0 {
+				if err := flush(); err != nil {
+					requestLogger(ctx).Error("error al escribir la exportación de personas", "rows", n, "error", err)
+					return
+				}
+				rc.Flush()
+			}
+		}
+		if err := rows.Err(); err != nil {
+			requestLogger(ctx).Error("error al leer la exportación de personas", "rows", n, "error", err)
+			return
+		}
+		if err := finish(); err != nil {
+			requestLogger(ctx).Error("error al cerrar la exportación de personas", "rows", n, "error", err)
+		}
+	}
+}
+
+// personExportRecord convierte la fila en celdas de texto para CSV y XLSX
+func personExportRecord(item PersonExportRow, withMemberships, withProfiles bool) []string {
+	telefono := ""
+	if item.Telefono != nil {
+		telefono = *item.Telefono
+	}
+	record := []string{
+		strconv.Itoa(item.ID), item.Dni,
+		item.Nombre, item.Apellidos,
+		item.Email, telefono,
+		item.CreatedAt.Format(time.RFC3339),
+	}
+	if withMemberships {
+		record = append(record, strings.Join(item.Applications, ";"))
+	}
+	if withProfiles {
+		profiles := ""
+		if len(item.Profiles) > 0 {
+			b, _ := json.Marshal(item.Profiles)
+			profiles = string(b)
+		}
+		record = append(record, profiles)
+	}
+	return record
+}
+
+// postgres_persons_export_query devuelve el cursor de la exportación: las filas se leen
+// de una en una para no cargar toda la tabla en memoria. El span lo abre el manejador,
+// que lo mantiene mientras recorre el cursor
+func postgres_persons_export_query(ctx context.Context, db *sql.DB, filter PersonFilter) (*sql.Rows, error) {
+	where, args := filter.where()
+	query := fmt.Sprintf(`
+		SELECT
+			p.id, p.dni,
+			p.nombre, p.apellidos,
+			p.email, p.telefono,
+			p.created_at,
+			COALESCE((
+				SELECT array_agg(ac.client_id ORDER BY ac.client_id)
+				FROM person_auth_client pac
+					JOIN auth_clients ac ON ac.id = pac.auth_client_id
+				WHERE pac.person_id = p.id
+			), '{}') AS applications,
+			COALESCE((
+				SELECT json_object_agg(ac.client_id, pac.profile)
+				FROM person_auth_client pac
+					JOIN auth_clients ac ON ac.id = pac.auth_client_id
+				WHERE pac.person_id = p.id
+			), '{}') AS profiles
+		FROM persons p
+			%s
+			order by p.apellidos, p.nombre
+		;`, where)
+	return db.QueryContext(ctx, query, args...)
+}
+
+// postgres_persons_export_scan lee la fila actual del cursor, dentro del span de la exportación
+func postgres_persons_export_scan(rows *sql.Rows) (PersonExportRow, error) {
+	var item PersonExportRow
+	var profiles []byte
+	if err := rows.Scan(&item.ID, &item.Dni,
+		&item.Nombre, &item.Apellidos,
+		&item.Email, &item.Telefono,
+		&item.CreatedAt,
+		pq.Array(&item.Applications), &profiles); err != nil {
+		return item, err
+	}
+	if err := json.Unmarshal(profiles, &item.Profiles); err != nil {
+		return item, err
+	}
+	return item, nil
+}
@@ -0,0 +1,682 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+	CREATE TABLE IF NOT EXISTS person_imports (
+		id SERIAL PRIMARY KEY,
+		format VARCHAR(8) NOT NULL,
+		dry_run BOOLEAN NOT NULL,
+		upsert BOOLEAN NOT NULL,
+		committed BOOLEAN NOT NULL,
+		total INT NOT NULL,
+		...
+		report JSONB NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+*/
+
+// límites de la importación masiva
+const (
+	personImportMaxBytes = 32 << 20
+	personImportMaxRows  = 100000
+)
+
+// campos de persons que se pueden importar
+var personImportFields = []string{"dni", "nombre", "apellidos", "email", "telefono"}
+
+type PersonImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+type PersonImportResult struct {
+	ImportID  int                    `json:"import_id"`
+	Format    string                 `json:"format"`
+	DryRun    bool                   `json:"dry_run"`
+	Upsert    bool                   `json:"upsert"`
+	Committed bool                   `json:"committed"`
+	Total     int                    `json:"total"`
+	Created   int                    `json:"created"`
+	Updated   int                    `json:"updated"`
+	Failed    int                    `json:"failed"`
+	Errors    []PersonImportRowError `json:"errors"`
+	ReportUrl string                 `json:"report_url,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// personImportRow es una fila ya mapeada a los campos de persons
+type personImportRow struct {
+	Row    int
+	Person PersonPostData
+}
+
+// initTablePersonImports crea la tabla "person_imports" si no existe
+// guarda el resultado de cada importación para descargar el informe de errores
+func initTablePersonImports(db *sql.DB) error {
+
+	// SQL para crear la tabla si no existe
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS person_imports (
+			id SERIAL PRIMARY KEY,
+			format VARCHAR(8) NOT NULL,
+			dry_run BOOLEAN NOT NULL,
+			upsert BOOLEAN NOT NULL,
+			committed BOOLEAN NOT NULL,
+			total INT NOT NULL,
+			created INT NOT NULL,
+			updated INT NOT NULL,
+			failed INT NOT NULL,
+			report JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`
+
+	// Ejecuta la creación de la tabla
+	_, err := db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al crear la tabla person_imports: %v", err)
+	}
+
+	return nil
+}
+
+func dropTablePersonImports(db *sql.DB) error {
+
+	// SQL para eliminar la tabla "person_imports"
+	dropTableSQL := `DROP TABLE IF EXISTS person_imports;`
+
+	// Ejecuta la eliminación de la tabla
+	_, err := db.Exec(dropTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al eliminar la tabla person_imports: %v", err)
+	}
+	return nil
+}
+
+// personsImportHandler importa personas en bloque: POST /persons/import
+//
+//	?format=csv|xlsx|jsonl   (por defecto según Content-Type, si no csv)
+//	?map=DNI:dni,Nombre:nombre,...  columna de origen -> campo
+//	?delimiter=;             separador CSV
+//	?dry_run=true            valida y calcula el resultado sin guardar
+//	?upsert=dni              actualiza las personas que ya existen con el mismo dni
+//
+// La importación es todo o nada: si alguna fila falla no se guarda ninguna.
+func personsImportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		query := r.URL.Query()
+
+		format := personImportFormat(query.Get("format"), r.Header.Get("Content-Type"))
+		if format == "" {
+			errJsonStatus(w, `Formato no soportado, se admite csv, xlsx o jsonl`, http.StatusBadRequest)
+			return
+		}
+
+		mapping, err := personImportMapping(query.Get("map"))
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		dryRun := query.Get("dry_run") == "true" || query.Get("dry_run") == "1"
+
+		upsert := false
+		switch query.Get("upsert") {
+		case "":
+		case "dni":
+			upsert = true
+		default:
+			errJsonStatus(w, `El parámetro upsert solo admite el valor dni`, http.StatusBadRequest)
+			return
+		}
+
+		var delimiter rune = ','
+		if d := query.Get("delimiter"); d != "" {
+			if utf8.RuneCountInString(d) != 1 {
+				errJsonStatus(w, `El parámetro delimiter debe ser un único carácter`, http.StatusBadRequest)
+				return
+			}
+			delimiter, _ = utf8.DecodeRuneInString(d)
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, personImportMaxBytes))
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al leer el fichero: %v`, err), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// validar y escribir hasta personImportMaxRows filas puede superar el plazo de escritura
+		// del servidor; la respuesta se envía al terminar, así que se quita el plazo
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		rows, parseErrors, err := personImportParse(format, body, mapping, delimiter)
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := PersonImportResult{
+			Format:    format,
+			DryRun:    dryRun,
+			Upsert:    upsert,
+			Total:     len(rows) + len(parseErrors),
+			Errors:    parseErrors,
+			CreatedAt: time.Now(),
+		}
+		for _, row := range rows {
+			result.Errors = append(result.Errors, personImportValidate(row)...)
+		}
+		result.Errors = append(result.Errors, personImportDuplicates(rows)...)
+
+		// solo se toca la base de datos si todas las filas son válidas
+		if len(result.Errors) == 0 {
+			if err := personImportApply(ctx, db, rows, &result); err != nil {
+				errJsonStatus(w, fmt.Sprintf(`Error al importar las personas: %v`, err), http.StatusInternalServerError)
+				return
+			}
+		}
+		result.Failed = personImportFailedRows(result.Errors)
+
+		if err := postgres_person_import_insert(ctx, db, &result); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al guardar el informe de la importación: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		result.ReportUrl = fmt.Sprintf("/persons/import/%d", result.ImportID)
+
+		status := http.StatusOK
+		if len(result.Errors) > 0 {
+			status = http.StatusUnprocessableEntity
+		}
+
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir el resultado a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(jsonData)
+	}
+}
+
+// personsImportReportHandler descarga el informe por fila: GET /persons/import/{id}?format=csv|json
+func personsImportReportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		result, err := postgres_person_import_by_id(ctx, db, iid)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la importación: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		if result == nil {
+			errJsonStatus(w, fmt.Sprintf(`La importación con id %d no existe`, iid), http.StatusNotFound)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%d-report.json"`, iid))
+			writeJson(w, result)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%d-report.csv"`, iid))
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"row", "field", "value", "message"})
+		for _, e := range result.Errors {
+			cw.Write([]string{strconv.Itoa(e.Row), e.Field, e.Value, e.Message})
+		}
+		cw.Flush()
+	}
+}
+
+// personImportFormat decide el formato a partir del parámetro o del Content-Type
+func personImportFormat(param string, contentType string) string {
+	switch strings.ToLower(param) {
+	case "csv":
+		return "csv"
+	case "xlsx":
+		return "xlsx"
+	case "jsonl", "ndjson":
+		return "jsonl"
+	case "":
+	default:
+		return ""
+	}
+
+	switch {
+	case strings.Contains(contentType, "spreadsheetml"):
+		return "xlsx"
+	case strings.Contains(contentType, "ndjson"), strings.Contains(contentType, "jsonl"):
+		return "jsonl"
+	}
+	return "csv"
+}
+
+// personImportMapping parsea "Columna:campo,..." en un mapa columna (minúsculas) -> campo
+func personImportMapping(param string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if param == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(param, ",") {
+		source, field, ok := strings.Cut(pair, ":")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ok || strings.TrimSpace(source) == "" || !personImportIsField(field) {
+			return nil, fmt.Errorf("mapeo no válido %q, se espera columna:campo con campo en %s", pair, strings.Join(personImportFields, ", "))
+		}
+		mapping[strings.ToLower(strings.TrimSpace(source))] = field
+	}
+	return mapping, nil
+}
+
+func personImportIsField(field string) bool {
+	for _, f := range personImportFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// personImportField devuelve el campo destino de una columna de origen ("" si se ignora);
+// las columnas que ya se llaman como un campo no necesitan mapeo
+func personImportField(mapping map[string]string, column string) string {
+	column = strings.ToLower(strings.TrimSpace(column))
+	if field, ok := mapping[column]; ok {
+		return field
+	}
+	if personImportIsField(column) {
+		return column
+	}
+	return ""
+}
+
+// personImportParse lee el fichero y devuelve las filas mapeadas y los errores de formato
+func personImportParse(format string, body []byte, mapping map[string]string, delimiter rune) ([]personImportRow, []PersonImportRowError, error) {
+	switch format {
+	case "jsonl":
+		return personImportParseJsonl(body, mapping)
+	case "xlsx":
+		// la primera fila es la cabecera
+		table, err := xlsxReadRows(body, personImportMaxRows+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return personImportParseTable(table, mapping)
+	default:
+		// quita el BOM que añade Excel al guardar CSV en UTF-8
+		body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+		cr := csv.NewReader(bytes.NewReader(body))
+		cr.Comma = delimiter
+		cr.FieldsPerRecord = -1
+		table, err := cr.ReadAll()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error al leer el CSV: %v", err)
+		}
+		return personImportParseTable(table, mapping)
+	}
+}
+
+// personImportParseTable convierte una tabla con cabecera (CSV o XLSX) en filas
+func personImportParseTable(table [][]string, mapping map[string]string) ([]personImportRow, []PersonImportRowError, error) {
+	if len(table) == 0 {
+		return nil, nil, fmt.Errorf("el fichero está vacío")
+	}
+	if len(table)-1 > personImportMaxRows {
+		return nil, nil, fmt.Errorf("el fichero supera el máximo de %d filas", personImportMaxRows)
+	}
+
+	header := table[0]
+	fields := make([]string, len(header))
+	found := false
+	for i, column := range header {
+		fields[i] = personImportField(mapping, column)
+		found = found || fields[i] != ""
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("la cabecera no contiene ninguna columna reconocida (%s) ni mapeada", strings.Join(personImportFields, ", "))
+	}
+
+	var rows []personImportRow
+	for i, record := range table[1:] {
+		empty := true
+		for _, value := range record {
+			if strings.TrimSpace(value) != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+
+		values := make(map[string]string)
+		for j, value := range record {
+			if j < len(fields) && fields[j] != "" {
+				values[fields[j]] = value
+			}
+		}
+		// la fila 1 es la cabecera
+		rows = append(rows, personImportRow{Row: i + 2, Person: personImportPerson(values)})
+	}
+	return rows, nil, nil
+}
+
+// personImportParseJsonl lee un objeto JSON por línea, las claves se mapean igual que las columnas
+func personImportParseJsonl(body []byte, mapping map[string]string) ([]personImportRow, []PersonImportRowError, error) {
+	var rows []personImportRow
+	var errs []PersonImportRowError
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if len(rows)+len(errs) >= personImportMaxRows {
+			return nil, nil, fmt.Errorf("el fichero supera el máximo de %d filas", personImportMaxRows)
+		}
+
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(text), &obj); err != nil {
+			errs = append(errs, PersonImportRowError{Row: line, Message: fmt.Sprintf("JSON no válido: %v", err)})
+			continue
+		}
+
+		values := make(map[string]string)
+		for key, value := range obj {
+			field := personImportField(mapping, key)
+			if field == "" || value == nil {
+				continue
+			}
+			// los teléfonos y dni numéricos llegan como número
+			if n, ok := value.(float64); ok {
+				values[field] = strconv.FormatFloat(n, 'f', -1, 64)
+			} else {
+				values[field] = fmt.Sprint(value)
+			}
+		}
+		rows = append(rows, personImportRow{Row: line, Person: personImportPerson(values)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error al leer el fichero JSON Lines: %v", err)
+	}
+	if len(rows)+len(errs) == 0 {
+		return nil, nil, fmt.Errorf("el fichero está vacío")
+	}
+	return rows, errs, nil
+}
+
+func personImportPerson(values map[string]string) PersonPostData {
+	return PersonPostData{
+		Dni:       strings.ToUpper(strings.TrimSpace(values["dni"])),
+		Nombre:    strings.TrimSpace(values["nombre"]),
+		Apellidos: strings.TrimSpace(values["apellidos"]),
+		Email:     strings.TrimSpace(values["email"]),
+		Telefono:  strings.ReplaceAll(strings.TrimSpace(values["telefono"]), " ", ""),
+	}
+}
+
+// personImportValidate aplica las mismas reglas que las restricciones de la tabla persons
+func personImportValidate(row personImportRow) []PersonImportRowError {
+	var errs []PersonImportRowError
+	add := func(field, value, message string) {
+		errs = append(errs, PersonImportRowError{Row: row.Row, Field: field, Value: value, Message: message})
+	}
+
+	p := row.Person
+	required := []struct{ field, value string }{
+		{"dni", p.Dni}, {"nombre", p.Nombre}, {"apellidos", p.Apellidos}, {"email", p.Email},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			add(r.field, "", "campo requerido")
+		}
+	}
+
+	if len(p.Dni) > 32 {
+		add("dni", p.Dni, "máximo 32 caracteres")
+	}
+	if utf8.RuneCountInString(p.Nombre) > 255 {
+		add("nombre", p.Nombre, "máximo 255 caracteres")
+	}
+	if utf8.RuneCountInString(p.Apellidos) > 255 {
+		add("apellidos", p.Apellidos, "máximo 255 caracteres")
+	}
+	if p.Email != "" && (!strings.Contains(p.Email, "@") || len(p.Email) > 255) {
+		add("email", p.Email, "email no válido")
+	}
+	if p.Telefono != "" && (strings.Trim(p.Telefono, "0123456789") != "" || len(p.Telefono) > 20) {
+		add("telefono", p.Telefono, "solo dígitos, máximo 20")
+	}
+	return errs
+}
+
+// personImportDuplicates detecta dni repetidos dentro del propio fichero
+func personImportDuplicates(rows []personImportRow) []PersonImportRowError {
+	var errs []PersonImportRowError
+	first := make(map[string]int)
+	for _, row := range rows {
+		if row.Person.Dni == "" {
+			continue
+		}
+		if prev, ok := first[row.Person.Dni]; ok {
+			errs = append(errs, PersonImportRowError{
+				Row: row.Row, Field: "dni", Value: row.Person.Dni,
+				Message: fmt.Sprintf("dni repetido en el fichero (fila %d)", prev),
+			})
+			continue
+		}
+		first[row.Person.Dni] = row.Row
+	}
+	return errs
+}
+
+func personImportFailedRows(errs []PersonImportRowError) int {
+	rows := make(map[int]bool)
+	for _, e := range errs {
+		rows[e.Row] = true
+	}
+	return len(rows)
+}
+
+// personImportApply escribe todas las filas en una única transacción;
+// en dry_run se hace igualmente para detectar errores de la base de datos y se deshace.
+// Los eventos se encolan juntos al final y solo si se confirma, para no bloquear el outbox
+// mientras se procesan las filas
+func personImportApply(ctx context.Context, db *sql.DB, rows []personImportRow, result *PersonImportResult) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	existing, err := postgres_person_ids_by_dni_tx(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	var events []outboxEvent
+	for _, row := range rows {
+		id, exists := existing[row.Person.Dni]
+
+		if exists && !result.Upsert {
+			result.Errors = append(result.Errors, PersonImportRowError{
+				Row: row.Row, Field: "dni", Value: row.Person.Dni,
+				Message: fmt.Sprintf("ya existe la persona %d con este dni, use upsert=dni para actualizarla", id),
+			})
+			continue
+		}
+
+		// cada fila en un savepoint para poder seguir validando tras un error
+		if _, err := tx.Exec(`SAVEPOINT person_import_row;`); err != nil {
+			return err
+		}
+
+		if exists {
+			var current, updated *PersonData
+			current, err = postgres_person_by_id_for_update(ctx, tx, id)
+			if err == nil && current == nil {
+				err = fmt.Errorf("la persona %d ya no existe", id)
+			}
+			if err == nil {
+				updated, err = postgres_person_update(ctx, tx, personImportUpdate(*current, row.Person))
+			}
+			if err == nil {
+				events = append(events, outboxEvent{EventType: eventPersonUpdated, Entity: entityPerson, EntityID: id, Data: updated})
+				result.Updated++
+			}
+		} else {
+			var created *PersonData
+			created, err = postgres_person_insert(ctx, tx, row.Person)
+			if err == nil {
+				events = append(events, outboxEvent{EventType: eventPersonCreated, Entity: entityPerson, EntityID: created.ID, Data: created})
+				result.Created++
+			}
+		}
+
+		if err != nil {
+			result.Errors = append(result.Errors, PersonImportRowError{Row: row.Row, Message: err.Error()})
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT person_import_row;`); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec(`RELEASE SAVEPOINT person_import_row;`); err != nil {
+			return err
+		}
+	}
+
+	// todo o nada: con errores no se ha escrito ninguna fila
+	if len(result.Errors) > 0 {
+		result.Created, result.Updated = 0, 0
+		return tx.Rollback()
+	}
+	if result.DryRun {
+		return tx.Rollback()
+	}
+	if _, err := outbox_enqueue_batch(ctx, tx, events); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	result.Committed = true
+	return nil
+}
+
+// personImportUpdate aplica la fila a la persona existente; una celda de teléfono vacía
+// conserva el teléfono guardado, para que un fichero sin esa columna no lo borre
+func personImportUpdate(current PersonData, row PersonPostData) PersonData {
+	update := current
+	update.Dni = row.Dni
+	update.Nombre = row.Nombre
+	update.Apellidos = row.Apellidos
+	update.Email = row.Email
+	if row.Telefono != "" {
+		telefono := row.Telefono
+		update.Telefono = &telefono
+	}
+	return update
+}
+
+func postgres_person_ids_by_dni_tx(ctx context.Context, tx *sql.Tx) (map[string]int, error) {
+	ctx, span := startDbSpan(ctx, "postgres_person_ids_by_dni_tx")
+	defer span.End()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, dni FROM persons ORDER BY id;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var dni string
+		if err := rows.Scan(&id, &dni); err != nil {
+			return nil, err
+		}
+		if _, ok := ids[dni]; !ok {
+			ids[dni] = id
+		}
+	}
+	return ids, rows.Err()
+}
+
+func postgres_person_import_insert(ctx context.Context, db *sql.DB, result *PersonImportResult) error {
+	ctx, span := startDbSpan(ctx, "postgres_person_import_insert")
+	defer span.End()
+
+	if result.Errors == nil {
+		result.Errors = []PersonImportRowError{}
+	}
+	report, err := json.Marshal(result.Errors)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO person_imports (format, dry_run, upsert, committed, total, created, updated, failed, report)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at;`
+	return db.QueryRowContext(ctx, query,
+		result.Format, result.DryRun, result.Upsert, result.Committed,
+		result.Total, result.Created, result.Updated, result.Failed,
+		report).Scan(&result.ImportID, &result.CreatedAt)
+}
+
+func postgres_person_import_by_id(ctx context.Context, db *sql.DB, id int) (*PersonImportResult, error) {
+	ctx, span := startDbSpan(ctx, "postgres_person_import_by_id")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, format, dry_run, upsert, committed,
+			total, created, updated, failed,
+			report, created_at
+		FROM person_imports
+		WHERE id = $1;`
+	var result PersonImportResult
+	var report []byte
+	err := db.QueryRowContext(ctx, query, id).Scan(&result.ImportID, &result.Format, &result.DryRun, &result.Upsert, &result.Committed,
+		&result.Total, &result.Created, &result.Updated, &result.Failed,
+		&report, &result.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(report, &result.Errors); err != nil {
+		return nil, err
+	}
+	result.ReportUrl = fmt.Sprintf("/persons/import/%d", result.ImportID)
+	return &result, nil
+}
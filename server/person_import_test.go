@@ -0,0 +1,40 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPersonImportUpdateKeepsTelefono comprueba que una fila sin teléfono no borra el guardado
+// y que una fila con teléfono lo sustituye
+func TestPersonImportUpdateKeepsTelefono(t *testing.T) {
+	telefono := "600000000"
+	current := PersonData{
+		ID:        7,
+		Dni:       "12345678A",
+		Nombre:    "Juan",
+		Apellidos: "Pérez",
+		Email:     "jperez@mydomain.com",
+		Telefono:  &telefono,
+		CreatedAt: time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	update := personImportUpdate(current, PersonPostData{Dni: "12345678A", Nombre: "Juan José", Apellidos: "Pérez", Email: "jjperez@mydomain.com"})
+	if update.ID != current.ID {
+		t.Errorf("id: se esperaba %d y se obtuvo %d", current.ID, update.ID)
+	}
+	if update.Nombre != "Juan José" || update.Email != "jjperez@mydomain.com" {
+		t.Errorf("no se han aplicado los campos de la fila: %+v", update)
+	}
+	if update.Telefono == nil || *update.Telefono != telefono {
+		t.Errorf("sin teléfono en la fila se esperaba conservar %q y se obtuvo %v", telefono, update.Telefono)
+	}
+
+	update = personImportUpdate(current, PersonPostData{Dni: "12345678A", Nombre: "Juan", Apellidos: "Pérez", Email: "jperez@mydomain.com", Telefono: "611111111"})
+	if update.Telefono == nil || *update.Telefono != "611111111" {
+		t.Errorf("se esperaba el teléfono de la fila y se obtuvo %v", update.Telefono)
+	}
+	if *current.Telefono != telefono {
+		t.Errorf("personImportUpdate no debe modificar la persona actual")
+	}
+}
@@ -0,0 +1,470 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+/*
+	CREATE TABLE IF NOT EXISTS person_auth_client (
+		id SERIAL PRIMARY KEY,
+		person_id INT NOT NULL,
+		auth_client_id INT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		profile JSONB,
+		FOREIGN KEY (person_id) REFERENCES persons(id),
+		FOREIGN KEY (auth_client_id) REFERENCES auth_clients(id),
+		UNIQUE (person_id, auth_client_id)
+	);
+*/
+
+type PersonApp struct {
+	ID           int       `json:"id"`
+	PersonID     int       `json:"person_id"`
+	AuthClientId int       `json:"auth_client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Profile      *string   `json:"profile"`
+}
+
+// PersonAppDetail es la respuesta de GET /persons/{id}/applications/{app_id};
+// sin personapp la persona no pertenece a la aplicación
+type PersonAppDetail struct {
+	Person    *PersonData `json:"person"`
+	App       *AuthClient `json:"app"`
+	PersonApp *PersonApp  `json:"personapp,omitempty"`
+}
+
+// getPersonAppHandler devuelve la pertenencia de una persona a una aplicación:
+// GET /persons/{id}/applications/{app_id}
+func getPersonAppHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+		iidApp, ok := pathInt(w, r, "app_id")
+		if !ok {
+			return
+		}
+
+		person, err := postgres_person_by_id(ctx, db, iidPer)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la persona: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if person == nil {
+			errJsonStatus(w, fmt.Sprintf(`La persona con id %d no existe`, iidPer), http.StatusNotFound)
+			return
+		}
+
+		app, err := postgres_auth_client_by_id(ctx, db, iidApp)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la app: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if app == nil {
+			errJsonStatus(w, fmt.Sprintf(`La app con id %d no existe`, iidApp), http.StatusNotFound)
+			return
+		}
+
+		data := PersonAppDetail{Person: person, App: app}
+
+		personApp, err := postgres_personapp_by_person_id_auth_client_id(ctx, db, iidPer, iidApp)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la personapp: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		data.PersonApp = personApp
+
+		// Convierte la personapp a formato JSON
+		jsonPersonApp, err := json.Marshal(data)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir la personapp a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con la personapp en formato JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonPersonApp)
+	}
+}
+
+// postPersonAppHandler da de alta a la persona en la aplicación:
+// POST /persons/{id}/applications/{app_id}
+func postPersonAppHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+		iidApp, ok := pathInt(w, r, "app_id")
+		if !ok {
+			return
+		}
+
+		// alta de la persona en la aplicación, el cuerpo es opcional: {"profile": "{...}"}
+		var personApp PersonApp
+		if err := json.NewDecoder(r.Body).Decode(&personApp); err != nil && err != io.EOF {
+			errJsonStatus(w, fmt.Sprintf(`Error al decodificar la personapp: %v`, err), http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al iniciar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		created, err := postgres_personapp_insert(ctx, tx, iidPer, iidApp, personApp.Profile)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al insertar la personapp: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := outbox_enqueue(ctx, tx, eventMembershipGranted, entityPersonApp, created.ID, created); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al registrar el evento: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al confirmar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, created)
+	}
+}
+
+// putPersonAppHandler actualiza el perfil de la persona en la aplicación:
+// PUT /persons/{id}/applications/{app_id}
+func putPersonAppHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+		iidApp, ok := pathInt(w, r, "app_id")
+		if !ok {
+			return
+		}
+
+		var personApp PersonApp
+		if err := json.NewDecoder(r.Body).Decode(&personApp); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al decodificar la personapp: %v`, err), http.StatusBadRequest)
+			return
+		}
+
+		// la persona y la aplicación son las de la URL; si vienen en el cuerpo deben coincidir
+		if (personApp.PersonID != 0 && personApp.PersonID != iidPer) || (personApp.AuthClientId != 0 && personApp.AuthClientId != iidApp) {
+			errJsonStatus(w, `La persona o la aplicación no coinciden con las de la URL`, http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al iniciar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// Actualiza la personapp
+		updated, err := postgres_personapp_update_profile(ctx, tx, iidPer, iidApp, personApp.Profile)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al ejecutar la consulta: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if updated != nil {
+			if _, err := outbox_enqueue(ctx, tx, eventProfileChanged, entityPersonApp, updated.ID, updated); err != nil {
+				errJsonStatus(w, fmt.Sprintf(`Error al registrar el evento: %v`, err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al confirmar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		// Responde con la personapp actualizada
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"PersonApp actualizada"}`))
+	}
+}
+
+// deletePersonAppHandler da de baja a la persona en la aplicación:
+// DELETE /persons/{id}/applications/{app_id}
+func deletePersonAppHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iidPer, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+		iidApp, ok := pathInt(w, r, "app_id")
+		if !ok {
+			return
+		}
+
+		// baja de la persona en la aplicación
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al iniciar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		deleted, err := postgres_personapp_delete(ctx, tx, iidPer, iidApp)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al eliminar la personapp: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		if deleted == nil {
+			errJsonStatus(w, fmt.Sprintf(`La persona %d no pertenece a la app %d`, iidPer, iidApp), http.StatusNotFound)
+			return
+		}
+
+		if _, err := outbox_enqueue(ctx, tx, eventMembershipRevoked, entityPersonApp, deleted.ID, deleted); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al registrar el evento: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al confirmar la transacción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"PersonApp eliminada"}`))
+	}
+}
+
+func postgres_personapp_by_person_id_auth_client_id(ctx context.Context, db *sql.DB, iidPer, iidApp int) (*PersonApp, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_by_person_id_auth_client_id")
+	defer span.End()
+
+	// SQL para obtener una PersonApp
+	query := fmt.Sprintf(`
+		SELECT
+			id, person_id, auth_client_id, created_at, profile
+		FROM
+			person_auth_client
+		WHERE
+			person_id = %d AND auth_client_id = %d;`, iidPer, iidApp)
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	row, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer row.Close()
+
+	// Estructura para almacenar la personapp
+	var personApp PersonApp
+	if row.Next() {
+		if err := row.Scan(&personApp.ID, &personApp.PersonID, &personApp.AuthClientId, &personApp.CreatedAt, &personApp.Profile); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	return &personApp, nil
+}
+
+// postgres_personapp_insert da de alta una persona en una aplicación dentro de una transacción
+func postgres_personapp_insert(ctx context.Context, tx *sql.Tx, iidPer, iidApp int, profile *string) (*PersonApp, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_insert")
+	defer span.End()
+
+	query := `
+		INSERT INTO person_auth_client (person_id, auth_client_id, profile)
+		VALUES ($1, $2, $3)
+		RETURNING id, person_id, auth_client_id, created_at, profile;`
+	var item PersonApp
+	err := tx.QueryRowContext(ctx, query, iidPer, iidApp, profile).Scan(&item.ID, &item.PersonID, &item.AuthClientId, &item.CreatedAt, &item.Profile)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// postgres_personapp_update_profile actualiza el profile dentro de una transacción (nil si no existe)
+func postgres_personapp_update_profile(ctx context.Context, tx *sql.Tx, iidPer, iidApp int, profile *string) (*PersonApp, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_update_profile")
+	defer span.End()
+
+	query := `
+		UPDATE
+			person_auth_client
+		SET
+			profile = $1
+		WHERE
+			person_id = $2 AND auth_client_id = $3
+		RETURNING id, person_id, auth_client_id, created_at, profile;`
+	var item PersonApp
+	err := tx.QueryRowContext(ctx, query, profile, iidPer, iidApp).Scan(&item.ID, &item.PersonID, &item.AuthClientId, &item.CreatedAt, &item.Profile)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// postgres_personapp_delete da de baja una persona de una aplicación dentro de una transacción (nil si no existe)
+func postgres_personapp_delete(ctx context.Context, tx *sql.Tx, iidPer, iidApp int) (*PersonApp, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_delete")
+	defer span.End()
+
+	query := `
+		DELETE FROM
+			person_auth_client
+		WHERE
+			person_id = $1 AND auth_client_id = $2
+		RETURNING id, person_id, auth_client_id, created_at, profile;`
+	var item PersonApp
+	err := tx.QueryRowContext(ctx, query, iidPer, iidApp).Scan(&item.ID, &item.PersonID, &item.AuthClientId, &item.CreatedAt, &item.Profile)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func postgres_personapp_by_auth_client_id(ctx context.Context, db *sql.DB, id_app int) ([]PersonApp, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_by_auth_client_id")
+	defer span.End()
+
+	query := fmt.Sprintf(`
+		SELECT
+			id, person_id, auth_client_id, created_at, profile
+		FROM
+			person_auth_client
+		WHERE
+			auth_client_id = %d;
+		`, id_app)
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []PersonApp
+	for rows.Next() {
+		var item PersonApp
+		if err := rows.Scan(&item.ID, &item.PersonID, &item.AuthClientId, &item.CreatedAt, &item.Profile); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+
+	return list, nil
+}
+
+func postgres_personapp_by_person_id(ctx context.Context, db *sql.DB, id_person int) ([]PersonApp, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_by_person_id")
+	defer span.End()
+
+	query := fmt.Sprintf(`
+		SELECT
+			id, person_id, auth_client_id, created_at, profile
+		FROM
+			person_auth_client
+		WHERE
+			person_id = %d;`, id_person)
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []PersonApp
+	for rows.Next() {
+		var item PersonApp
+		if err := rows.Scan(&item.ID, &item.PersonID, &item.AuthClientId, &item.CreatedAt, &item.Profile); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+
+	return list, nil
+}
+
+// postgres_personapp_by_person_ids carga las pertenencias de varias personas en una consulta
+func postgres_personapp_by_person_ids(ctx context.Context, db *sql.DB, ids []int) ([]PersonApp, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_by_person_ids")
+	defer span.End()
+
+	return postgres_personapp_where(ctx, db, `person_id = ANY($1)`, pq.Array(ids))
+}
+
+// postgres_personapp_by_auth_client_ids carga las pertenencias de varias aplicaciones en una consulta
+func postgres_personapp_by_auth_client_ids(ctx context.Context, db *sql.DB, ids []int) ([]PersonApp, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_by_auth_client_ids")
+	defer span.End()
+
+	return postgres_personapp_where(ctx, db, `auth_client_id = ANY($1)`, pq.Array(ids))
+}
+
+func postgres_personapp_where(ctx context.Context, db *sql.DB, where string, args ...any) ([]PersonApp, error) {
+	query := `
+		SELECT
+			id, person_id, auth_client_id, created_at, profile
+		FROM
+			person_auth_client
+		WHERE ` + where + `
+		ORDER BY id;`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []PersonApp
+	for rows.Next() {
+		var item PersonApp
+		if err := rows.Scan(&item.ID, &item.PersonID, &item.AuthClientId, &item.CreatedAt, &item.Profile); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, rows.Err()
+}
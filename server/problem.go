@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"dummy-corp-erp-server/api"
+)
+
+// Respuestas de error RFC 7807 de la API v1; los tipos y los códigos están en el paquete api.
+
+// problemCodeForStatus es el código por defecto de los errores que no indican uno
+func problemCodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return api.ProblemInvalidParameter
+	case http.StatusUnauthorized:
+		return api.ProblemUnauthorized
+	case http.StatusForbidden:
+		return api.ProblemForbidden
+	case http.StatusNotFound:
+		return api.ProblemNotFound
+	case http.StatusMethodNotAllowed:
+		return api.ProblemMethodNotAllowed
+	case http.StatusConflict:
+		return api.ProblemConflict
+	case http.StatusTooManyRequests:
+		return api.ProblemRateLimited
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return api.ProblemUpstream
+	case http.StatusServiceUnavailable:
+		return api.ProblemUnavailable
+	}
+	return api.ProblemInternal
+}
+
+// writeProblem responde con un problema RFC 7807
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string, fields ...api.ProblemFieldError) {
+	problem := api.Problem{
+		Type:      api.ProblemTypePrefix + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Code:      code,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: w.Header().Get("X-Request-ID"),
+		Errors:    fields,
+	}
+	w.Header().Set("Content-Type", api.ProblemContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// problemWriter hace que errJsonStatus responda con problemas RFC 7807; lo usan las rutas
+// /api/v1 para que los errores de los middlewares (autenticación, CORS, límites, chaos)
+// tengan la misma forma que los de los manejadores
+type problemWriter struct {
+	http.ResponseWriter
+	r *http.Request
+}
+
+func (p *problemWriter) problem(status int, detail string) {
+	writeProblem(p.ResponseWriter, p.r, status, problemCodeForStatus(status), detail)
+}
+
+// Flush permite el streaming (SSE) a través del envoltorio
+func (p *problemWriter) Flush() {
+	if f, ok := p.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap deja a http.ResponseController llegar al ResponseWriter original
+func (p *problemWriter) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
+
+// withProblemErrors responde a los errores con application/problem+json
+func withProblemErrors(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(&problemWriter{ResponseWriter: w, r: r}, r)
+	}
+}
+
+// problemFromDbError responde al error de base de datos con el problema de dbProblem
+func problemFromDbError(w http.ResponseWriter, r *http.Request, detail string, err error) {
+	writeProblemError(w, r, dbProblem(detail, err))
+}
+
+// writeProblemError responde con el *api.Problem que devuelven los servicios (services.go);
+// cualquier otro error es un 500
+func writeProblemError(w http.ResponseWriter, r *http.Request, err error) {
+	var problem *api.Problem
+	if !errors.As(err, &problem) {
+		problem = newProblem(http.StatusInternalServerError, api.ProblemInternal, err.Error())
+	}
+	writeProblem(w, r, problem.Status, problem.Code, problem.Detail, problem.Errors...)
+}
+
+// errJsonProblem responde a las rutas sin versión con el error de un servicio: el formato de
+// errJsonStatus, con el estado del *api.Problem y los campos no válidos en el mensaje
+func errJsonProblem(w http.ResponseWriter, err error) {
+	var problem *api.Problem
+	if !errors.As(err, &problem) {
+		errJsonStatus(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	msg := problem.Detail
+	for _, f := range problem.Errors {
+		msg += fmt.Sprintf("; %s: %s", f.Field, f.Message)
+	}
+	errJsonStatus(w, msg, problem.Status)
+}
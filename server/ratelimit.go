@@ -0,0 +1,478 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Limitación de peticiones con cubos de tokens (token bucket). Cada regla define la clave
+// (ip, token o auth_client), el caudal sostenido (limit por period) y la ráfaga (burst).
+// Se aplican todas las reglas que coinciden con la ruta; con una sola agotada se responde 429.
+// Además withAuth limita los intentos fallidos de autenticación por IP (rate_limit.auth_failures).
+//
+//	RATE_LIMIT_RULES='[{"path":"/persons/{id}/applications/{app_id}/session","key":"auth_client","limit":30,"period":"1m","burst":10}]'
+//
+// El estado vive en memoria (por réplica) o en Redis (compartido entre réplicas).
+
+const (
+	rateLimitKeyIP         = "ip"
+	rateLimitKeyToken      = "token"
+	rateLimitKeyAuthClient = "auth_client"
+)
+
+// RateLimitRule define un cubo de tokens. Un path terminado en "/" coincide por prefijo,
+// como en http.ServeMux; si no, exacto.
+type RateLimitRule struct {
+	Method string   `json:"method,omitempty" yaml:"method,omitempty"`
+	Path   string   `json:"path" yaml:"path"`
+	Key    string   `json:"key" yaml:"key"`
+	Limit  int      `json:"limit" yaml:"limit"`
+	Period Duration `json:"period" yaml:"period"`
+	Burst  int      `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool   `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	Backend string `yaml:"backend" env:"RATE_LIMIT_BACKEND"`
+	// solo detrás de un proxy de confianza (ingress): la IP se toma de X-Forwarded-For,
+	// contando trusted_hops entradas desde la derecha (las que añaden nuestros proxies)
+	TrustForwarded bool            `yaml:"trust_forwarded" env:"RATE_LIMIT_TRUST_FORWARDED"`
+	TrustedHops    int             `yaml:"trusted_hops" env:"RATE_LIMIT_TRUSTED_HOPS"`
+	Rules          []RateLimitRule `yaml:"rules" env:"RATE_LIMIT_RULES"`
+	AuthFailures   RateLimitRule   `yaml:"auth_failures" env:"RATE_LIMIT_AUTH_FAILURES"`
+}
+
+func (c RateLimitConfig) validate() []string {
+	var problems []string
+	switch c.Backend {
+	case "memory", "redis":
+	default:
+		problems = append(problems, fmt.Sprintf("rate_limit.backend no válido: %q (memory o redis)", c.Backend))
+	}
+	if c.TrustedHops < 1 {
+		problems = append(problems, fmt.Sprintf("rate_limit.trusted_hops debe ser al menos 1: %d", c.TrustedHops))
+	}
+	for i, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("rate_limit.rules[%d]: %v", i, err))
+		}
+	}
+	if c.AuthFailures.Limit > 0 {
+		rule := c.authFailuresRule()
+		if err := rule.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("rate_limit.auth_failures: %v", err))
+		}
+	}
+	return problems
+}
+
+func (rule RateLimitRule) validate() error {
+	if !strings.HasPrefix(rule.Path, "/") {
+		return fmt.Errorf("path debe empezar por /")
+	}
+	switch rule.Key {
+	case rateLimitKeyIP, rateLimitKeyToken, rateLimitKeyAuthClient:
+	default:
+		return fmt.Errorf("key no válida: %q (ip, token o auth_client)", rule.Key)
+	}
+	if rule.Limit <= 0 || rule.Period <= 0 {
+		return fmt.Errorf("limit y period deben ser positivos")
+	}
+	if rule.Burst < 0 {
+		return fmt.Errorf("burst no puede ser negativo")
+	}
+	return nil
+}
+
+func (rule RateLimitRule) matches(r *http.Request) bool {
+	if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+		return false
+	}
+	if strings.HasSuffix(rule.Path, "/") {
+		return strings.HasPrefix(r.URL.Path, rule.Path)
+	}
+	if strings.Contains(rule.Path, "{") {
+		return rateLimitPathMatches(rule.Path, r.URL.Path)
+	}
+	return r.URL.Path == rule.Path
+}
+
+// rateLimitPathMatches compara segmento a segmento; {param} acepta cualquier valor
+func rateLimitPathMatches(pattern, path string) bool {
+	ps := strings.Split(pattern, "/")
+	segments := strings.Split(path, "/")
+	if len(ps) != len(segments) {
+		return false
+	}
+	for i, p := range ps {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// capacity es el tamaño del cubo; sin burst es el propio límite
+func (rule RateLimitRule) capacity() float64 {
+	if rule.Burst > 0 {
+		return float64(rule.Burst)
+	}
+	return float64(rule.Limit)
+}
+
+// rate es el número de tokens que se recuperan por segundo
+func (rule RateLimitRule) rate() float64 {
+	return float64(rule.Limit) / rule.Period.D().Seconds()
+}
+
+// rateLimitStore guarda los cubos. take repone los tokens según el tiempo transcurrido y,
+// si quedan al menos max(cost, 1), descuenta cost; devuelve los tokens que quedan.
+// Con cost 0 solo se consulta si el cubo está agotado.
+type rateLimitStore interface {
+	take(ctx context.Context, key string, rule RateLimitRule, cost int) (tokens float64, allowed bool, err error)
+}
+
+type rateLimiter struct {
+	config RateLimitConfig
+	store  rateLimitStore
+}
+
+// rateLimits es el limitador del proceso; nil si está desactivado
+var rateLimits *rateLimiter
+
+// rateLimitInit prepara el limitador con el backend configurado
+func rateLimitInit(config RateLimitConfig, redisConfig RedisConfig) {
+	if !config.Enabled {
+		rateLimits = nil
+		return
+	}
+	var store rateLimitStore = newMemoryRateLimitStore()
+	if config.Backend == "redis" {
+		store = newRedisRateLimitStore(redisConfig)
+	}
+	rateLimits = &rateLimiter{config: config, store: store}
+	slog.Info("Limitación de peticiones activada", "backend", config.Backend, "rules", len(config.Rules))
+}
+
+// clientIP devuelve la IP del cliente; X-Forwarded-For solo si se confía en el proxy.
+// Las entradas de la izquierda las pone el cliente y se pueden falsificar: se toma la que
+// añadió el primero de nuestros proxies, trusted_hops posiciones desde la derecha
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	if l.config.TrustForwarded {
+		var hops []string
+		for _, xff := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(xff, ",")...)
+		}
+		if i := len(hops) - l.config.TrustedHops; i >= 0 {
+			if ip := strings.TrimSpace(hops[i]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// key construye la clave del cubo; los tokens se guardan como hash, nunca en claro
+func (l *rateLimiter) key(r *http.Request, i int, rule RateLimitRule) string {
+	subject := ""
+	switch rule.Key {
+	case rateLimitKeyToken:
+		if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+			sum := sha256.Sum256([]byte(token))
+			subject = "token:" + hex.EncodeToString(sum[:12])
+		}
+	case rateLimitKeyAuthClient:
+		if info := requestInfoFrom(r.Context()); info != nil && info.Principal != "" {
+			subject = "auth_client:" + rateLimitAuthClient(info.Principal)
+		}
+	}
+	// sin token ni aplicación identificada se limita por IP
+	if subject == "" {
+		subject = "ip:" + l.clientIP(r)
+	}
+	return fmt.Sprintf("%d:%s", i, subject)
+}
+
+// rateLimitAuthClient extrae la aplicación del principal que deja withAuth (user:1@ERP, client:CRM, mtls:CRM)
+func rateLimitAuthClient(principal string) string {
+	if _, client, ok := strings.Cut(principal, "@"); ok {
+		return client
+	}
+	if _, client, ok := strings.Cut(principal, ":"); ok {
+		return client
+	}
+	return principal
+}
+
+// rateLimitResult es el estado del cubo más restrictivo, para las cabeceras de respuesta
+type rateLimitResult struct {
+	rule    RateLimitRule
+	tokens  float64
+	allowed bool
+}
+
+// check consume un token de cada regla que coincide con la petición
+func (l *rateLimiter) check(r *http.Request) (*rateLimitResult, bool) {
+	var worst *rateLimitResult
+	for i, rule := range l.config.Rules {
+		if !rule.matches(r) {
+			continue
+		}
+		tokens, allowed, err := l.store.take(r.Context(), l.key(r, i, rule), rule, 1)
+		if err != nil {
+			// si el backend falla no se bloquea el tráfico
+			requestLogger(r.Context()).Warn("error en el limitador de peticiones", "error", err)
+			continue
+		}
+		result := &rateLimitResult{rule: rule, tokens: tokens, allowed: allowed}
+		if !allowed {
+			observeRateLimited(rule)
+			return result, false
+		}
+		if worst == nil || tokens/rule.capacity() < worst.tokens/worst.rule.capacity() {
+			worst = result
+		}
+	}
+	return worst, true
+}
+
+// setHeaders escribe RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset y RateLimit-Policy
+// (draft-ietf-httpapi-ratelimit-headers) y Retry-After si se ha rechazado la petición
+func (res *rateLimitResult) setHeaders(w http.ResponseWriter) {
+	rule := res.rule
+	remaining := int(math.Max(0, math.Floor(res.tokens)))
+	reset := int(math.Ceil((rule.capacity() - res.tokens) / rule.rate()))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(rule.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", rule.Limit, int(rule.Period.D().Seconds()), int(rule.capacity())))
+	if !res.allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(res.retryAfter()))
+	}
+}
+
+// retryAfter son los segundos hasta que vuelve a haber un token en el cubo
+func (res *rateLimitResult) retryAfter() int {
+	retryAfter := int(math.Ceil((1 - res.tokens) / res.rule.rate()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	return retryAfter
+}
+
+// middleware de limitación de peticiones; va dentro de withAuth para conocer la aplicación
+func withRateLimit(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limiter := rateLimits
+		if limiter == nil {
+			handler(w, r)
+			return
+		}
+
+		result, ok := limiter.check(r)
+		if result != nil {
+			result.setHeaders(w)
+		}
+		if !ok {
+			errJsonStatus(w, `Demasiadas peticiones`, http.StatusTooManyRequests)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// rateLimitAuthBlocked indica si la IP ha agotado los intentos fallidos de autenticación;
+// en ese caso escribe las cabeceras con el tiempo de espera
+func rateLimitAuthBlocked(w http.ResponseWriter, r *http.Request) bool {
+	res := rateLimitAuthCheck(r)
+	if res == nil {
+		return false
+	}
+	res.setHeaders(w)
+	return true
+}
+
+// rateLimitAuthCheck devuelve el resultado si la IP ha agotado los intentos fallidos y nil
+// si puede intentarlo; gRPC lo usa sin cabeceras HTTP
+func rateLimitAuthCheck(r *http.Request) *rateLimitResult {
+	limiter := rateLimits
+	if limiter == nil || limiter.config.AuthFailures.Limit <= 0 {
+		return nil
+	}
+	rule := limiter.config.authFailuresRule()
+	tokens, allowed, err := limiter.store.take(r.Context(), limiter.authFailuresKey(r), rule, 0)
+	if err != nil {
+		requestLogger(r.Context()).Warn("error en el limitador de peticiones", "error", err)
+		return nil
+	}
+	if allowed {
+		return nil
+	}
+	observeRateLimited(rule)
+	return &rateLimitResult{rule: rule, tokens: tokens, allowed: false}
+}
+
+// rateLimitAuthFailed descuenta un intento fallido de autenticación de la IP
+func rateLimitAuthFailed(r *http.Request) {
+	limiter := rateLimits
+	if limiter == nil || limiter.config.AuthFailures.Limit <= 0 {
+		return
+	}
+	_, _, err := limiter.store.take(r.Context(), limiter.authFailuresKey(r), limiter.config.authFailuresRule(), 1)
+	if err != nil {
+		requestLogger(r.Context()).Warn("error en el limitador de peticiones", "error", err)
+	}
+}
+
+// authFailuresRule es la regla de intentos fallidos, siempre por IP
+func (c RateLimitConfig) authFailuresRule() RateLimitRule {
+	rule := c.AuthFailures
+	rule.Path, rule.Key = "/", rateLimitKeyIP
+	return rule
+}
+
+func (l *rateLimiter) authFailuresKey(r *http.Request) string {
+	return "auth_failures:ip:" + l.clientIP(r)
+}
+
+// memoryRateLimitStore guarda los cubos en memoria; cada réplica limita por separado
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	cleanedAt time.Time
+}
+
+type memoryBucket struct {
+	tokens float64
+	at     time.Time
+	full   time.Duration
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{buckets: map[string]*memoryBucket{}, cleanedAt: time.Now()}
+}
+
+func (s *memoryRateLimitStore) take(ctx context.Context, key string, rule RateLimitRule, cost int) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.cleanup(now)
+
+	capacity := rule.capacity()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: capacity, at: now, full: time.Duration(capacity / rule.rate() * float64(time.Second))}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.at).Seconds()*rule.rate())
+	b.at = now
+
+	if b.tokens < math.Max(float64(cost), 1) {
+		return b.tokens, false, nil
+	}
+	b.tokens -= float64(cost)
+	return b.tokens, true, nil
+}
+
+// cleanup elimina, como mucho una vez por minuto, los cubos que ya se habrían llenado
+func (s *memoryRateLimitStore) cleanup(now time.Time) {
+	if now.Sub(s.cleanedAt) < time.Minute {
+		return
+	}
+	s.cleanedAt = now
+	for key, b := range s.buckets {
+		if now.Sub(b.at) > b.full {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// redisRateLimitStore comparte los cubos entre réplicas; el script hace la lectura
+// y la actualización de forma atómica
+type redisRateLimitStore struct {
+	client *redis.Client
+}
+
+var redisTokenBucket = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local ttl = tonumber(ARGV[5])
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(data[1])
+local at = tonumber(data[2])
+if tokens == nil then
+	tokens = capacity
+	at = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - at) * rate)
+
+local allowed = 0
+if tokens >= math.max(cost, 1) then
+	tokens = tokens - cost
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'at', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+func newRedisRateLimitStore(config RedisConfig) *redisRateLimitStore {
+	return &redisRateLimitStore{client: redis.NewClient(&redis.Options{
+		Addr:         net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		Password:     config.Password,
+		DB:           config.DB,
+		DialTimeout:  config.Timeout.D(),
+		ReadTimeout:  config.Timeout.D(),
+		WriteTimeout: config.Timeout.D(),
+	})}
+}
+
+func (s *redisRateLimitStore) take(ctx context.Context, key string, rule RateLimitRule, cost int) (float64, bool, error) {
+	capacity := rule.capacity()
+	now := float64(time.Now().UnixMicro()) / 1e6
+	// la clave caduca cuando el cubo ya estaría lleno
+	ttl := int64(math.Ceil(capacity/rule.rate()*1000)) + 1000
+
+	res, err := redisTokenBucket.Run(ctx, s.client, []string{"erp:ratelimit:" + key},
+		capacity, rule.rate(), now, cost, ttl).Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	if len(res) != 2 {
+		return 0, false, fmt.Errorf("respuesta inesperada de redis: %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("respuesta inesperada de redis: %v", res)
+	}
+	return tokens, allowed == 1, nil
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+)
+
+/*
+	CREATE TABLE IF NOT EXISTS auth_client_redirect_uris (
+		id SERIAL PRIMARY KEY,
+		auth_client_id INT NOT NULL,
+		uri VARCHAR(255) NOT NULL,
+		kind VARCHAR(16) NOT NULL DEFAULT 'login',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		...
+	);
+*/
+
+// tipos de redirect_uri que puede registrar una aplicación
+const (
+	redirectUriKindLogin      = "login"
+	redirectUriKindPostLogout = "post_logout"
+)
+
+// initTableAuthClientRedirectUris crea la tabla "auth_client_redirect_uris" si no existe
+// cada aplicación puede registrar varias URIs de redirección (comparación exacta)
+func initTableAuthClientRedirectUris(db *sql.DB) error {
+
+	// SQL para crear la tabla si no existe
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS auth_client_redirect_uris (
+			id SERIAL PRIMARY KEY,
+			auth_client_id INT NOT NULL,
+			uri VARCHAR(255) NOT NULL,
+			kind VARCHAR(16) NOT NULL DEFAULT 'login',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (auth_client_id) REFERENCES auth_clients(id) ON DELETE CASCADE,
+			CONSTRAINT kind_check CHECK (kind IN ('login', 'post_logout')),
+			UNIQUE (auth_client_id, uri, kind)
+		);`
+
+	// Ejecuta la creación de la tabla
+	_, err := db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al crear la tabla auth_client_redirect_uris: %v", err)
+	}
+
+	return nil
+}
+
+// insertAuthClientRedirectUris registra como redirect_uri el callback heredado de cada aplicación
+func insertAuthClientRedirectUris(db *sql.DB) error {
+
+	insertSQL := `
+		INSERT INTO auth_client_redirect_uris (auth_client_id, uri, kind)
+		SELECT id, client_url_callback, 'login'
+		FROM auth_clients
+		WHERE client_url_callback IS NOT NULL AND client_url_callback <> ''
+		ON CONFLICT DO NOTHING;`
+
+	// Ejecuta
+	_, err := db.Exec(insertSQL)
+	if err != nil {
+		return fmt.Errorf("error al insertar auth_client_redirect_uris: %v", err)
+	}
+
+	return nil
+}
+
+func dropTableAuthClientRedirectUris(db *sql.DB) error {
+
+	// SQL para eliminar la tabla "auth_client_redirect_uris"
+	dropTableSQL := `DROP TABLE IF EXISTS auth_client_redirect_uris;`
+
+	// Ejecuta la eliminación de la tabla
+	_, err := db.Exec(dropTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al eliminar la tabla auth_client_redirect_uris: %v", err)
+	}
+	return nil
+}
+
+// loginRedirectUris devuelve las redirect_uri de login registradas,
+// incluyendo el client_url_callback heredado si no está ya en la lista
+func (app *AuthClient) loginRedirectUris() []string {
+	list := append([]string{}, app.RedirectUris...)
+	if app.ClientUrlCallback != nil && *app.ClientUrlCallback != "" {
+		for _, uri := range list {
+			if uri == *app.ClientUrlCallback {
+				return list
+			}
+		}
+		list = append(list, *app.ClientUrlCallback)
+	}
+	return list
+}
+
+// validateRedirectUriFormat comprueba que una URI se pueda registrar:
+// absoluta, http o https, con host y sin fragmento
+func validateRedirectUriFormat(uri string) error {
+	if uri == "" {
+		return fmt.Errorf("la redirect_uri no puede estar vacía")
+	}
+	if len(uri) > 255 {
+		return fmt.Errorf("la redirect_uri %q supera los 255 caracteres", uri)
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("la redirect_uri %q no es una URL válida: %v", uri, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("la redirect_uri %q debe usar http o https", uri)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("la redirect_uri %q debe ser absoluta", uri)
+	}
+	if u.Fragment != "" || u.RawFragment != "" {
+		return fmt.Errorf("la redirect_uri %q no puede contener fragmento", uri)
+	}
+	return nil
+}
+
+// validateRedirectUrisFormat valida una lista de URIs a registrar
+func validateRedirectUrisFormat(list []string) error {
+	for _, uri := range list {
+		if err := validateRedirectUriFormat(uri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveRedirectUri devuelve la redirect_uri a usar en un flujo:
+// si se suministra debe coincidir exactamente con una registrada;
+// si no se suministra solo se admite cuando hay una única registrada
+func resolveRedirectUri(registered []string, supplied string) (string, error) {
+	if len(registered) == 0 {
+		return "", fmt.Errorf("la aplicación no tiene registrada ninguna redirect_uri")
+	}
+	if supplied == "" {
+		if len(registered) == 1 {
+			return registered[0], nil
+		}
+		return "", fmt.Errorf("el parámetro redirect_uri es requerido: la aplicación tiene %d registradas", len(registered))
+	}
+	for _, uri := range registered {
+		if uri == supplied {
+			return uri, nil
+		}
+	}
+	return "", fmt.Errorf("la redirect_uri %q no está registrada para la aplicación", supplied)
+}
+
+func postgres_auth_client_redirect_uris_load(ctx context.Context, db *sql.DB, app *AuthClient) error {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_redirect_uris_load")
+	defer span.End()
+
+	query := `
+		SELECT
+			uri, kind
+		FROM
+			auth_client_redirect_uris
+		WHERE
+			auth_client_id = $1
+		ORDER BY id;`
+	rows, err := db.QueryContext(ctx, query, app.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	app.RedirectUris = nil
+	app.PostLogoutRedirectUris = nil
+	for rows.Next() {
+		var uri, kind string
+		if err := rows.Scan(&uri, &kind); err != nil {
+			return err
+		}
+		if kind == redirectUriKindPostLogout {
+			app.PostLogoutRedirectUris = append(app.PostLogoutRedirectUris, uri)
+		} else {
+			app.RedirectUris = append(app.RedirectUris, uri)
+		}
+	}
+	return rows.Err()
+}
+
+// postgres_auth_client_redirect_uris_replace sustituye dentro de una transacción las URIs de un tipo por la lista dada
+func postgres_auth_client_redirect_uris_replace(ctx context.Context, tx *sql.Tx, id_app int, kind string, list []string) error {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_redirect_uris_replace")
+	defer span.End()
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM auth_client_redirect_uris WHERE auth_client_id = $1 AND kind = $2;`, id_app, kind)
+	if err != nil {
+		return err
+	}
+
+	for _, uri := range list {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO auth_client_redirect_uris (auth_client_id, uri, kind)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING;`, id_app, uri, kind)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tabla de rutas con los patrones de http.ServeMux de Go 1.22 ("GET /persons/{id}").
+// El ServeMux responde 405 con la cabecera Allow cuando la ruta existe con otro método.
+// Las rutas antiguas (/person/, /application/, ...) siguen funcionando durante la
+// retirada a través de legacyRoutes, con las cabeceras Deprecation, Sunset y Link.
+
+type route struct {
+	method  string // vacío: cualquier método (mantenimiento)
+	path    string
+	handler http.HandlerFunc
+	public  bool // sin autenticación, CORS ni chaos (/init, /clean, /status)
+	noChaos bool // /admin/chaos no se ve afectado por sus propias reglas
+	master  bool // solo con el AUTH_TOKEN maestro, no con tokens OAuth ni certificados
+}
+
+func (rt route) pattern() string {
+	if rt.method == "" {
+		return rt.path
+	}
+	return rt.method + " " + rt.path
+}
+
+// apiRoutes devuelve las rutas de la API
+func apiRoutes(db *sql.DB) []route {
+	routes := []route{
+		{method: http.MethodGet, path: "/auth", handler: getAuthHandler},
+
+		{method: http.MethodGet, path: "/persons", handler: getPersonsHandler(db)},
+		{method: http.MethodPost, path: "/persons", handler: postPersonHandler(db)},
+		{method: http.MethodGet, path: "/persons/export", handler: personsExportHandler(db)},
+		{method: http.MethodPost, path: "/persons/import", handler: personsImportHandler(db)},
+		{method: http.MethodGet, path: "/persons/import/{id}", handler: personsImportReportHandler(db)},
+		{method: http.MethodGet, path: "/persons/{id}", handler: getPersonHandler(db)},
+		{method: http.MethodPut, path: "/persons/{id}", handler: putPersonHandler(db)},
+		{method: http.MethodDelete, path: "/persons/{id}", handler: deletePersonHandler(db)},
+		{method: http.MethodPost, path: "/persons/{id}/logout", handler: logoutHandler(db)},
+		{method: http.MethodGet, path: "/persons/{id}/applications/{app_id}", handler: getPersonAppHandler(db)},
+		{method: http.MethodPost, path: "/persons/{id}/applications/{app_id}", handler: postPersonAppHandler(db)},
+		{method: http.MethodPut, path: "/persons/{id}/applications/{app_id}", handler: putPersonAppHandler(db)},
+		{method: http.MethodDelete, path: "/persons/{id}/applications/{app_id}", handler: deletePersonAppHandler(db)},
+		{method: http.MethodPost, path: "/persons/{id}/applications/{app_id}/session", handler: personAppSessionHandler(db)},
+
+		{method: http.MethodGet, path: "/applications", handler: getAuthClientsHandler(db)},
+		{method: http.MethodPost, path: "/applications", handler: postAuthClientHandler(db)},
+		{method: http.MethodGet, path: "/applications/{id}", handler: getAuthClientHandler(db)},
+		{method: http.MethodPut, path: "/applications/{id}", handler: putAuthClientHandler(db)},
+		{method: http.MethodDelete, path: "/applications/{id}", handler: deleteAuthClientHandler(db)},
+		{method: http.MethodPut, path: "/applications/{id}/status", handler: putAuthClientStatusHandler(db)},
+		{method: http.MethodGet, path: "/authini/{client_id}", handler: authIniHandler(db)},
+		{method: http.MethodGet, path: "/logout-deliveries", handler: logoutDeliveriesHandler(db)},
+
+		{method: http.MethodGet, path: "/webhooks", handler: getWebhooksHandler(db)},
+		{method: http.MethodPost, path: "/webhooks", handler: postWebhookHandler(db)},
+		{method: http.MethodGet, path: "/webhooks/{id}", handler: getWebhookHandler(db)},
+		{method: http.MethodPut, path: "/webhooks/{id}", handler: putWebhookHandler(db)},
+		{method: http.MethodDelete, path: "/webhooks/{id}", handler: deleteWebhookHandler(db)},
+		{method: http.MethodGet, path: "/webhook-deliveries", handler: getWebhookDeliveriesHandler(db)},
+		{method: http.MethodPost, path: "/webhook-deliveries/{id}/retry", handler: webhookDeliveryRetryHandler(db)},
+
+		{method: http.MethodGet, path: "/events", handler: getEventsHandler(db)},
+		{method: http.MethodGet, path: "/events/stream", handler: getEventsStreamHandler(db)},
+
+		// consultas GraphQL de solo lectura (graphql.go)
+		{method: http.MethodPost, path: "/graphql", handler: graphqlHandler(db)},
+
+		{path: "/init", handler: initTablesHandler(db), public: true},
+		{path: "/clean", handler: dropTables(db), public: true},
+		{path: "/status", handler: checkTable(db), public: true},
+
+		// especificación OpenAPI y Swagger UI (openapi.go)
+		{method: http.MethodGet, path: "/openapi.json", handler: openapiHandler, public: true},
+		{method: http.MethodGet, path: "/docs/", handler: docsHandler(), public: true},
+	}
+	// SCIM 2.0 (scim.go)
+	return append(routes, scimRoutes(db)...)
+}
+
+// registerRoutes monta las rutas con la cadena de middlewares; cada ruta declara sus
+// métodos para CORS. OPTIONS no se registra: lo resuelve withRouteErrors con el Allow del ServeMux.
+func registerRoutes(mux *http.ServeMux, routes []route, cors *corsPolicy, db *sql.DB, auth_token string) {
+	methods := map[string][]string{}
+	for _, rt := range routes {
+		if rt.method != "" {
+			methods[rt.path] = append(methods[rt.path], rt.method)
+		}
+	}
+
+	for _, rt := range routes {
+		h := withRateLimit(rt.handler)
+		if !rt.public {
+			allowed := methods[rt.path]
+			if rt.method == "" {
+				allowed = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+			}
+			// los fallos se inyectan ya autenticado, para no dar respuestas a quien no tiene credenciales
+			if !rt.noChaos {
+				h = withChaos(h)
+			}
+			if rt.master {
+				h = withMasterToken(h, auth_token)
+			}
+			h = cors.middleware(withAuth(h, db, auth_token), allowed...)
+		}
+		if strings.HasPrefix(rt.path, apiV1Prefix+"/") {
+			h = withProblemErrors(h)
+		}
+		mux.HandleFunc(rt.pattern(), withMetrics(rt.path, withTracing(rt.path, withLogging(h))))
+	}
+}
+
+// pathInt lee un identificador numérico positivo de la ruta; si no es válido responde 400
+func pathInt(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.PathValue(name)
+	iid, err := strconv.Atoi(value)
+	if err != nil {
+		errJsonStatus(w, fmt.Sprintf(`Error al parsear el %s: %v`, name, err), http.StatusBadRequest)
+		return 0, false
+	}
+	if iid <= 0 {
+		errJsonStatus(w, fmt.Sprintf(`El campo %s es requerido`, name), http.StatusBadRequest)
+		return 0, false
+	}
+	return iid, true
+}
+
+// withRouteErrors atiende lo que el ServeMux no resuelve con una ruta: 404 y 405 en JSON
+// (405 con Allow si la ruta existe con otros métodos) y OPTIONS, incluido el preflight CORS,
+// con los métodos que el ServeMux indica en Allow; bajo /api/v1 los errores son problem+json
+func withRouteErrors(mux *http.ServeMux, cors *corsPolicy) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		probe := &routeProbeWriter{header: http.Header{}}
+		h.ServeHTTP(probe, r)
+		if isApiV1(r) {
+			w = &problemWriter{ResponseWriter: w, r: r}
+		}
+		if probe.status == http.StatusMethodNotAllowed {
+			var methods []string
+			for _, m := range strings.Split(probe.header.Get("Allow"), ",") {
+				if m = strings.TrimSpace(m); m != "" && m != http.MethodHead && m != http.MethodOptions {
+					methods = append(methods, m)
+				}
+			}
+			if r.Method == http.MethodOptions {
+				preflight := cors.middleware(func(w http.ResponseWriter, r *http.Request) {}, methods...)
+				if isApiV1(r) {
+					preflight = withProblemErrors(preflight)
+				}
+				withLogging(preflight)(w, r)
+				return
+			}
+			w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+			errJsonStatus(w, `Método no permitido`, http.StatusMethodNotAllowed)
+			return
+		}
+
+		requestLogger(r.Context()).Info("ruta no encontrada", "method", r.Method, "path", r.URL.Path)
+		errJsonStatus(w, `Ruta no encontrada`, http.StatusNotFound)
+	})
+}
+
+// routeProbeWriter captura el estado y las cabeceras de la respuesta por defecto del ServeMux
+type routeProbeWriter struct {
+	header http.Header
+	status int
+}
+
+func (p *routeProbeWriter) Header() http.Header         { return p.header }
+func (p *routeProbeWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (p *routeProbeWriter) WriteHeader(status int)      { p.status = status }
+
+// LegacyRoutesConfig controla las rutas antiguas durante su retirada
+type LegacyRoutesConfig struct {
+	Enabled bool   `yaml:"enabled" env:"LEGACY_ROUTES_ENABLED"`
+	Sunset  string `yaml:"sunset" env:"LEGACY_ROUTES_SUNSET"`
+}
+
+// legacyDeprecatedAt es la fecha en que se marcaron obsoletas las rutas antiguas
+var legacyDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+func (c LegacyRoutesConfig) validate() []string {
+	if c.Sunset == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.DateOnly, c.Sunset); err != nil {
+		return []string{fmt.Sprintf("legacy_routes.sunset no es una fecha AAAA-MM-DD: %q", c.Sunset)}
+	}
+	return nil
+}
+
+// legacyTarget es la ruta nueva a la que se traduce un método de una ruta antigua
+type legacyTarget struct {
+	path    string // ruta nueva con {parámetros}, para la cabecera Link
+	handler http.HandlerFunc
+	create  bool // alta con id 0 en la URL (POST /person/0)
+}
+
+// legacyRoute traduce una ruta antigua por prefijo: los segmentos tras el prefijo
+// se asignan por orden a params y se llama al manejador nuevo del método
+type legacyRoute struct {
+	prefix  string
+	params  []string
+	targets map[string]legacyTarget
+}
+
+// legacyRoutes son las rutas anteriores a la tabla de rutas, pendientes de retirar
+func legacyRoutes(db *sql.DB) []legacyRoute {
+	return []legacyRoute{
+		{prefix: "/person/", params: []string{"id"}, targets: map[string]legacyTarget{
+			http.MethodGet:    {path: "/persons/{id}", handler: getPersonHandler(db)},
+			http.MethodPost:   {path: "/persons", handler: postPersonHandler(db), create: true},
+			http.MethodPut:    {path: "/persons/{id}", handler: putPersonHandler(db)},
+			http.MethodDelete: {path: "/persons/{id}", handler: legacyQueryId(deletePersonHandler(db))},
+		}},
+		{prefix: "/application/", params: []string{"id"}, targets: map[string]legacyTarget{
+			http.MethodGet:    {path: "/applications/{id}", handler: getAuthClientHandler(db)},
+			http.MethodPost:   {path: "/applications", handler: postAuthClientHandler(db), create: true},
+			http.MethodPut:    {path: "/applications/{id}", handler: putAuthClientHandler(db)},
+			http.MethodDelete: {path: "/applications/{id}", handler: deleteAuthClientHandler(db)},
+		}},
+		{prefix: "/personapp/", params: []string{"id", "app_id"}, targets: map[string]legacyTarget{
+			http.MethodGet:    {path: "/persons/{id}/applications/{app_id}", handler: getPersonAppHandler(db)},
+			http.MethodPost:   {path: "/persons/{id}/applications/{app_id}", handler: postPersonAppHandler(db)},
+			http.MethodPut:    {path: "/persons/{id}/applications/{app_id}", handler: putPersonAppHandler(db)},
+			http.MethodDelete: {path: "/persons/{id}/applications/{app_id}", handler: deletePersonAppHandler(db)},
+		}},
+		{prefix: "/personapp-session/", params: []string{"id", "app_id"}, targets: map[string]legacyTarget{
+			http.MethodPost: {path: "/persons/{id}/applications/{app_id}/session", handler: personAppSessionHandler(db)},
+		}},
+		{prefix: "/logout/", params: []string{"id"}, targets: map[string]legacyTarget{
+			http.MethodPost: {path: "/persons/{id}/logout", handler: logoutHandler(db)},
+		}},
+		{prefix: "/webhook/", params: []string{"id"}, targets: map[string]legacyTarget{
+			http.MethodGet:    {path: "/webhooks/{id}", handler: getWebhookHandler(db)},
+			http.MethodPost:   {path: "/webhooks", handler: postWebhookHandler(db), create: true},
+			http.MethodPut:    {path: "/webhooks/{id}", handler: putWebhookHandler(db)},
+			http.MethodDelete: {path: "/webhooks/{id}", handler: deleteWebhookHandler(db)},
+		}},
+		{prefix: "/webhook-delivery/", params: []string{"id", "action"}, targets: map[string]legacyTarget{
+			http.MethodPost: {path: "/webhook-deliveries/{id}/retry", handler: webhookDeliveryRetryHandler(db)},
+		}},
+	}
+}
+
+// legacyQueryId mantiene el DELETE /person/{id}?id=N antiguo, que borraba el id del parámetro
+func legacyQueryId(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id := r.URL.Query().Get("id"); id != "" {
+			r.SetPathValue("id", id)
+		}
+		handler(w, r)
+	}
+}
+
+func (lr legacyRoute) methods() []string {
+	list := make([]string, 0, len(lr.targets))
+	for method := range lr.targets {
+		list = append(list, method)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// handler traduce la petición antigua y añade las cabeceras de obsolescencia (RFC 9745 y RFC 8594)
+func (lr legacyRoute) handler(config LegacyRoutesConfig) http.HandlerFunc {
+	allow := strings.Join(append(lr.methods(), http.MethodOptions), ", ")
+	deprecation := fmt.Sprintf("@%d", legacyDeprecatedAt.Unix())
+	sunset := ""
+	if t, err := time.Parse(time.DateOnly, config.Sunset); err == nil {
+		sunset = t.UTC().Format(http.TimeFormat)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		target, ok := lr.targets[r.Method]
+		if !ok {
+			w.Header().Set("Allow", allow)
+			errJsonStatus(w, `Método no permitido`, http.StatusMethodNotAllowed)
+			return
+		}
+
+		segments := strings.Split(strings.TrimPrefix(r.URL.Path, lr.prefix), "/")
+		if len(segments) < len(lr.params) {
+			errJsonStatus(w, fmt.Sprintf(`Se esperan %d parámetros en la URL`, len(lr.params)), http.StatusBadRequest)
+			return
+		}
+		successor := target.path
+		for i, name := range lr.params {
+			r.SetPathValue(name, segments[i])
+			successor = strings.Replace(successor, "{"+name+"}", segments[i], 1)
+		}
+		w.Header().Set("Deprecation", deprecation)
+		if sunset != "" {
+			w.Header().Set("Sunset", sunset)
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		observeLegacyRoute(lr.prefix)
+
+		if target.create && segments[0] != "0" {
+			errJsonStatus(w, `El campo id no puede ser diferente de 0 para insertar`, http.StatusBadRequest)
+			return
+		}
+
+		target.handler(w, r)
+	}
+}
+
+// registerLegacyRoutes monta las rutas antiguas por prefijo, con la misma cadena de middlewares
+func registerLegacyRoutes(mux *http.ServeMux, routes []legacyRoute, config LegacyRoutesConfig, cors *corsPolicy, db *sql.DB, auth_token string) {
+	for _, lr := range routes {
+		h := cors.middleware(withAuth(withChaos(withRateLimit(lr.handler(config))), db, auth_token), lr.methods()...)
+		mux.HandleFunc(lr.prefix, withMetrics(lr.prefix, withTracing(lr.prefix, withLogging(h))))
+	}
+}
@@ -0,0 +1,1206 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// API de aprovisionamiento SCIM 2.0 (RFC 7643 / RFC 7644)
+//   - Users:  persons (dni como externalId, email como userName)
+//   - Groups: auth_clients, con las personas de person_auth_client como members
+
+const (
+	scimSchemaUser     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup    = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaList     = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaPatchOp  = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimSchemaError    = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSchemaSPConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimMaxResults = 200
+)
+
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	Location     string `json:"location"`
+	Version      string `json:"version"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+type ScimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type ScimUser struct {
+	Schemas      []string         `json:"schemas"`
+	ID           string           `json:"id,omitempty"`
+	ExternalID   string           `json:"externalId"`
+	UserName     string           `json:"userName"`
+	Name         ScimName         `json:"name"`
+	DisplayName  string           `json:"displayName,omitempty"`
+	Emails       []ScimMultiValue `json:"emails,omitempty"`
+	PhoneNumbers []ScimMultiValue `json:"phoneNumbers,omitempty"`
+	Active       *bool            `json:"active,omitempty"`
+	Groups       []ScimMultiValue `json:"groups,omitempty"`
+	Meta         *ScimMeta        `json:"meta,omitempty"`
+}
+
+type ScimGroup struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []ScimMultiValue `json:"members"`
+	Meta        *ScimMeta        `json:"meta,omitempty"`
+}
+
+type ScimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// scimErr es un error que se devuelve al cliente con su status y scimType
+type scimErr struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimErr) Error() string { return e.detail }
+
+func newScimErr(status int, scimType string, format string, args ...any) *scimErr {
+	return &scimErr{status: status, scimType: scimType, detail: fmt.Sprintf(format, args...)}
+}
+
+// scimMembership es una fila de person_auth_client con el client_id de la aplicación
+type scimMembership struct {
+	PersonID     int
+	AuthClientId int
+	ClientID     string
+}
+
+// scimRoutes devuelve las rutas SCIM por método; el ServeMux responde 404 y 405 como en el resto
+func scimRoutes(db *sql.DB) []route {
+	return []route{
+		{method: http.MethodGet, path: "/scim/v2/ServiceProviderConfig", handler: scimServiceProviderConfig},
+
+		{method: http.MethodGet, path: "/scim/v2/Users", handler: scimCollection(db, scimUsersList)},
+		{method: http.MethodPost, path: "/scim/v2/Users", handler: scimCollection(db, scimUserCreate)},
+		{method: http.MethodGet, path: "/scim/v2/Users/{id}", handler: scimResource(db, scimUserGet)},
+		{method: http.MethodPut, path: "/scim/v2/Users/{id}", handler: scimResource(db, scimUserModify)},
+		{method: http.MethodPatch, path: "/scim/v2/Users/{id}", handler: scimResource(db, scimUserModify)},
+		{method: http.MethodDelete, path: "/scim/v2/Users/{id}", handler: scimResource(db, func(db *sql.DB, w http.ResponseWriter, r *http.Request, base string, id int) error {
+			return scimUserDelete(db, w, r, id)
+		})},
+
+		{method: http.MethodGet, path: "/scim/v2/Groups", handler: scimCollection(db, scimGroupsList)},
+		{method: http.MethodPost, path: "/scim/v2/Groups", handler: scimGroupNotImplemented},
+		{method: http.MethodGet, path: "/scim/v2/Groups/{id}", handler: scimResource(db, scimGroupGet)},
+		{method: http.MethodPut, path: "/scim/v2/Groups/{id}", handler: scimResource(db, scimGroupModify)},
+		{method: http.MethodPatch, path: "/scim/v2/Groups/{id}", handler: scimResource(db, scimGroupModify)},
+		{method: http.MethodDelete, path: "/scim/v2/Groups/{id}", handler: scimGroupNotImplemented},
+	}
+}
+
+// scimCollection adapta los manejadores de /Users y /Groups, que responden los errores en formato SCIM
+func scimCollection(db *sql.DB, handler func(*sql.DB, http.ResponseWriter, *http.Request, string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := handler(db, w, r, scimBaseUrl(r)); err != nil {
+			scimError(w, err)
+		}
+	}
+}
+
+// scimResource es scimCollection para /Users/{id} y /Groups/{id}; un id no numérico es un 404 de SCIM
+func scimResource(db *sql.DB, handler func(*sql.DB, http.ResponseWriter, *http.Request, string, int) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			scimError(w, newScimErr(http.StatusNotFound, "", "Recurso no encontrado: %s", r.PathValue("id")))
+			return
+		}
+		if err := handler(db, w, r, scimBaseUrl(r), id); err != nil {
+			scimError(w, err)
+		}
+	}
+}
+
+// scimGroupNotImplemented responde a POST /Groups y DELETE /Groups/{id}: las aplicaciones
+// se gestionan en /applications, por SCIM solo sus miembros
+func scimGroupNotImplemented(w http.ResponseWriter, r *http.Request) {
+	scimError(w, newScimErr(http.StatusNotImplemented, "", "Los grupos son aplicaciones y no se pueden crear ni eliminar por SCIM"))
+}
+
+// scimError responde con el formato de error de SCIM
+func scimError(w http.ResponseWriter, err error) {
+	var se *scimErr
+	var pqErr *pq.Error
+	switch {
+	case errors.As(err, &se):
+	case errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation":
+		// dos altas simultáneas con el mismo externalId: la segunda choca con persons_dni_key
+		se = newScimErr(http.StatusConflict, "uniqueness", "Ya existe un User con ese externalId")
+	default:
+		se = &scimErr{status: http.StatusInternalServerError, detail: err.Error()}
+	}
+	scimJson(w, se.status, ScimError{
+		Schemas:  []string{scimSchemaError},
+		Status:   strconv.Itoa(se.status),
+		ScimType: se.scimType,
+		Detail:   se.detail,
+	})
+}
+
+func scimJson(w http.ResponseWriter, status int, data any) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		errJsonStatus(w, fmt.Sprintf(`Error al convertir a JSON: %v`, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
+
+// scimBaseUrl construye la URL pública de la API SCIM respetando el proxy/ingress
+func scimBaseUrl(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+		host = fwd
+	}
+	prefix := strings.TrimSuffix(r.Header.Get("X-Forwarded-Prefix"), "/")
+	return scheme + "://" + host + prefix + "/scim/v2"
+}
+
+func scimServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	scimJson(w, http.StatusOK, map[string]any{
+		"schemas":        []string{scimSchemaSPConfig},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": true},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Token Bearer en la cabecera Authorization",
+			"primary":     true,
+		}},
+	})
+}
+
+// scimVersion devuelve un ETag débil calculado a partir de los campos del recurso
+func scimVersion(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return `W/"` + hex.EncodeToString(h[:8]) + `"`
+}
+
+func scimPersonVersion(p PersonData) string {
+	telefono := ""
+	if p.Telefono != nil {
+		telefono = *p.Telefono
+	}
+	return scimVersion(strconv.Itoa(p.ID), p.Dni, p.Nombre, p.Apellidos, p.Email, telefono)
+}
+
+func scimGroupVersion(app AuthClientShort, memberIds []int) string {
+	ids := slices.Clone(memberIds)
+	slices.Sort(ids)
+	parts := []string{strconv.Itoa(app.ID), app.ClientID}
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return scimVersion(parts...)
+}
+
+// scimCheckIfMatch compara la cabecera If-Match con la versión actual
+func scimCheckIfMatch(r *http.Request, version string) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == version {
+			return nil
+		}
+	}
+	return newScimErr(http.StatusPreconditionFailed, "", "La versión del recurso ha cambiado (ETag %s)", version)
+}
+
+// scimNotModified indica si la cabecera If-None-Match coincide con la versión actual
+func scimNotModified(r *http.Request, version string) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(tag) == version {
+			return true
+		}
+	}
+	return false
+}
+
+func scimUser(p PersonData, groups []ScimMultiValue, base string) ScimUser {
+	active := true
+	user := ScimUser{
+		Schemas:    []string{scimSchemaUser},
+		ID:         strconv.Itoa(p.ID),
+		ExternalID: p.Dni,
+		UserName:   p.Email,
+		Name: ScimName{
+			Formatted:  strings.TrimSpace(p.Nombre + " " + p.Apellidos),
+			GivenName:  p.Nombre,
+			FamilyName: p.Apellidos,
+		},
+		DisplayName: strings.TrimSpace(p.Nombre + " " + p.Apellidos),
+		Emails:      []ScimMultiValue{{Value: p.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Groups:      groups,
+		Meta: &ScimMeta{
+			ResourceType: "User",
+			Created:      p.CreatedAt.UTC().Format(time.RFC3339),
+			Location:     base + "/Users/" + strconv.Itoa(p.ID),
+			Version:      scimPersonVersion(p),
+		},
+	}
+	if p.Telefono != nil && *p.Telefono != "" {
+		user.PhoneNumbers = []ScimMultiValue{{Value: *p.Telefono, Type: "work"}}
+	}
+	return user
+}
+
+func scimGroup(app AuthClientShort, members []PersonData, base string) ScimGroup {
+	group := ScimGroup{
+		Schemas:     []string{scimSchemaGroup},
+		ID:          strconv.Itoa(app.ID),
+		DisplayName: app.ClientID,
+		Members:     []ScimMultiValue{},
+	}
+	var ids []int
+	for _, p := range members {
+		ids = append(ids, p.ID)
+		group.Members = append(group.Members, ScimMultiValue{
+			Value:   strconv.Itoa(p.ID),
+			Display: strings.TrimSpace(p.Nombre + " " + p.Apellidos),
+			Ref:     base + "/Users/" + strconv.Itoa(p.ID),
+		})
+	}
+	group.Meta = &ScimMeta{
+		ResourceType: "Group",
+		Location:     base + "/Groups/" + strconv.Itoa(app.ID),
+		Version:      scimGroupVersion(app, ids),
+	}
+	return group
+}
+
+// scimUserToPerson valida un User recibido y lo convierte a los campos de persons
+func scimUserToPerson(user ScimUser) (PersonPostData, error) {
+	person := PersonPostData{
+		Dni:       strings.TrimSpace(user.ExternalID),
+		Nombre:    strings.TrimSpace(user.Name.GivenName),
+		Apellidos: strings.TrimSpace(user.Name.FamilyName),
+		Email:     strings.TrimSpace(user.UserName),
+	}
+	for _, email := range user.Emails {
+		if email.Primary || person.Email == "" {
+			person.Email = strings.TrimSpace(email.Value)
+		}
+	}
+	if len(user.PhoneNumbers) > 0 {
+		person.Telefono = strings.TrimSpace(user.PhoneNumbers[0].Value)
+	}
+	return person, scimValidatePerson(person)
+}
+
+func scimValidatePerson(person PersonPostData) error {
+	if person.Dni == "" {
+		return newScimErr(http.StatusBadRequest, "invalidValue", "El atributo externalId (dni) es requerido")
+	}
+	if person.Nombre == "" || person.Apellidos == "" {
+		return newScimErr(http.StatusBadRequest, "invalidValue", "Los atributos name.givenName y name.familyName son requeridos")
+	}
+	if !strings.Contains(person.Email, "@") {
+		return newScimErr(http.StatusBadRequest, "invalidValue", "Se requiere un email válido en userName o emails")
+	}
+	if person.Telefono != "" && strings.Trim(person.Telefono, "0123456789") != "" {
+		return newScimErr(http.StatusBadRequest, "invalidValue", "El teléfono solo puede contener dígitos")
+	}
+	return nil
+}
+
+// scimPaging lee startIndex y count (1-based, con tope scimMaxResults)
+func scimPaging(r *http.Request) (int, int, error) {
+	startIndex, count := 1, scimMaxResults
+	if v := r.URL.Query().Get("startIndex"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, newScimErr(http.StatusBadRequest, "invalidValue", "startIndex no válido: %s", v)
+		}
+		startIndex = max(i, 1)
+	}
+	if v := r.URL.Query().Get("count"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, newScimErr(http.StatusBadRequest, "invalidValue", "count no válido: %s", v)
+		}
+		count = min(max(i, 0), scimMaxResults)
+	}
+	return startIndex, count, nil
+}
+
+// scimListFiltered aplica filtro y paginación a una lista de recursos
+func scimListFiltered[T any](r *http.Request, all []T) (ScimListResponse, error) {
+	startIndex, count, err := scimPaging(r)
+	if err != nil {
+		return ScimListResponse{}, err
+	}
+
+	var filter scimFilter
+	if text := r.URL.Query().Get("filter"); text != "" {
+		filter, err = parseScimFilter(text)
+		if err != nil {
+			return ScimListResponse{}, newScimErr(http.StatusBadRequest, "invalidFilter", "%v", err)
+		}
+	}
+
+	var matched []any
+	for _, item := range all {
+		if filter != nil {
+			// el filtro se evalúa sobre la representación JSON del recurso
+			jsonItem, err := json.Marshal(item)
+			if err != nil {
+				return ScimListResponse{}, err
+			}
+			var res map[string]any
+			if err := json.Unmarshal(jsonItem, &res); err != nil {
+				return ScimListResponse{}, err
+			}
+			if !filter.match(res) {
+				continue
+			}
+		}
+		matched = append(matched, item)
+	}
+
+	resp := ScimListResponse{
+		Schemas:      []string{scimSchemaList},
+		TotalResults: len(matched),
+		StartIndex:   startIndex,
+		Resources:    []any{},
+	}
+	if startIndex <= len(matched) {
+		end := min(startIndex-1+count, len(matched))
+		resp.Resources = matched[startIndex-1 : end]
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+	return resp, nil
+}
+
+func scimUsersList(db *sql.DB, w http.ResponseWriter, r *http.Request, base string) error {
+	ctx := r.Context()
+	persons, err := postgres_persons_all(ctx, db)
+	if err != nil {
+		return err
+	}
+	memberships, err := postgres_scim_memberships(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	groups := make(map[int][]ScimMultiValue)
+	for _, m := range memberships {
+		groups[m.PersonID] = append(groups[m.PersonID], ScimMultiValue{
+			Value:   strconv.Itoa(m.AuthClientId),
+			Display: m.ClientID,
+			Ref:     base + "/Groups/" + strconv.Itoa(m.AuthClientId),
+		})
+	}
+
+	users := make([]ScimUser, 0, len(persons))
+	for _, p := range persons {
+		users = append(users, scimUser(p, groups[p.ID], base))
+	}
+
+	resp, err := scimListFiltered(r, users)
+	if err != nil {
+		return err
+	}
+	scimJson(w, http.StatusOK, resp)
+	return nil
+}
+
+// scimUserLoad devuelve el User con sus grupos (nil si la persona no existe)
+func scimUserLoad(ctx context.Context, db *sql.DB, base string, id int) (*ScimUser, error) {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM persons WHERE id = $1);`, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	person, err := postgres_person_by_id(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	lapp, err := postgres_auth_client_by_person_id(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []ScimMultiValue
+	for _, app := range lapp {
+		groups = append(groups, ScimMultiValue{
+			Value:   strconv.Itoa(app.ID),
+			Display: app.ClientID,
+			Ref:     base + "/Groups/" + strconv.Itoa(app.ID),
+		})
+	}
+
+	user := scimUser(*person, groups, base)
+	return &user, nil
+}
+
+func scimUserGet(db *sql.DB, w http.ResponseWriter, r *http.Request, base string, id int) error {
+	ctx := r.Context()
+	user, err := scimUserLoad(ctx, db, base, id)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return newScimErr(http.StatusNotFound, "", "User %d no encontrado", id)
+	}
+
+	w.Header().Set("ETag", user.Meta.Version)
+	if scimNotModified(r, user.Meta.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	scimJson(w, http.StatusOK, user)
+	return nil
+}
+
+func scimUserCreate(db *sql.DB, w http.ResponseWriter, r *http.Request, base string) error {
+	ctx := r.Context()
+	var in ScimUser
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		return newScimErr(http.StatusBadRequest, "invalidSyntax", "Error al parsear el cuerpo de la solicitud: %v", err)
+	}
+
+	person, err := scimUserToPerson(in)
+	if err != nil {
+		return err
+	}
+
+	// externalId (dni) identifica a la persona en los sistemas externos
+	existing, err := postgres_person_by_dni(ctx, db, person.Dni)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return newScimErr(http.StatusConflict, "uniqueness", "Ya existe un User con externalId %s (id %d)", person.Dni, existing.ID)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	created, err := postgres_person_insert(ctx, tx, person)
+	if err != nil {
+		return err
+	}
+	if _, err := outbox_enqueue(ctx, tx, eventPersonCreated, entityPerson, created.ID, created); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	user := scimUser(*created, nil, base)
+	w.Header().Set("Location", user.Meta.Location)
+	w.Header().Set("ETag", user.Meta.Version)
+	scimJson(w, http.StatusCreated, user)
+	return nil
+}
+
+// scimUserModify atiende PUT (reemplazo completo) y PATCH (operaciones) sobre un User
+func scimUserModify(db *sql.DB, w http.ResponseWriter, r *http.Request, base string, id int) error {
+	ctx := r.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := postgres_person_by_id_for_update(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return newScimErr(http.StatusNotFound, "", "User %d no encontrado", id)
+	}
+	if err := scimCheckIfMatch(r, scimPersonVersion(*current)); err != nil {
+		return err
+	}
+
+	// active=false es la baja de los proveedores de identidad (Okta, Entra ID): se revocan las
+	// pertenencias pero la persona se conserva, para auditoría y por si se vuelve a activar
+	var person PersonPostData
+	deactivate := false
+	if r.Method == http.MethodPut {
+		var in ScimUser
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			return newScimErr(http.StatusBadRequest, "invalidSyntax", "Error al parsear el cuerpo de la solicitud: %v", err)
+		}
+		person, err = scimUserToPerson(in)
+		if err != nil {
+			return err
+		}
+		deactivate = in.Active != nil && !*in.Active
+	} else {
+		var patch ScimPatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			return newScimErr(http.StatusBadRequest, "invalidSyntax", "Error al parsear el cuerpo de la solicitud: %v", err)
+		}
+		person = PersonPostData{
+			Dni:       current.Dni,
+			Nombre:    current.Nombre,
+			Apellidos: current.Apellidos,
+			Email:     current.Email,
+		}
+		if current.Telefono != nil {
+			person.Telefono = *current.Telefono
+		}
+		for _, op := range patch.Operations {
+			if err := scimUserPatch(&person, &deactivate, op.Op, op.Path, op.Value); err != nil {
+				return err
+			}
+		}
+		if err := scimValidatePerson(person); err != nil {
+			return err
+		}
+	}
+
+	update := PersonData{
+		ID:        id,
+		Dni:       person.Dni,
+		Nombre:    person.Nombre,
+		Apellidos: person.Apellidos,
+		Email:     person.Email,
+	}
+	if person.Telefono != "" {
+		update.Telefono = &person.Telefono
+	}
+
+	// solo se escribe y se publica el evento si algo ha cambiado
+	updated := current
+	if scimPersonVersion(update) != scimPersonVersion(*current) {
+		updated, err = postgres_person_update(ctx, tx, update)
+		if err != nil {
+			return err
+		}
+		if _, err := outbox_enqueue(ctx, tx, eventPersonUpdated, entityPerson, updated.ID, updated); err != nil {
+			return err
+		}
+	}
+	if deactivate {
+		if err := scimRevokeMemberships(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	user, err := scimUserLoad(ctx, db, base, updated.ID)
+	if err != nil {
+		return err
+	}
+	if deactivate {
+		// la respuesta refleja la baja que se ha pedido; la persona sigue existiendo sin accesos
+		inactive := false
+		user.Active = &inactive
+	}
+	w.Header().Set("ETag", user.Meta.Version)
+	scimJson(w, http.StatusOK, user)
+	return nil
+}
+
+var scimValuePathFilter = regexp.MustCompile(`\[[^\]]*\]`)
+
+// scimNormalizePath quita el URN del esquema y los filtros de valor: emails[type eq "work"].value -> emails.value
+func scimNormalizePath(path string) string {
+	path = scimValuePathFilter.ReplaceAllString(path, "")
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		if i := strings.LastIndex(path, ":"); i >= 0 {
+			path = path[i+1:]
+		}
+	}
+	return strings.ToLower(path)
+}
+
+// scimUserPatch aplica una operación PATCH a los campos de la persona
+// scimUserPatch aplica una operación PATCH; active=false deja deactivate a true
+func scimUserPatch(person *PersonPostData, deactivate *bool, op string, path string, value json.RawMessage) error {
+	op = strings.ToLower(op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return newScimErr(http.StatusBadRequest, "invalidSyntax", "Operación PATCH no soportada: %s", op)
+	}
+
+	// sin path el valor es un objeto con los atributos a modificar
+	if path == "" {
+		if op == "remove" {
+			return newScimErr(http.StatusBadRequest, "noTarget", "La operación remove requiere path")
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(value, &attrs); err != nil {
+			return newScimErr(http.StatusBadRequest, "invalidValue", "Se esperaba un objeto: %v", err)
+		}
+		for key, v := range attrs {
+			if strings.EqualFold(key, "schemas") {
+				continue
+			}
+			if err := scimUserPatch(person, deactivate, op, key, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	target := scimNormalizePath(path)
+
+	if op == "remove" {
+		switch target {
+		case "phonenumbers", "phonenumbers.value":
+			person.Telefono = ""
+			return nil
+		}
+		return newScimErr(http.StatusBadRequest, "mutability", "El atributo %s es requerido y no se puede eliminar", path)
+	}
+
+	str := func() (string, error) {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return "", newScimErr(http.StatusBadRequest, "invalidValue", "Se esperaba una cadena en %s", path)
+		}
+		return strings.TrimSpace(s), nil
+	}
+	multi := func() (string, error) {
+		var list []ScimMultiValue
+		if err := json.Unmarshal(value, &list); err != nil {
+			var single ScimMultiValue
+			if err := json.Unmarshal(value, &single); err != nil {
+				return "", newScimErr(http.StatusBadRequest, "invalidValue", "Se esperaba una lista de valores en %s", path)
+			}
+			list = []ScimMultiValue{single}
+		}
+		result := ""
+		for _, item := range list {
+			if item.Primary || result == "" {
+				result = strings.TrimSpace(item.Value)
+			}
+		}
+		return result, nil
+	}
+
+	var err error
+	switch target {
+	case "username":
+		person.Email, err = str()
+	case "externalid":
+		person.Dni, err = str()
+	case "name.givenname":
+		person.Nombre, err = str()
+	case "name.familyname":
+		person.Apellidos, err = str()
+	case "name":
+		var name ScimName
+		if err := json.Unmarshal(value, &name); err != nil {
+			return newScimErr(http.StatusBadRequest, "invalidValue", "Se esperaba un objeto name")
+		}
+		if name.GivenName != "" {
+			person.Nombre = strings.TrimSpace(name.GivenName)
+		}
+		if name.FamilyName != "" {
+			person.Apellidos = strings.TrimSpace(name.FamilyName)
+		}
+	case "emails":
+		person.Email, err = multi()
+	case "emails.value":
+		person.Email, err = str()
+	case "phonenumbers":
+		person.Telefono, err = multi()
+	case "phonenumbers.value":
+		person.Telefono, err = str()
+	case "active":
+		var active bool
+		if err := json.Unmarshal(value, &active); err != nil {
+			// algunos clientes envían el booleano como cadena
+			var s string
+			if json.Unmarshal(value, &s) != nil {
+				return newScimErr(http.StatusBadRequest, "invalidValue", "Se esperaba un booleano en active")
+			}
+			active = strings.EqualFold(s, "true")
+		}
+		*deactivate = !active
+	case "displayname", "name.formatted", "groups":
+		// atributos derivados o de solo lectura: se ignoran
+	default:
+		return newScimErr(http.StatusBadRequest, "invalidPath", "Atributo no soportado: %s", path)
+	}
+	return err
+}
+
+func scimUserDelete(db *sql.DB, w http.ResponseWriter, r *http.Request, id int) error {
+	ctx := r.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := postgres_person_by_id_for_update(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return newScimErr(http.StatusNotFound, "", "User %d no encontrado", id)
+	}
+	if err := scimCheckIfMatch(r, scimPersonVersion(*current)); err != nil {
+		return err
+	}
+
+	// primero se revocan sus pertenencias a las aplicaciones
+	if err := scimRevokeMemberships(ctx, tx, id); err != nil {
+		return err
+	}
+
+	if _, err := postgres_person_delete(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err := outbox_enqueue(ctx, tx, eventPersonDeleted, entityPerson, id, map[string]int{"id": id}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// scimRevokeMemberships da de baja a la persona en todas sus aplicaciones, con un evento
+// membership.revoked por cada una
+func scimRevokeMemberships(ctx context.Context, tx *sql.Tx, id int) error {
+	appIds, err := postgres_personapp_auth_client_ids_by_person_id_tx(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	for _, appId := range appIds {
+		deleted, err := postgres_personapp_delete(ctx, tx, id, appId)
+		if err != nil {
+			return err
+		}
+		if deleted != nil {
+			if _, err := outbox_enqueue(ctx, tx, eventMembershipRevoked, entityPersonApp, deleted.ID, deleted); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func scimGroupsList(db *sql.DB, w http.ResponseWriter, r *http.Request, base string) error {
+	ctx := r.Context()
+	lapp, err := postgres_auth_clients_short_all(ctx, db)
+	if err != nil {
+		return err
+	}
+	persons, err := postgres_persons_all(ctx, db)
+	if err != nil {
+		return err
+	}
+	memberships, err := postgres_scim_memberships(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	byId := make(map[int]PersonData)
+	for _, p := range persons {
+		byId[p.ID] = p
+	}
+	members := make(map[int][]PersonData)
+	for _, m := range memberships {
+		members[m.AuthClientId] = append(members[m.AuthClientId], byId[m.PersonID])
+	}
+
+	groups := make([]ScimGroup, 0, len(lapp))
+	for _, app := range lapp {
+		groups = append(groups, scimGroup(app, members[app.ID], base))
+	}
+
+	resp, err := scimListFiltered(r, groups)
+	if err != nil {
+		return err
+	}
+	scimJson(w, http.StatusOK, resp)
+	return nil
+}
+
+// scimGroupLoad devuelve el Group con sus miembros (nil si la aplicación no existe)
+func scimGroupLoad(ctx context.Context, db *sql.DB, base string, id int) (*ScimGroup, error) {
+	var app AuthClientShort
+	err := db.QueryRow(`SELECT id, client_id, client_url FROM auth_clients WHERE id = $1;`, id).Scan(&app.ID, &app.ClientID, &app.ClientUrl)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := postgres_person_by_auth_client_id(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	group := scimGroup(app, members, base)
+	return &group, nil
+}
+
+func scimGroupGet(db *sql.DB, w http.ResponseWriter, r *http.Request, base string, id int) error {
+	ctx := r.Context()
+	group, err := scimGroupLoad(ctx, db, base, id)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return newScimErr(http.StatusNotFound, "", "Group %d no encontrado", id)
+	}
+
+	w.Header().Set("ETag", group.Meta.Version)
+	if scimNotModified(r, group.Meta.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	scimJson(w, http.StatusOK, group)
+	return nil
+}
+
+// scimGroupModify atiende PUT y PATCH sobre los miembros de un Group
+func scimGroupModify(db *sql.DB, w http.ResponseWriter, r *http.Request, base string, id int) error {
+	ctx := r.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// bloquea la aplicación para serializar los cambios de miembros
+	var app AuthClientShort
+	err = tx.QueryRow(`SELECT id, client_id, client_url FROM auth_clients WHERE id = $1 FOR UPDATE;`, id).Scan(&app.ID, &app.ClientID, &app.ClientUrl)
+	if err == sql.ErrNoRows {
+		return newScimErr(http.StatusNotFound, "", "Group %d no encontrado", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	current, err := postgres_personapp_person_ids_by_auth_client_id_tx(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err := scimCheckIfMatch(r, scimGroupVersion(app, current)); err != nil {
+		return err
+	}
+
+	wanted := slices.Clone(current)
+	if r.Method == http.MethodPut {
+		var in ScimGroup
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			return newScimErr(http.StatusBadRequest, "invalidSyntax", "Error al parsear el cuerpo de la solicitud: %v", err)
+		}
+		if in.DisplayName != "" && in.DisplayName != app.ClientID {
+			return newScimErr(http.StatusBadRequest, "mutability", "displayName es el client_id de la aplicación y no se puede modificar")
+		}
+		wanted, err = scimMemberIds(in.Members)
+		if err != nil {
+			return err
+		}
+	} else {
+		var patch ScimPatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			return newScimErr(http.StatusBadRequest, "invalidSyntax", "Error al parsear el cuerpo de la solicitud: %v", err)
+		}
+		for _, op := range patch.Operations {
+			wanted, err = scimGroupPatch(wanted, app, op.Op, op.Path, op.Value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// aplica la diferencia entre los miembros actuales y los deseados
+	for _, personId := range wanted {
+		if slices.Contains(current, personId) {
+			continue
+		}
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM persons WHERE id = $1);`, personId).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return newScimErr(http.StatusBadRequest, "invalidValue", "El User %d no existe", personId)
+		}
+		created, err := postgres_personapp_insert(ctx, tx, personId, id, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := outbox_enqueue(ctx, tx, eventMembershipGranted, entityPersonApp, created.ID, created); err != nil {
+			return err
+		}
+	}
+	for _, personId := range current {
+		if slices.Contains(wanted, personId) {
+			continue
+		}
+		deleted, err := postgres_personapp_delete(ctx, tx, personId, id)
+		if err != nil {
+			return err
+		}
+		if deleted != nil {
+			if _, err := outbox_enqueue(ctx, tx, eventMembershipRevoked, entityPersonApp, deleted.ID, deleted); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	group, err := scimGroupLoad(ctx, db, base, id)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", group.Meta.Version)
+	scimJson(w, http.StatusOK, group)
+	return nil
+}
+
+// scimMemberIds convierte los members recibidos en ids de persona sin duplicados
+func scimMemberIds(members []ScimMultiValue) ([]int, error) {
+	ids := []int{}
+	for _, m := range members {
+		id, err := strconv.Atoi(m.Value)
+		if err != nil {
+			return nil, newScimErr(http.StatusBadRequest, "invalidValue", "Miembro no válido: %q", m.Value)
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// scimGroupPatch aplica una operación PATCH a la lista de miembros
+func scimGroupPatch(members []int, app AuthClientShort, op string, path string, value json.RawMessage) ([]int, error) {
+	op = strings.ToLower(op)
+
+	// sin path el valor es un objeto: {"members": [...]} o {"displayName": ...}
+	if path == "" {
+		if op == "remove" {
+			return nil, newScimErr(http.StatusBadRequest, "noTarget", "La operación remove requiere path")
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(value, &attrs); err != nil {
+			return nil, newScimErr(http.StatusBadRequest, "invalidValue", "Se esperaba un objeto: %v", err)
+		}
+		var err error
+		for key, v := range attrs {
+			if strings.EqualFold(key, "schemas") {
+				continue
+			}
+			members, err = scimGroupPatch(members, app, op, key, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return members, nil
+	}
+
+	if strings.EqualFold(path, "displayName") {
+		var name string
+		if json.Unmarshal(value, &name) != nil || name != app.ClientID {
+			return nil, newScimErr(http.StatusBadRequest, "mutability", "displayName es el client_id de la aplicación y no se puede modificar")
+		}
+		return members, nil
+	}
+
+	// remove con filtro de valor: members[value eq "5"]
+	if op == "remove" && strings.HasPrefix(strings.ToLower(path), "members[") && strings.HasSuffix(path, "]") {
+		filter, err := parseScimFilter(path[len("members[") : len(path)-1])
+		if err != nil {
+			return nil, newScimErr(http.StatusBadRequest, "invalidFilter", "%v", err)
+		}
+		var result []int
+		for _, id := range members {
+			if !filter.match(map[string]any{"value": strconv.Itoa(id)}) {
+				result = append(result, id)
+			}
+		}
+		return result, nil
+	}
+
+	if !strings.EqualFold(path, "members") {
+		return nil, newScimErr(http.StatusBadRequest, "invalidPath", "Atributo no soportado: %s", path)
+	}
+
+	var list []ScimMultiValue
+	if len(value) > 0 {
+		if err := json.Unmarshal(value, &list); err != nil {
+			return nil, newScimErr(http.StatusBadRequest, "invalidValue", "Se esperaba una lista de members")
+		}
+	}
+	ids, err := scimMemberIds(list)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "add":
+		for _, id := range ids {
+			if !slices.Contains(members, id) {
+				members = append(members, id)
+			}
+		}
+		return members, nil
+	case "replace":
+		return ids, nil
+	case "remove":
+		// sin valor se eliminan todos los miembros
+		if len(value) == 0 {
+			return []int{}, nil
+		}
+		var result []int
+		for _, id := range members {
+			if !slices.Contains(ids, id) {
+				result = append(result, id)
+			}
+		}
+		return result, nil
+	}
+	return nil, newScimErr(http.StatusBadRequest, "invalidSyntax", "Operación PATCH no soportada: %s", op)
+}
+
+func postgres_scim_memberships(ctx context.Context, db *sql.DB) ([]scimMembership, error) {
+	ctx, span := startDbSpan(ctx, "postgres_scim_memberships")
+	defer span.End()
+
+	query := `
+		SELECT
+			pac.person_id, pac.auth_client_id, ac.client_id
+		FROM
+			person_auth_client pac
+			JOIN auth_clients ac ON ac.id = pac.auth_client_id
+		ORDER BY pac.id;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []scimMembership
+	for rows.Next() {
+		var item scimMembership
+		if err := rows.Scan(&item.PersonID, &item.AuthClientId, &item.ClientID); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, rows.Err()
+}
+
+func postgres_personapp_person_ids_by_auth_client_id_tx(ctx context.Context, tx *sql.Tx, id_app int) ([]int, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_person_ids_by_auth_client_id_tx")
+	defer span.End()
+
+	return postgres_ids_tx(ctx, tx, `SELECT person_id FROM person_auth_client WHERE auth_client_id = $1 ORDER BY person_id;`, id_app)
+}
+
+func postgres_personapp_auth_client_ids_by_person_id_tx(ctx context.Context, tx *sql.Tx, id_person int) ([]int, error) {
+	ctx, span := startDbSpan(ctx, "postgres_personapp_auth_client_ids_by_person_id_tx")
+	defer span.End()
+
+	return postgres_ids_tx(ctx, tx, `SELECT auth_client_id FROM person_auth_client WHERE person_id = $1 ORDER BY auth_client_id;`, id_person)
+}
+
+func postgres_ids_tx(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]int, error) {
+	ctx, span := startDbSpan(ctx, "postgres_ids_tx")
+	defer span.End()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,346 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filtros SCIM (RFC 7644 3.4.2.2): se parsean a un árbol y se evalúan en memoria
+// sobre la representación JSON del recurso. Soporta eq ne co sw ew gt ge lt le pr,
+// and, or, not(...), paréntesis y atributos con subatributo (name.familyName).
+
+type scimFilter interface {
+	match(resource map[string]any) bool
+}
+
+type scimFilterAnd struct{ left, right scimFilter }
+type scimFilterOr struct{ left, right scimFilter }
+type scimFilterNot struct{ inner scimFilter }
+
+type scimFilterCompare struct {
+	path  []string
+	op    string
+	value any // string, float64, bool o nil
+}
+
+func (f scimFilterAnd) match(res map[string]any) bool { return f.left.match(res) && f.right.match(res) }
+func (f scimFilterOr) match(res map[string]any) bool  { return f.left.match(res) || f.right.match(res) }
+func (f scimFilterNot) match(res map[string]any) bool { return !f.inner.match(res) }
+
+func (f scimFilterCompare) match(res map[string]any) bool {
+	values := scimAttributeValues(res, f.path)
+	if f.op == "pr" {
+		for _, v := range values {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	// los atributos multivaluados coinciden si coincide cualquiera de sus valores
+	for _, v := range values {
+		if scimCompare(v, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// scimAttributeValues resuelve una ruta de atributo (sin distinguir mayúsculas)
+// aplanando los atributos multivaluados
+func scimAttributeValues(res map[string]any, path []string) []any {
+	current := []any{res}
+	for _, name := range path {
+		var next []any
+		for _, item := range current {
+			obj, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			for key, v := range obj {
+				if !strings.EqualFold(key, name) {
+					continue
+				}
+				if list, ok := v.([]any); ok {
+					next = append(next, list...)
+				} else {
+					next = append(next, v)
+				}
+			}
+		}
+		current = next
+	}
+	// un atributo complejo multivaluado sin subatributo se compara por su "value"
+	var values []any
+	for _, item := range current {
+		if obj, ok := item.(map[string]any); ok {
+			values = append(values, obj["value"])
+		} else {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func scimCompare(actual any, op string, expected any) bool {
+	switch a := actual.(type) {
+	case string:
+		e, ok := expected.(string)
+		if !ok {
+			return false
+		}
+		a, e = strings.ToLower(a), strings.ToLower(e)
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case float64:
+		e, ok := expected.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case bool:
+		e, ok := expected.(bool)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		}
+	case nil:
+		return op == "eq" && expected == nil || op == "ne" && expected != nil
+	}
+	return false
+}
+
+// parseScimFilter convierte el texto del filtro en un árbol evaluable
+func parseScimFilter(text string) (scimFilter, error) {
+	tokens, err := scimFilterTokens(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("token inesperado %q en el filtro", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+type scimFilterToken struct {
+	text   string
+	quoted bool
+}
+
+func scimFilterTokens(text string) ([]scimFilterToken, error) {
+	var tokens []scimFilterToken
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, scimFilterToken{text: string(c)})
+			i++
+		case c == '"':
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("cadena sin cerrar en el filtro")
+			}
+			tokens = append(tokens, scimFilterToken{text: sb.String(), quoted: true})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			tokens = append(tokens, scimFilterToken{text: string(runes[start:i])})
+		}
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []scimFilterToken
+	pos    int
+}
+
+func (p *scimFilterParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, keyword)
+}
+
+func (p *scimFilterParser) next() (scimFilterToken, error) {
+	if p.pos >= len(p.tokens) {
+		return scimFilterToken{}, fmt.Errorf("filtro incompleto")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *scimFilterParser) parseOr() (scimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = scimFilterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (scimFilter, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = scimFilterAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseFactor() (scimFilter, error) {
+	if p.peekKeyword("not") {
+		p.pos++
+		inner, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		return scimFilterNot{inner}, nil
+	}
+	if p.peekKeyword("(") {
+		return p.parseGroup()
+	}
+	return p.parseCompare()
+}
+
+func (p *scimFilterParser) parseGroup() (scimFilter, error) {
+	if t, err := p.next(); err != nil || t.text != "(" {
+		return nil, fmt.Errorf("se esperaba '(' en el filtro")
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t, err := p.next(); err != nil || t.text != ")" {
+		return nil, fmt.Errorf("se esperaba ')' en el filtro")
+	}
+	return f, nil
+}
+
+func (p *scimFilterParser) parseCompare() (scimFilter, error) {
+	attr, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if attr.quoted || attr.text == "(" || attr.text == ")" {
+		return nil, fmt.Errorf("se esperaba un atributo en el filtro, no %q", attr.text)
+	}
+	// los atributos pueden venir con el URN del esquema como prefijo
+	name := attr.text
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	path := strings.Split(name, ".")
+
+	opToken, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(opToken.text)
+	switch op {
+	case "pr":
+		return scimFilterCompare{path: path, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("operador %q no soportado en el filtro", opToken.text)
+	}
+
+	valueToken, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	switch {
+	case valueToken.quoted:
+		value = valueToken.text
+	case valueToken.text == "true":
+		value = true
+	case valueToken.text == "false":
+		value = false
+	case valueToken.text == "null":
+		value = nil
+	default:
+		n, err := strconv.ParseFloat(valueToken.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("valor %q no válido en el filtro", valueToken.text)
+		}
+		value = n
+	}
+	return scimFilterCompare{path: path, op: op, value: value}, nil
+}
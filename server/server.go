@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+)
+
+// newHttpServer crea el servidor HTTP con los plazos y límites de la configuración
+// (listen_addr y sección http); los streams desactivan el plazo de escritura.
+// Con tls.cert_file el servidor escucha en HTTPS y, con tls.client_ca_file, acepta mTLS.
+func newHttpServer(config *Config, handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              config.ListenAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.HTTP.ReadHeaderTimeout.D(),
+		ReadTimeout:       config.HTTP.ReadTimeout.D(),
+		WriteTimeout:      config.HTTP.WriteTimeout.D(),
+		IdleTimeout:       config.HTTP.IdleTimeout.D(),
+		MaxHeaderBytes:    config.HTTP.MaxHeaderBytes,
+	}
+
+	if config.TLS.CertFile != "" {
+		reloader, err := newTlsReloader(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = reloader.serverConfig()
+	}
+
+	return srv, nil
+}
@@ -0,0 +1,609 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"dummy-corp-erp-server/api"
+	"github.com/lib/pq"
+)
+
+// Servicios de personas, aplicaciones y pertenencias: la lógica que comparten la API v1
+// (api_v1_handlers.go) y gRPC (grpc.go). Reciben y devuelven los tipos del paquete api y los
+// errores son *api.Problem, que cada transporte traduce a su formato (problem+json o status).
+
+type personService struct {
+	db *sql.DB
+}
+
+type applicationService struct {
+	db *sql.DB
+}
+
+type membershipService struct {
+	db *sql.DB
+}
+
+// newProblem crea el error de un servicio
+func newProblem(status int, code, detail string, fields ...api.ProblemFieldError) *api.Problem {
+	return &api.Problem{
+		Type:   api.ProblemTypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+		Errors: fields,
+	}
+}
+
+// dbProblem traduce las violaciones de restricciones de PostgreSQL a 409 o 400;
+// el resto de errores de base de datos son 500
+func dbProblem(detail string, err error) *api.Problem {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return newProblem(http.StatusConflict, api.ProblemConflict, detail+": ya existe un registro con esos datos")
+		case "foreign_key_violation":
+			return newProblem(http.StatusConflict, api.ProblemConflict, detail+": el registro está referenciado o referencia a otro que no existe")
+		case "check_violation", "not_null_violation", "string_data_right_truncation":
+			return newProblem(http.StatusBadRequest, api.ProblemValidation, detail+": "+pqErr.Message)
+		}
+	}
+	return newProblem(http.StatusInternalServerError, api.ProblemInternal, detail+": "+err.Error())
+}
+
+func personNotFound(id int) *api.Problem {
+	return newProblem(http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La persona con id %d no existe`, id))
+}
+
+func applicationNotFound(id int) *api.Problem {
+	return newProblem(http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La aplicación con id %d no existe`, id))
+}
+
+func membershipNotFound(personID, applicationID int) *api.Problem {
+	return newProblem(http.StatusNotFound, api.ProblemNotFound, fmt.Sprintf(`La persona %d no pertenece a la aplicación %d`, personID, applicationID))
+}
+
+// List devuelve las personas que cumplen el filtro
+func (s personService) List(ctx context.Context, filter PersonFilter) (api.ListResource[api.PersonResource], error) {
+	list, err := postgres_persons_filtered(ctx, s.db, filter)
+	if err != nil {
+		return api.ListResource[api.PersonResource]{}, dbProblem(`Error al obtener las personas`, err)
+	}
+	return listResource(list, personResource), nil
+}
+
+// Get devuelve la persona con sus pertenencias
+func (s personService) Get(ctx context.Context, id int) (*api.PersonDetailResource, error) {
+	person, err := postgres_person_by_id(ctx, s.db, id)
+	if errors.Is(err, errPersonNotFound) {
+		return nil, personNotFound(id)
+	}
+	if err != nil {
+		return nil, dbProblem(`Error al obtener la persona`, err)
+	}
+
+	lpersonapp, err := postgres_personapp_by_person_id(ctx, s.db, id)
+	if err != nil {
+		return nil, dbProblem(`Error al obtener las pertenencias`, err)
+	}
+
+	lapp, err := postgres_auth_client_by_person_id(ctx, s.db, id)
+	if err != nil {
+		return nil, dbProblem(`Error al obtener las aplicaciones`, err)
+	}
+	apps := make(map[int]api.ApplicationSummaryResource, len(lapp))
+	for _, app := range lapp {
+		apps[app.ID] = applicationSummaryResource(app)
+	}
+
+	detail := &api.PersonDetailResource{PersonResource: personResource(*person), Memberships: []api.MembershipResource{}}
+	for _, pa := range lpersonapp {
+		m := membershipResource(pa)
+		if app, ok := apps[pa.AuthClientId]; ok {
+			m.Application = &app
+		}
+		detail.Memberships = append(detail.Memberships, m)
+	}
+	return detail, nil
+}
+
+// Create da de alta una persona y registra el evento person.created
+func (s personService) Create(ctx context.Context, sent api.PersonWriteResource) (*api.PersonResource, error) {
+	if fields := validatePersonWrite(&sent); len(fields) > 0 {
+		return nil, newProblem(http.StatusBadRequest, api.ProblemValidation, `La persona no es válida`, fields...)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, dbProblem(`Error al iniciar la transacción`, err)
+	}
+	defer tx.Rollback()
+
+	post := PersonPostData{Dni: sent.Dni, Nombre: sent.Nombre, Apellidos: sent.Apellidos, Email: sent.Email}
+	if sent.Telefono != nil {
+		post.Telefono = *sent.Telefono
+	}
+	created, err := postgres_person_insert(ctx, tx, post)
+	if err != nil {
+		return nil, dbProblem(`Error al insertar la persona`, err)
+	}
+
+	if _, err := outbox_enqueue(ctx, tx, eventPersonCreated, entityPerson, created.ID, created); err != nil {
+		return nil, dbProblem(`Error al registrar el evento`, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, dbProblem(`Error al confirmar la transacción`, err)
+	}
+
+	res := personResource(*created)
+	return &res, nil
+}
+
+// Update sustituye los datos de una persona y registra el evento person.updated
+func (s personService) Update(ctx context.Context, id int, sent api.PersonWriteResource) (*api.PersonResource, error) {
+	if fields := validatePersonWrite(&sent); len(fields) > 0 {
+		return nil, newProblem(http.StatusBadRequest, api.ProblemValidation, `La persona no es válida`, fields...)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, dbProblem(`Error al iniciar la transacción`, err)
+	}
+	defer tx.Rollback()
+
+	updated, err := postgres_person_update(ctx, tx, PersonData{
+		ID: id, Dni: sent.Dni, Nombre: sent.Nombre, Apellidos: sent.Apellidos, Email: sent.Email, Telefono: sent.Telefono,
+	})
+	if err != nil {
+		return nil, dbProblem(`Error al actualizar la persona`, err)
+	}
+	if updated == nil {
+		return nil, personNotFound(id)
+	}
+
+	if _, err := outbox_enqueue(ctx, tx, eventPersonUpdated, entityPerson, updated.ID, updated); err != nil {
+		return nil, dbProblem(`Error al registrar el evento`, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, dbProblem(`Error al confirmar la transacción`, err)
+	}
+
+	res := personResource(*updated)
+	return &res, nil
+}
+
+// Delete elimina una persona y registra el evento person.deleted
+func (s personService) Delete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbProblem(`Error al iniciar la transacción`, err)
+	}
+	defer tx.Rollback()
+
+	deleted, err := postgres_person_delete(ctx, tx, id)
+	if err != nil {
+		return dbProblem(`Error al eliminar la persona`, err)
+	}
+	if !deleted {
+		return personNotFound(id)
+	}
+
+	if _, err := outbox_enqueue(ctx, tx, eventPersonDeleted, entityPerson, id, map[string]int{"id": id}); err != nil {
+		return dbProblem(`Error al registrar el evento`, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbProblem(`Error al confirmar la transacción`, err)
+	}
+	return nil
+}
+
+// List devuelve las aplicaciones sin secretos
+func (s applicationService) List(ctx context.Context) (api.ListResource[api.ApplicationResource], error) {
+	list, err := postgres_auth_clients_all(ctx, s.db)
+	if err != nil {
+		return api.ListResource[api.ApplicationResource]{}, dbProblem(`Error al obtener las aplicaciones`, err)
+	}
+	return listResource(list, applicationResource), nil
+}
+
+// Get devuelve la aplicación con las personas que tienen acceso
+func (s applicationService) Get(ctx context.Context, id int) (*api.ApplicationDetailResource, error) {
+	app, err := postgres_auth_client_by_id(ctx, s.db, id)
+	if errors.Is(err, errAuthClientNotFound) {
+		return nil, applicationNotFound(id)
+	}
+	if err != nil {
+		return nil, dbProblem(`Error al obtener la aplicación`, err)
+	}
+
+	lpersonapp, err := postgres_personapp_by_auth_client_id(ctx, s.db, id)
+	if err != nil {
+		return nil, dbProblem(`Error al obtener las pertenencias`, err)
+	}
+
+	lper, err := postgres_person_by_auth_client_id(ctx, s.db, id)
+	if err != nil {
+		return nil, dbProblem(`Error al obtener las personas`, err)
+	}
+	persons := make(map[int]api.PersonResource, len(lper))
+	for _, p := range lper {
+		persons[p.ID] = personResource(p)
+	}
+
+	detail := &api.ApplicationDetailResource{ApplicationResource: applicationResource(*app), Memberships: []api.MembershipResource{}}
+	for _, pa := range lpersonapp {
+		m := membershipResource(pa)
+		if p, ok := persons[pa.PersonID]; ok {
+			m.Person = &p
+		}
+		detail.Memberships = append(detail.Memberships, m)
+	}
+	return detail, nil
+}
+
+// Create registra una aplicación; si es confidencial (client_url_callback o client_credentials)
+// se genera el secreto, que solo se devuelve en esta respuesta
+func (s applicationService) Create(ctx context.Context, sent api.ApplicationWriteResource) (*api.ApplicationResource, error) {
+	if fields := validateApplicationWrite(&sent); len(fields) > 0 {
+		return nil, newProblem(http.StatusBadRequest, api.ProblemValidation, `La aplicación no es válida`, fields...)
+	}
+
+	item := AuthClient{
+		ClientID:             sent.ClientID,
+		ClientUrl:            sent.ClientUrl,
+		ClientUrlCallback:    sent.ClientUrlCallback,
+		BackchannelLogoutUrl: sent.BackchannelLogoutUrl,
+		TlsClientSubject:     sent.TlsClientSubject,
+		AllowedScopes:        sent.AllowedScopes,
+		GrantTypes:           sent.GrantTypes,
+		LogoUrl:              sent.LogoUrl,
+		Description:          sent.Description,
+		OwnerName:            sent.OwnerName,
+		OwnerEmail:           sent.OwnerEmail,
+	}
+	if item.confidential() {
+		secret := tokenCreate(64)
+		item.ClientSecret = &secret
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, dbProblem(`Error al iniciar la transacción`, err)
+	}
+	defer tx.Rollback()
+
+	created, err := postgres_auth_client_insert(ctx, tx, item)
+	if err != nil {
+		return nil, dbProblem(`Error al insertar la aplicación`, err)
+	}
+	if err := postgres_auth_client_redirect_uris_replace(ctx, tx, created.ID, redirectUriKindLogin, sent.RedirectUris); err != nil {
+		return nil, dbProblem(`Error al insertar las redirect_uris`, err)
+	}
+	if err := postgres_auth_client_redirect_uris_replace(ctx, tx, created.ID, redirectUriKindPostLogout, sent.PostLogoutRedirectUris); err != nil {
+		return nil, dbProblem(`Error al insertar las post_logout_redirect_uris`, err)
+	}
+	created.RedirectUris = sent.RedirectUris
+	created.PostLogoutRedirectUris = sent.PostLogoutRedirectUris
+
+	if _, err := outbox_enqueue(ctx, tx, eventApplicationCreated, entityAuthClient, created.ID, created.eventData()); err != nil {
+		return nil, dbProblem(`Error al registrar el evento`, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, dbProblem(`Error al confirmar la transacción`, err)
+	}
+
+	res := applicationResource(*created)
+	res.ClientSecret = created.ClientSecret
+	return &res, nil
+}
+
+// Update sustituye los datos de una aplicación; el secreto se conserva salvo que se pida
+// rotate_secret, o que la aplicación pase a ser confidencial sin tenerlo, y solo se devuelve
+// cuando se genera
+func (s applicationService) Update(ctx context.Context, id int, sent api.ApplicationWriteResource) (*api.ApplicationResource, error) {
+	if fields := validateApplicationWrite(&sent); len(fields) > 0 {
+		return nil, newProblem(http.StatusBadRequest, api.ProblemValidation, `La aplicación no es válida`, fields...)
+	}
+
+	current, err := postgres_auth_client_by_id(ctx, s.db, id)
+	if errors.Is(err, errAuthClientNotFound) {
+		return nil, applicationNotFound(id)
+	}
+	if err != nil {
+		return nil, dbProblem(`Error al obtener la aplicación`, err)
+	}
+
+	item := AuthClient{
+		ID:                     id,
+		ClientID:               sent.ClientID,
+		ClientUrl:              sent.ClientUrl,
+		ClientUrlCallback:      sent.ClientUrlCallback,
+		ClientSecret:           current.ClientSecret,
+		CreatedAt:              current.CreatedAt,
+		BackchannelLogoutUrl:   sent.BackchannelLogoutUrl,
+		RedirectUris:           sent.RedirectUris,
+		PostLogoutRedirectUris: sent.PostLogoutRedirectUris,
+		TlsClientSubject:       sent.TlsClientSubject,
+		AllowedScopes:          sent.AllowedScopes,
+		GrantTypes:             sent.GrantTypes,
+		LogoUrl:                sent.LogoUrl,
+		Description:            sent.Description,
+		OwnerName:              sent.OwnerName,
+		OwnerEmail:             sent.OwnerEmail,
+		// el estado solo cambia con SetStatus
+		Status:          current.Status,
+		StatusReason:    current.StatusReason,
+		StatusChangedAt: current.StatusChangedAt,
+	}
+	var newSecret *string
+	if sent.RotateSecret || (item.confidential() && item.ClientSecret == nil) {
+		secret := tokenCreate(64)
+		item.ClientSecret = &secret
+		newSecret = &secret
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, dbProblem(`Error al iniciar la transacción`, err)
+	}
+	defer tx.Rollback()
+
+	if err := postgres_auth_client_update(ctx, tx, id, item); err != nil {
+		return nil, dbProblem(`Error al actualizar la aplicación`, err)
+	}
+	if err := postgres_auth_client_redirect_uris_replace(ctx, tx, id, redirectUriKindLogin, item.RedirectUris); err != nil {
+		return nil, dbProblem(`Error al actualizar las redirect_uris`, err)
+	}
+	if err := postgres_auth_client_redirect_uris_replace(ctx, tx, id, redirectUriKindPostLogout, item.PostLogoutRedirectUris); err != nil {
+		return nil, dbProblem(`Error al actualizar las post_logout_redirect_uris`, err)
+	}
+
+	if _, err := outbox_enqueue(ctx, tx, eventApplicationUpdated, entityAuthClient, id, item.eventData()); err != nil {
+		return nil, dbProblem(`Error al registrar el evento`, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, dbProblem(`Error al confirmar la transacción`, err)
+	}
+
+	res := applicationResource(item)
+	res.ClientSecret = newSecret
+	return &res, nil
+}
+
+// Delete elimina una aplicación con sus sesiones y webhooks; si tiene pertenencias es un
+// conflicto y lo que procede es retirarla (SetStatus), que las conserva
+func (s applicationService) Delete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbProblem(`Error al iniciar la transacción`, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM auth_clients WHERE id = $1;`, id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation" {
+		return newProblem(http.StatusConflict, api.ProblemConflict,
+			fmt.Sprintf(`La aplicación %d tiene pertenencias: retirarla con status "retired" las conserva`, id))
+	}
+	if err != nil {
+		return dbProblem(`Error al eliminar la aplicación`, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return applicationNotFound(id)
+	}
+
+	if _, err := outbox_enqueue(ctx, tx, eventApplicationDeleted, entityAuthClient, id, map[string]int{"id": id}); err != nil {
+		return dbProblem(`Error al registrar el evento`, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbProblem(`Error al confirmar la transacción`, err)
+	}
+	return nil
+}
+
+// SetStatus suspende, retira o reactiva una aplicación. Ninguno de los cambios toca las
+// pertenencias ni los secretos: una aplicación suspendida o retirada no se autentica ni abre
+// sesiones hasta que vuelve a active. Repetir el estado actual no cambia nada.
+func (s applicationService) SetStatus(ctx context.Context, id int, sent api.ApplicationStatusWriteResource) (*api.ApplicationResource, error) {
+	if _, ok := appStatusText[sent.Status]; !ok {
+		return nil, newProblem(http.StatusBadRequest, api.ProblemValidation, `El estado no es válido`,
+			api.ProblemFieldError{Field: "status", Message: fmt.Sprintf("se espera %s, %s o %s",
+				api.ApplicationStatusActive, api.ApplicationStatusSuspended, api.ApplicationStatusRetired)})
+	}
+	sent.Reason = normalizeOptional(sent.Reason)
+	if sent.Reason != nil && len(*sent.Reason) > 1000 {
+		return nil, newProblem(http.StatusBadRequest, api.ProblemValidation, `El estado no es válido`,
+			api.ProblemFieldError{Field: "reason", Message: "supera los 1000 caracteres"})
+	}
+
+	current, err := postgres_auth_client_by_id(ctx, s.db, id)
+	if errors.Is(err, errAuthClientNotFound) {
+		return nil, applicationNotFound(id)
+	}
+	if err != nil {
+		return nil, dbProblem(`Error al obtener la aplicación`, err)
+	}
+	if current.Status == sent.Status {
+		res := applicationResource(*current)
+		return &res, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, dbProblem(`Error al iniciar la transacción`, err)
+	}
+	defer tx.Rollback()
+
+	item, err := postgres_auth_client_set_status(ctx, tx, id, sent.Status, sent.Reason)
+	if errors.Is(err, errAuthClientNotFound) {
+		return nil, applicationNotFound(id)
+	}
+	if err != nil {
+		return nil, dbProblem(`Error al cambiar el estado de la aplicación`, err)
+	}
+	item.RedirectUris = current.RedirectUris
+	item.PostLogoutRedirectUris = current.PostLogoutRedirectUris
+
+	if _, err := outbox_enqueue(ctx, tx, applicationStatusEvents[sent.Status], entityAuthClient, id, item.eventData()); err != nil {
+		return nil, dbProblem(`Error al registrar el evento`, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, dbProblem(`Error al confirmar la transacción`, err)
+	}
+
+	res := applicationResource(*item)
+	return &res, nil
+}
+
+// Get devuelve la pertenencia de una persona a una aplicación
+func (s membershipService) Get(ctx context.Context, personID, applicationID int) (*api.MembershipResource, error) {
+	personApp, err := postgres_personapp_by_person_id_auth_client_id(ctx, s.db, personID, applicationID)
+	if err != nil {
+		return nil, dbProblem(`Error al obtener la pertenencia`, err)
+	}
+	if personApp == nil {
+		return nil, membershipNotFound(personID, applicationID)
+	}
+	res := membershipResource(*personApp)
+	return &res, nil
+}
+
+// Set da de alta a la persona en la aplicación o cambia su profile; created indica si la
+// pertenencia es nueva (evento membership.granted) o ya existía (profile.changed)
+func (s membershipService) Set(ctx context.Context, personID, applicationID int, sent api.MembershipWriteResource) (res *api.MembershipResource, created bool, err error) {
+	profile, err := membershipProfile(sent)
+	if err != nil {
+		return nil, false, newProblem(http.StatusBadRequest, api.ProblemValidation, `El profile no es válido`,
+			api.ProblemFieldError{Field: "profile", Message: err.Error()})
+	}
+
+	if _, err := postgres_person_by_id(ctx, s.db, personID); err != nil {
+		if errors.Is(err, errPersonNotFound) {
+			return nil, false, personNotFound(personID)
+		}
+		return nil, false, dbProblem(`Error al obtener la persona`, err)
+	}
+	if _, err := postgres_auth_client_by_id(ctx, s.db, applicationID); err != nil {
+		if errors.Is(err, errAuthClientNotFound) {
+			return nil, false, applicationNotFound(applicationID)
+		}
+		return nil, false, dbProblem(`Error al obtener la aplicación`, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, dbProblem(`Error al iniciar la transacción`, err)
+	}
+	defer tx.Rollback()
+
+	event := eventProfileChanged
+	personApp, err := postgres_personapp_update_profile(ctx, tx, personID, applicationID, profile)
+	if err != nil {
+		return nil, false, dbProblem(`Error al actualizar la pertenencia`, err)
+	}
+	if personApp == nil {
+		created, event = true, eventMembershipGranted
+		personApp, err = postgres_personapp_insert(ctx, tx, personID, applicationID, profile)
+		if err != nil {
+			return nil, false, dbProblem(`Error al insertar la pertenencia`, err)
+		}
+	}
+
+	if _, err := outbox_enqueue(ctx, tx, event, entityPersonApp, personApp.ID, personApp); err != nil {
+		return nil, false, dbProblem(`Error al registrar el evento`, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, dbProblem(`Error al confirmar la transacción`, err)
+	}
+
+	membership := membershipResource(*personApp)
+	return &membership, created, nil
+}
+
+// Delete da de baja a la persona en la aplicación y registra el evento membership.revoked
+func (s membershipService) Delete(ctx context.Context, personID, applicationID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbProblem(`Error al iniciar la transacción`, err)
+	}
+	defer tx.Rollback()
+
+	deleted, err := postgres_personapp_delete(ctx, tx, personID, applicationID)
+	if err != nil {
+		return dbProblem(`Error al eliminar la pertenencia`, err)
+	}
+	if deleted == nil {
+		return membershipNotFound(personID, applicationID)
+	}
+
+	if _, err := outbox_enqueue(ctx, tx, eventMembershipRevoked, entityPersonApp, deleted.ID, deleted); err != nil {
+		return dbProblem(`Error al registrar el evento`, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbProblem(`Error al confirmar la transacción`, err)
+	}
+	return nil
+}
+
+// CreateSession crea el código de sesión de la persona en la aplicación; solo se abren
+// sesiones de personas con acceso y la redirect_uri debe ser una de las registradas
+func (s membershipService) CreateSession(ctx context.Context, personID, applicationID int, sent api.SessionWriteResource) (*api.SessionResource, error) {
+	personApp, err := postgres_personapp_by_person_id_auth_client_id(ctx, s.db, personID, applicationID)
+	if err != nil {
+		return nil, dbProblem(`Error al obtener la pertenencia`, err)
+	}
+	if personApp == nil {
+		return nil, membershipNotFound(personID, applicationID)
+	}
+
+	app, err := postgres_auth_client_by_id(ctx, s.db, applicationID)
+	if err != nil {
+		return nil, dbProblem(`Error al obtener la aplicación`, err)
+	}
+	if problem := applicationInactive(*app); problem != nil {
+		return nil, problem
+	}
+
+	profile := make(map[string]any)
+	if personApp.Profile != nil {
+		if err := json.Unmarshal([]byte(*personApp.Profile), &profile); err != nil {
+			return nil, newProblem(http.StatusInternalServerError, api.ProblemInternal, fmt.Sprintf(`Error al parsear el profile: %v`, err))
+		}
+	}
+
+	// la redirect_uri suministrada debe coincidir exactamente con una registrada
+	redirect_uri, err := resolveRedirectUri(app.loginRedirectUris(), sent.RedirectUri)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, api.ProblemValidation, err.Error(),
+			api.ProblemFieldError{Field: "redirect_uri", Message: err.Error()})
+	}
+
+	expires_in_min := 60
+
+	code, err := auth_service_post_session(ctx, app.ClientID, personID, redirect_uri, expires_in_min, profile)
+	if err != nil {
+		return nil, newProblem(http.StatusBadGateway, api.ProblemUpstream, fmt.Sprintf(`Error al crear la sesión: %v`, err))
+	}
+
+	// registra la sesión para poder cerrarla en un logout global
+	if err := postgres_erp_app_session_insert(ctx, s.db, personID, applicationID, redirect_uri, expires_in_min); err != nil {
+		return nil, dbProblem(`Error al registrar la sesión`, err)
+	}
+
+	return &api.SessionResource{Code: code, RedirectUri: redirect_uri, ExpiresInMin: expires_in_min}, nil
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"dummy-corp-erp-server/api"
+)
+
+// TLS nativo con recarga en caliente: el certificado del servidor y la CA de clientes
+// se vuelven a leer cuando cambian los ficheros (p. ej. al renovar el Secret de Kubernetes),
+// comprobándolo como mucho una vez cada tls.reload_interval y sin reiniciar el proceso.
+
+type tlsReloader struct {
+	config TLSConfig
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamp     string
+	checkedAt time.Time
+}
+
+// newTlsReloader carga los ficheros por primera vez; un error aquí impide arrancar
+func newTlsReloader(config TLSConfig) (*tlsReloader, error) {
+	t := &tlsReloader{config: config}
+	stamp, err := t.filesStamp()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	t.stamp = stamp
+	t.checkedAt = time.Now()
+	return t, nil
+}
+
+// filesStamp resume la fecha y el tamaño de los ficheros para detectar cambios
+func (t *tlsReloader) filesStamp() (string, error) {
+	stamp := ""
+	for _, path := range []string{t.config.CertFile, t.config.KeyFile, t.config.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
+
+func (t *tlsReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(t.config.CertFile, t.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("error al cargar el certificado TLS: %v", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if t.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("error al leer la CA de clientes: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("la CA de clientes no contiene certificados PEM válidos")
+		}
+	}
+
+	t.cert = &cert
+	t.clientCAs = clientCAs
+	return nil
+}
+
+// current devuelve el certificado y la CA vigentes, recargándolos si los ficheros han cambiado.
+// Si la recarga falla se sigue usando la versión anterior.
+func (t *tlsReloader) current() (*tls.Certificate, *x509.CertPool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if time.Since(t.checkedAt) >= t.config.ReloadInterval.D() {
+		t.checkedAt = time.Now()
+		stamp, err := t.filesStamp()
+		if err != nil {
+			slog.Warn("No se pudieron comprobar los ficheros TLS", "error", err)
+		} else if stamp != t.stamp {
+			if err := t.load(); err != nil {
+				slog.Error("Error al recargar los certificados TLS", "error", err)
+			} else {
+				t.stamp = stamp
+				slog.Info("Certificados TLS recargados", "cert_file", t.config.CertFile)
+			}
+		}
+	}
+	return t.cert, t.clientCAs
+}
+
+// serverConfig construye la configuración TLS del servidor; cada conexión usa los certificados vigentes
+func (t *tlsReloader) serverConfig() *tls.Config {
+	clientAuth := tls.NoClientCert
+	switch t.config.ClientAuth {
+	case "optional":
+		// sin certificado el cliente puede seguir usando un token Bearer
+		clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	if t.config.ClientCAFile == "" {
+		clientAuth = tls.NoClientCert
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, clientCAs := t.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    clientCAs,
+				ClientAuth:   clientAuth,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+// tlsClientSubject devuelve el subject del certificado de cliente verificado, o "" si no hay
+func tlsClientSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.String()
+}
+
+// mtls_autorizado busca la aplicación registrada con el subject del certificado de cliente
+// y le aplica la misma lista de clientes que a los tokens
+func mtls_autorizado(r *http.Request, db *sql.DB, subject string) (*AuthClient, bool) {
+	logger := requestLogger(r.Context())
+
+	app, err := postgres_auth_client_by_tls_subject(r.Context(), db, subject)
+	if err != nil {
+		logger.Warn("error al buscar la aplicación del certificado de cliente", "error", err)
+		return nil, false
+	}
+	if app == nil {
+		logger.Debug("certificado de cliente sin aplicación asociada", "subject", subject)
+		return nil, false
+	}
+	if app.Status != api.ApplicationStatusActive {
+		logger.Info("certificado de cliente de una aplicación no activa", "client_id", app.ClientID, "status", app.Status)
+		return nil, false
+	}
+	// el certificado identifica a una aplicación, no a un usuario: se autoriza como un token de cliente
+	if !api_client_autorizado(0, app.ClientID) {
+		logger.Info("certificado de cliente no autorizado para esta API", "client_id", app.ClientID)
+		return nil, false
+	}
+	return app, true
+}
+
+func postgres_auth_client_by_tls_subject(ctx context.Context, db *sql.DB, subject string) (*AuthClient, error) {
+	ctx, span := startDbSpan(ctx, "postgres_auth_client_by_tls_subject")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, client_id, client_url, tls_client_subject, status
+		FROM
+			auth_clients
+		WHERE
+			tls_client_subject = $1;`
+
+	var item AuthClient
+	err := db.QueryRowContext(ctx, query, subject).Scan(&item.ID, &item.ClientID, &item.ClientUrl, &item.TlsClientSubject, &item.Status)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
@@ -0,0 +1,787 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+/*
+	CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id SERIAL PRIMARY KEY,
+		auth_client_id INT NOT NULL,
+		url VARCHAR(255) NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		events TEXT[] NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		...
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		outbox_id BIGINT NOT NULL,
+		subscription_id INT NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		...
+	);
+*/
+
+// eventos a los que se puede suscribir una aplicación
+var webhookEvents = []string{
+	eventPersonCreated, eventPersonUpdated, eventPersonDeleted,
+	eventMembershipGranted, eventMembershipRevoked,
+	eventProfileChanged,
+	eventApplicationCreated, eventApplicationUpdated, eventApplicationDeleted,
+	eventApplicationSuspended, eventApplicationRetired, eventApplicationReactivated,
+}
+
+// parámetros del dispatcher de webhooks
+const (
+	webhookPollInterval = 2 * time.Second
+	webhookBatchSize    = 20
+	webhookMaxAttempts  = 10
+	webhookFirstBackoff = 5 * time.Second
+	webhookMaxBackoff   = time.Hour
+	webhookHttpTimeout  = 10 * time.Second
+	// las entregas de un lote se envían una tras otra: el lote entero debe caber en la reserva,
+	// o otra réplica reclamaría entregas aún en curso y las enviaría dos veces
+	webhookLease = webhookBatchSize*webhookHttpTimeout + time.Minute
+)
+
+// errWebhookNotFound se devuelve envuelto cuando la suscripción no existe
+var errWebhookNotFound = errors.New("suscripción no encontrada")
+
+type WebhookSubscription struct {
+	ID           int       `json:"id"`
+	AuthClientId int       `json:"auth_client_id"`
+	Url          string    `json:"url"`
+	Secret       *string   `json:"secret,omitempty"`
+	Events       []string  `json:"events"`
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type WebhookSubscriptionPostSent struct {
+	AuthClientId int      `json:"auth_client_id"`
+	Url          string   `json:"url"`
+	Events       []string `json:"events"`
+	Active       *bool    `json:"active,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	OutboxID       int64      `json:"outbox_id"`
+	SubscriptionID int        `json:"subscription_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// webhookJob es una entrega reclamada por el dispatcher junto con su evento
+type webhookJob struct {
+	DeliveryID int64
+	Attempts   int
+	Url        string
+	Secret     string
+	Event      OutboxEvent
+}
+
+// initTableWebhookSubscriptions crea la tabla "webhook_subscriptions" si no existe
+func initTableWebhookSubscriptions(db *sql.DB) error {
+
+	// SQL para crear la tabla si no existe
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+			id SERIAL PRIMARY KEY,
+			auth_client_id INT NOT NULL,
+			url VARCHAR(255) NOT NULL,
+			secret VARCHAR(255) NOT NULL,
+			events TEXT[] NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (auth_client_id) REFERENCES auth_clients(id) ON DELETE CASCADE
+		);`
+
+	// Ejecuta la creación de la tabla
+	_, err := db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al crear la tabla webhook_subscriptions: %v", err)
+	}
+
+	return nil
+}
+
+// initTableWebhookDeliveries crea la tabla "webhook_deliveries" si no existe
+func initTableWebhookDeliveries(db *sql.DB) error {
+
+	// SQL para crear la tabla si no existe
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			outbox_id BIGINT NOT NULL,
+			subscription_id INT NOT NULL,
+			status VARCHAR(16) NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_status_code INT,
+			last_error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP,
+			FOREIGN KEY (outbox_id) REFERENCES events_outbox(id) ON DELETE CASCADE,
+			FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+			CONSTRAINT status_check CHECK (status IN ('pending', 'delivered', 'failed')),
+			UNIQUE (outbox_id, subscription_id)
+		);
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx
+			ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';`
+
+	// Ejecuta la creación de la tabla
+	_, err := db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al crear la tabla webhook_deliveries: %v", err)
+	}
+
+	return nil
+}
+
+func dropTableWebhookDeliveries(db *sql.DB) error {
+
+	// SQL para eliminar la tabla "webhook_deliveries"
+	dropTableSQL := `DROP TABLE IF EXISTS webhook_deliveries;`
+
+	// Ejecuta la eliminación de la tabla
+	_, err := db.Exec(dropTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al eliminar la tabla webhook_deliveries: %v", err)
+	}
+	return nil
+}
+
+func dropTableWebhookSubscriptions(db *sql.DB) error {
+
+	// SQL para eliminar la tabla "webhook_subscriptions"
+	dropTableSQL := `DROP TABLE IF EXISTS webhook_subscriptions;`
+
+	// Ejecuta la eliminación de la tabla
+	_, err := db.Exec(dropTableSQL)
+	if err != nil {
+		return fmt.Errorf("error al eliminar la tabla webhook_subscriptions: %v", err)
+	}
+	return nil
+}
+
+// getWebhooksHandler lista las suscripciones: /webhooks?auth_client_id=2
+func getWebhooksHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		auth_client_id, err := queryIntParam(r, "auth_client_id")
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		list, err := postgres_webhook_subscriptions(ctx, db, auth_client_id)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener las suscripciones: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		jsonList, err := json.Marshal(list)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al convertir las suscripciones a JSON: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonList)
+	}
+}
+
+// getWebhookHandler devuelve una suscripción sin el secreto: GET /webhooks/{id}
+func getWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		item, err := postgres_webhook_subscription_by_id(ctx, db, iid)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener la suscripción: %v`, err), http.StatusNotFound)
+			return
+		}
+		// el secreto solo se devuelve al crear la suscripción
+		item.Secret = nil
+
+		writeJson(w, item)
+	}
+}
+
+// postWebhookHandler crea una suscripción; el secreto solo se devuelve aquí: POST /webhooks
+func postWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var sent WebhookSubscriptionPostSent
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al decodificar el JSON: %v`, err), http.StatusBadRequest)
+			return
+		}
+
+		if sent.AuthClientId == 0 {
+			errJsonStatus(w, `El campo auth_client_id es requerido`, http.StatusBadRequest)
+			return
+		}
+		if err := validateWebhookSubscription(sent); err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		active := true
+		if sent.Active != nil {
+			active = *sent.Active
+		}
+
+		secret, err := webhookSecretCreate()
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al generar el secreto: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		item, err := postgres_webhook_subscription_insert(ctx, db, sent.AuthClientId, sent.Url, secret, sent.Events, active)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al insertar la suscripción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, item)
+	}
+}
+
+// putWebhookHandler actualiza una suscripción: PUT /webhooks/{id}
+func putWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		var sent WebhookSubscriptionPostSent
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al decodificar el JSON: %v`, err), http.StatusBadRequest)
+			return
+		}
+		if err := validateWebhookSubscription(sent); err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		active := true
+		if sent.Active != nil {
+			active = *sent.Active
+		}
+
+		n, err := postgres_webhook_subscription_update(ctx, db, iid, sent.Url, sent.Events, active)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al actualizar la suscripción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		if n == 0 {
+			errJsonStatus(w, fmt.Sprintf(`La suscripción con id %d no existe`, iid), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": "Suscripción actualizada"}`))
+	}
+}
+
+// deleteWebhookHandler elimina una suscripción: DELETE /webhooks/{id}
+func deleteWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		n, err := postgres_webhook_subscription_delete(ctx, db, iid)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al eliminar la suscripción: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		if n == 0 {
+			errJsonStatus(w, fmt.Sprintf(`La suscripción con id %d no existe`, iid), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": "Suscripción eliminada"}`))
+	}
+}
+
+// getWebhookDeliveriesHandler devuelve el estado de las entregas:
+// /webhook-deliveries?subscription_id=1&status=failed&limit=100
+func getWebhookDeliveriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		subscription_id, err := queryIntParam(r, "subscription_id")
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit, err := queryIntParam(r, "limit")
+		if err != nil {
+			errJsonStatus(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if limit <= 0 || limit > 1000 {
+			limit = 100
+		}
+		status := r.URL.Query().Get("status")
+
+		list, err := postgres_webhook_deliveries(ctx, db, subscription_id, status, limit)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al obtener las entregas: %v`, err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, list)
+	}
+}
+
+// webhookDeliveryRetryHandler vuelve a poner en cola una entrega: POST /webhook-deliveries/{id}/retry
+func webhookDeliveryRetryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		iid, ok := pathInt(w, r, "id")
+		if !ok {
+			return
+		}
+
+		n, err := postgres_webhook_delivery_retry(r.Context(), db, iid)
+		if err != nil {
+			errJsonStatus(w, fmt.Sprintf(`Error al reintentar la entrega: %v`, err), http.StatusInternalServerError)
+			return
+		}
+		if n == 0 {
+			errJsonStatus(w, fmt.Sprintf(`La entrega con id %d no existe`, iid), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": "Entrega en cola"}`))
+	}
+}
+
+// writeJson responde con el valor serializado en JSON
+func writeJson(w http.ResponseWriter, data any) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		errJsonStatus(w, fmt.Sprintf(`Error al convertir a JSON: %v`, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+}
+
+func validateWebhookSubscription(sent WebhookSubscriptionPostSent) error {
+	if err := validateRedirectUriFormat(sent.Url); err != nil {
+		return fmt.Errorf("url: %v", err)
+	}
+	if len(sent.Events) == 0 {
+		return fmt.Errorf("el campo events es requerido")
+	}
+	for _, event := range sent.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return fmt.Errorf("evento desconocido %q, se admiten: %s", event, strings.Join(webhookEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// webhookSecretCreate genera el secreto HMAC de una suscripción
+func webhookSecretCreate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// webhookSignature firma "timestamp.body" con HMAC-SHA256
+func webhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff devuelve la espera antes del siguiente intento (exponencial con tope)
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookFirstBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, webhookMaxBackoff)
+}
+
+// webhookDispatcher envía en segundo plano las entregas pendientes del outbox hasta el apagado
+func webhookDispatcher(ctx context.Context, db *sql.DB) {
+
+	client := &http.Client{Timeout: webhookHttpTimeout}
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lifecycle.Stopping():
+			// al apagar no se reclaman más entregas; las reclamadas ya se han enviado
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := postgres_webhook_deliveries_claim(ctx, db, webhookBatchSize)
+		if err != nil {
+			slog.Error("webhookDispatcher error al reclamar entregas", "error", err)
+			continue
+		}
+		for _, job := range jobs {
+			webhookDeliver(ctx, db, client, job)
+		}
+	}
+}
+
+// webhookDeliver realiza un intento de entrega y registra el resultado
+func webhookDeliver(ctx context.Context, db *sql.DB, client *http.Client, job webhookJob) {
+
+	status_code, err := webhookPost(client, job)
+
+	attempts := job.Attempts + 1
+	status := "delivered"
+	next_attempt_at := time.Now()
+	if err != nil {
+		slog.Warn("webhookDeliver intento fallido", "delivery_id", job.DeliveryID, "attempt", attempts, "error", err)
+		status = "pending"
+		next_attempt_at = time.Now().Add(webhookBackoff(attempts))
+		if attempts >= webhookMaxAttempts {
+			status = "failed"
+		}
+	}
+
+	if uerr := postgres_webhook_delivery_update(ctx, db, job.DeliveryID, status, attempts, next_attempt_at, status_code, err); uerr != nil {
+		slog.Error("webhookDeliver error al actualizar la entrega", "delivery_id", job.DeliveryID, "error", uerr)
+	}
+}
+
+func webhookPost(client *http.Client, job webhookJob) (int, error) {
+
+	body, err := json.Marshal(job.Event)
+	if err != nil {
+		return 0, fmt.Errorf("error al convertir el evento a JSON: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", job.Url, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, fmt.Errorf("error al crear la solicitud HTTP: %v", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(job.Event.ID, 10))
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(job.DeliveryID, 10))
+	req.Header.Set("X-Webhook-Event", job.Event.Type)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", webhookSignature(job.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error al realizar la solicitud HTTP: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("código de estado inesperado: %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// postgres_webhook_deliveries_enqueue crea las entregas del evento para las suscripciones activas
+func postgres_webhook_deliveries_enqueue(ctx context.Context, tx *sql.Tx, outbox_id int64, event_type string) error {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_deliveries_enqueue")
+	defer span.End()
+
+	query := `
+		INSERT INTO webhook_deliveries (outbox_id, subscription_id)
+		SELECT $1, id
+		FROM webhook_subscriptions
+		WHERE active AND $2 = ANY(events);`
+	_, err := tx.ExecContext(ctx, query, outbox_id, event_type)
+	return err
+}
+
+// postgres_webhook_deliveries_claim reserva un lote de entregas vencidas;
+// al mover next_attempt_at otra réplica no las toma mientras dura el intento
+func postgres_webhook_deliveries_claim(ctx context.Context, db *sql.DB, limit int) ([]webhookJob, error) {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_deliveries_claim")
+	defer span.End()
+
+	query := `
+		WITH claimed AS (
+			UPDATE
+				webhook_deliveries
+			SET
+				next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+			WHERE id IN (
+				SELECT id
+				FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+				ORDER BY id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, outbox_id, subscription_id, attempts
+		)
+		SELECT
+			c.id, c.attempts, s.url, s.secret,
+			o.id, o.event_type, o.entity, o.entity_id, o.payload, o.created_at
+		FROM claimed c
+			JOIN webhook_subscriptions s ON s.id = c.subscription_id
+			JOIN events_outbox o ON o.id = c.outbox_id
+		ORDER BY c.id;`
+	rows, err := db.QueryContext(ctx, query, limit, webhookLease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []webhookJob
+	for rows.Next() {
+		var job webhookJob
+		var payload []byte
+		if err := rows.Scan(&job.DeliveryID, &job.Attempts, &job.Url, &job.Secret,
+			&job.Event.ID, &job.Event.Type, &job.Event.Entity, &job.Event.EntityID,
+			&payload, &job.Event.CreatedAt); err != nil {
+			return nil, err
+		}
+		job.Event.Data = payload
+		list = append(list, job)
+	}
+	return list, rows.Err()
+}
+
+func postgres_webhook_delivery_update(ctx context.Context, db *sql.DB, id int64, status string, attempts int, next_attempt_at time.Time, status_code int, deliveryErr error) error {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_delivery_update")
+	defer span.End()
+
+	var last_status_code *int
+	if status_code != 0 {
+		last_status_code = &status_code
+	}
+	var last_error *string
+	if deliveryErr != nil {
+		msg := deliveryErr.Error()
+		last_error = &msg
+	}
+
+	query := `
+		UPDATE
+			webhook_deliveries
+		SET
+			status = $1, attempts = $2, next_attempt_at = $3,
+			last_status_code = $4, last_error = $5,
+			delivered_at = CASE WHEN $1 = 'delivered' THEN CURRENT_TIMESTAMP ELSE NULL END
+		WHERE id = $6;`
+	_, err := db.ExecContext(ctx, query, status, attempts, next_attempt_at, last_status_code, last_error, id)
+	return err
+}
+
+func postgres_webhook_deliveries(ctx context.Context, db *sql.DB, subscription_id int, status string, limit int) ([]WebhookDelivery, error) {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_deliveries")
+	defer span.End()
+
+	query := `
+		SELECT
+			d.id, d.outbox_id, d.subscription_id, o.event_type,
+			d.status, d.attempts, d.next_attempt_at,
+			d.last_status_code, d.last_error,
+			d.created_at, d.delivered_at
+		FROM
+			webhook_deliveries d
+			JOIN events_outbox o ON o.id = d.outbox_id
+		WHERE
+			($1 = 0 OR d.subscription_id = $1) AND ($2 = '' OR d.status = $2)
+		ORDER BY d.id DESC
+		LIMIT $3;`
+	rows, err := db.QueryContext(ctx, query, subscription_id, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []WebhookDelivery{}
+	for rows.Next() {
+		var item WebhookDelivery
+		if err := rows.Scan(&item.ID, &item.OutboxID, &item.SubscriptionID, &item.EventType,
+			&item.Status, &item.Attempts, &item.NextAttemptAt,
+			&item.LastStatusCode, &item.LastError,
+			&item.CreatedAt, &item.DeliveredAt); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, rows.Err()
+}
+
+func postgres_webhook_subscriptions(ctx context.Context, db *sql.DB, auth_client_id int) ([]WebhookSubscription, error) {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_subscriptions")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, auth_client_id, url, events, active, created_at
+		FROM
+			webhook_subscriptions
+		WHERE
+			($1 = 0 OR auth_client_id = $1)
+		ORDER BY id;`
+	rows, err := db.QueryContext(ctx, query, auth_client_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []WebhookSubscription{}
+	for rows.Next() {
+		var item WebhookSubscription
+		if err := rows.Scan(&item.ID, &item.AuthClientId, &item.Url,
+			pq.Array(&item.Events), &item.Active, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, rows.Err()
+}
+
+func postgres_webhook_subscription_by_id(ctx context.Context, db *sql.DB, id int) (*WebhookSubscription, error) {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_subscription_by_id")
+	defer span.End()
+
+	query := `
+		SELECT
+			id, auth_client_id, url, secret, events, active, created_at
+		FROM
+			webhook_subscriptions
+		WHERE
+			id = $1;`
+	var item WebhookSubscription
+	err := db.QueryRowContext(ctx, query, id).Scan(&item.ID, &item.AuthClientId, &item.Url,
+		&item.Secret, pq.Array(&item.Events), &item.Active, &item.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w con id %d", errWebhookNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func postgres_webhook_subscription_insert(ctx context.Context, db *sql.DB, auth_client_id int, url, secret string, events []string, active bool) (*WebhookSubscription, error) {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_subscription_insert")
+	defer span.End()
+
+	query := `
+		INSERT INTO webhook_subscriptions (auth_client_id, url, secret, events, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at;`
+	item := WebhookSubscription{
+		AuthClientId: auth_client_id,
+		Url:          url,
+		Secret:       &secret,
+		Events:       events,
+		Active:       active,
+	}
+	err := db.QueryRowContext(ctx, query, auth_client_id, url, secret, pq.Array(events), active).Scan(&item.ID, &item.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func postgres_webhook_subscription_update(ctx context.Context, db *sql.DB, id int, url string, events []string, active bool) (int64, error) {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_subscription_update")
+	defer span.End()
+
+	query := `
+		UPDATE
+			webhook_subscriptions
+		SET
+			url = $1, events = $2, active = $3
+		WHERE id = $4;`
+	res, err := db.ExecContext(ctx, query, url, pq.Array(events), active, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// postgres_webhook_subscription_delete elimina una suscripción; devuelve las filas borradas
+func postgres_webhook_subscription_delete(ctx context.Context, db *sql.DB, id int) (int64, error) {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_subscription_delete")
+	defer span.End()
+
+	res, err := db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1;`, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// postgres_webhook_delivery_retry vuelve a poner en cola una entrega; devuelve las filas actualizadas
+func postgres_webhook_delivery_retry(ctx context.Context, db *sql.DB, id int) (int64, error) {
+	ctx, span := startDbSpan(ctx, "postgres_webhook_delivery_retry")
+	defer span.End()
+
+	query := `
+		UPDATE
+			webhook_deliveries
+		SET
+			status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $1;`
+	res, err := db.ExecContext(ctx, query, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}